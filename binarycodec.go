@@ -0,0 +1,1203 @@
+package hare
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The built-in binary codecs encode values straight from and into Go
+// values with reflection, following the rules json uses: fields are
+// named by their json tags, omitempty and the string option are
+// honoured, []byte is a base64 string, and map keys are strings.  Types
+// that implement json.Marshaler or json.Unmarshaler, like time.Time, are
+// converted through json, since that is the only form they know.
+
+var errNestedTooDeep = errors.New("hare: value nested too deeply")
+
+// maxSizeHint caps how many items are allocated up front for an array
+// or map, since a length read from the data is only bounded by the
+// size of the data, not by the size of the items it would hold.
+const maxSizeHint = 1024
+
+// maxNesting is how deep arrays, maps, and pointers may nest in a value
+// being encoded or decoded, which stops cyclic values and hostile data
+// from overflowing the stack.
+const maxNesting = 10000
+
+var (
+	jsonMarshalerType   = reflect.TypeFor[json.Marshaler]()
+	jsonUnmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+	jsonNumberType      = reflect.TypeFor[json.Number]()
+	textMarshalerType   = reflect.TypeFor[encoding.TextMarshaler]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// binaryFormat appends the data items of a binary codec, which has the
+// same data model json has.
+type binaryFormat interface {
+	appendNil(b []byte) []byte
+	appendBool(b []byte, v bool) []byte
+	appendInt(b []byte, i int64) []byte
+	appendUint(b []byte, u uint64) []byte
+	appendFloat(b []byte, f float64) []byte
+	appendString(b []byte, s string) []byte
+	appendArrayLen(b []byte, n int) []byte
+	appendMapLen(b []byte, n int) []byte
+}
+
+// binaryReader reads the data items of a binary codec one token at a
+// time.
+type binaryReader interface {
+	next() (token, error)
+
+	// atBreak reports whether the next byte ends an array or map of
+	// unknown length, and skips it if it does.
+	atBreak() (bool, error)
+
+	// invalid returns the error for data the codec cannot read.
+	invalid() error
+}
+
+type tokenKind int
+
+const (
+	tokNil tokenKind = iota
+	tokBool
+	tokInt
+	tokUint
+	tokFloat
+	tokString
+	tokArray
+	tokMap
+)
+
+// token is one data item.  Arrays and maps hold the number of items or
+// pairs that follow in n, or -1 if they run until a break.
+type token struct {
+	kind tokenKind
+	b    bool
+	i    int64
+	u    uint64
+	f    float64
+	s    []byte
+	n    int
+}
+
+// describe returns the json name of the token's kind, for errors.
+func (tok token) describe() string {
+	switch tok.kind {
+	case tokNil:
+		return "null"
+	case tokBool:
+		return "bool"
+	case tokString:
+		return "string"
+	case tokArray:
+		return "array"
+	case tokMap:
+		return "object"
+	}
+
+	return "number"
+}
+
+func (tok token) float() float64 {
+	switch tok.kind {
+	case tokInt:
+		return float64(tok.i)
+	case tokUint:
+		return float64(tok.u)
+	}
+
+	return tok.f
+}
+
+func (tok token) int64() (int64, bool) {
+	switch tok.kind {
+	case tokInt:
+		return tok.i, true
+	case tokUint:
+		return int64(tok.u), tok.u <= math.MaxInt64
+	}
+
+	if tok.f != math.Trunc(tok.f) || tok.f < math.MinInt64 || tok.f >= math.MaxInt64 {
+		return 0, false
+	}
+
+	return int64(tok.f), true
+}
+
+// number returns a number token as the text of a json.Number.
+func (tok token) number() string {
+	switch tok.kind {
+	case tokInt:
+		return strconv.FormatInt(tok.i, 10)
+	case tokUint:
+		return strconv.FormatUint(tok.u, 10)
+	}
+
+	return strconv.FormatFloat(tok.f, 'g', -1, 64)
+}
+
+func (tok token) uint64() (uint64, bool) {
+	switch tok.kind {
+	case tokInt:
+		return uint64(tok.i), tok.i >= 0
+	case tokUint:
+		return tok.u, true
+	}
+
+	if tok.f != math.Trunc(tok.f) || tok.f < 0 || tok.f >= math.MaxUint64 {
+		return 0, false
+	}
+
+	return uint64(tok.f), true
+}
+
+// codecType records which of the interfaces json looks for a type, or
+// a pointer to it, implements.
+type codecType struct {
+	jsonMarshaler      bool
+	textMarshaler      bool
+	ptrMarshaler       bool
+	ptrJSONUnmarshaler bool
+	ptrTextUnmarshaler bool
+}
+
+// codecTypes caches a codecType for each reflect.Type.
+var codecTypes sync.Map
+
+func typeInfo(t reflect.Type) codecType {
+	if ct, ok := codecTypes.Load(t); ok {
+		return ct.(codecType)
+	}
+
+	ptr := reflect.PointerTo(t)
+
+	ct := codecType{
+		jsonMarshaler:      t.Implements(jsonMarshalerType),
+		textMarshaler:      t.Implements(textMarshalerType),
+		ptrMarshaler:       ptr.Implements(jsonMarshalerType) || ptr.Implements(textMarshalerType),
+		ptrJSONUnmarshaler: ptr.Implements(jsonUnmarshalerType),
+		ptrTextUnmarshaler: ptr.Implements(textUnmarshalerType),
+	}
+
+	codecTypes.Store(t, ct)
+
+	return ct
+}
+
+// codecField is a struct field as json sees it.
+type codecField struct {
+	name      string
+	index     []int
+	depth     int
+	tagged    bool
+	omitEmpty bool
+	quoted    bool
+}
+
+type codecStruct struct {
+	fields []codecField
+	byName map[string]*codecField
+}
+
+// codecStructs caches the fields of each struct type by reflect.Type.
+var codecStructs sync.Map
+
+// structFields takes a struct type and returns the fields json would
+// encode, in the order it would encode them.
+func structFields(t reflect.Type) *codecStruct {
+	if cs, ok := codecStructs.Load(t); ok {
+		return cs.(*codecStruct)
+	}
+
+	var all []codecField
+
+	collectFields(t, nil, map[reflect.Type]bool{t: true}, &all)
+
+	// Of the fields that share a name, the least deeply embedded one
+	// wins, then the one with a tag.  If that leaves a tie, json drops
+	// them all.
+	byName := make(map[string][]int)
+
+	for i, f := range all {
+		byName[f.name] = append(byName[f.name], i)
+	}
+
+	keep := make([]bool, len(all))
+
+	for _, same := range byName {
+		sort.SliceStable(same, func(i, j int) bool {
+			a, b := all[same[i]], all[same[j]]
+			if a.depth != b.depth {
+				return a.depth < b.depth
+			}
+			return a.tagged && !b.tagged
+		})
+
+		if len(same) > 1 && all[same[0]].depth == all[same[1]].depth && all[same[0]].tagged == all[same[1]].tagged {
+			continue
+		}
+
+		keep[same[0]] = true
+	}
+
+	cs := &codecStruct{byName: make(map[string]*codecField)}
+
+	for i, f := range all {
+		if keep[i] {
+			cs.fields = append(cs.fields, f)
+		}
+	}
+
+	for i := range cs.fields {
+		cs.byName[cs.fields[i].name] = &cs.fields[i]
+	}
+
+	actual, _ := codecStructs.LoadOrStore(t, cs)
+
+	return actual.(*codecStruct)
+}
+
+// collectFields appends the fields of struct type t, and of the structs
+// embedded in it without a json name, to fields.
+func collectFields(t reflect.Type, index []int, visited map[reflect.Type]bool, fields *[]codecField) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+
+		fieldIndex := append(append([]int(nil), index...), i)
+
+		if sf.Anonymous {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+
+			if !sf.IsExported() && ft.Kind() != reflect.Struct {
+				continue
+			}
+
+			if name == "" && ft.Kind() == reflect.Struct {
+				if !visited[ft] {
+					visited[ft] = true
+					collectFields(ft, fieldIndex, visited, fields)
+					delete(visited, ft)
+				}
+				continue
+			}
+		} else if !sf.IsExported() {
+			continue
+		}
+
+		f := codecField{
+			name:      name,
+			index:     fieldIndex,
+			depth:     len(index),
+			tagged:    name != "",
+			omitEmpty: hasTagOption(opts, "omitempty"),
+		}
+
+		if !f.tagged {
+			f.name = sf.Name
+		}
+
+		if hasTagOption(opts, "string") {
+			switch sf.Type.Kind() {
+			case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+				reflect.Float32, reflect.Float64, reflect.String:
+				f.quoted = true
+			}
+		}
+
+		*fields = append(*fields, f)
+	}
+}
+
+func hasTagOption(opts string, option string) bool {
+	for opts != "" {
+		var opt string
+
+		opt, opts, _ = strings.Cut(opts, ",")
+		if opt == option {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fieldValue takes a struct value and a field index and returns the
+// field, or false if it is reached through a nil embedded pointer.
+func fieldValue(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+
+		v = v.Field(x)
+	}
+
+	return v, true
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+// binaryEncoder appends Go values in a binary format.
+type binaryEncoder struct {
+	f     binaryFormat
+	depth int
+}
+
+// marshalBinary takes a binary format and a value and returns the value
+// encoded in that format.
+func marshalBinary(f binaryFormat, v interface{}) ([]byte, error) {
+	e := binaryEncoder{f: f}
+
+	return e.append(nil, reflect.ValueOf(v))
+}
+
+func (e *binaryEncoder) append(b []byte, v reflect.Value) ([]byte, error) {
+	if e.depth++; e.depth > maxNesting {
+		return nil, errNestedTooDeep
+	}
+
+	b, err := e.appendValue(b, v)
+
+	e.depth--
+
+	return b, err
+}
+
+func (e *binaryEncoder) appendValue(b []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return e.f.appendNil(b), nil
+	}
+
+	if v.Kind() == reflect.Interface {
+		return e.appendValue(b, v.Elem())
+	}
+
+	t := v.Type()
+	info := typeInfo(t)
+
+	if v.Kind() != reflect.Ptr && v.CanAddr() && info.ptrMarshaler {
+		v = v.Addr()
+		t = v.Type()
+		info = typeInfo(t)
+	}
+
+	if (info.jsonMarshaler || info.textMarshaler) && v.CanInterface() {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return e.f.appendNil(b), nil
+		}
+
+		if info.jsonMarshaler {
+			generic, err := toGeneric(v.Interface())
+			if err != nil {
+				return nil, err
+			}
+
+			return e.appendValue(b, reflect.ValueOf(generic))
+		}
+
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, err
+		}
+
+		return e.f.appendString(b, string(text)), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return e.f.appendBool(b, v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return e.f.appendInt(b, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return e.f.appendUint(b, v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return e.appendFloat(b, v)
+	case reflect.String:
+		if t == jsonNumberType {
+			return e.appendNumber(b, v.String())
+		}
+
+		return e.f.appendString(b, v.String()), nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return e.f.appendNil(b), nil
+		}
+
+		return e.append(b, v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			return e.f.appendNil(b), nil
+		}
+
+		if isByteSlice(t) {
+			return e.f.appendString(b, base64.StdEncoding.EncodeToString(v.Bytes())), nil
+		}
+
+		return e.appendArray(b, v)
+	case reflect.Array:
+		return e.appendArray(b, v)
+	case reflect.Map:
+		if v.IsNil() {
+			return e.f.appendNil(b), nil
+		}
+
+		return e.appendMap(b, v)
+	case reflect.Struct:
+		return e.appendStruct(b, v)
+	}
+
+	return nil, &json.UnsupportedTypeError{Type: t}
+}
+
+func (e *binaryEncoder) appendArray(b []byte, v reflect.Value) ([]byte, error) {
+	var err error
+
+	b = e.f.appendArrayLen(b, v.Len())
+
+	for i := 0; i < v.Len(); i++ {
+		if b, err = e.append(b, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+func (e *binaryEncoder) appendFloat(b []byte, v reflect.Value) ([]byte, error) {
+	f := v.Float()
+
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, &json.UnsupportedValueError{Value: v, Str: strconv.FormatFloat(f, 'g', -1, 64)}
+	}
+
+	// A float32 is stored as the float64 json would read back from it,
+	// so 0.1 stays 0.1 rather than 0.10000000149011612.
+	if v.Kind() == reflect.Float32 {
+		f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'g', -1, 32), 64)
+	}
+
+	return e.f.appendFloat(b, f), nil
+}
+
+// appendMap appends a map with its keys sorted, the way json does.
+func (e *binaryEncoder) appendMap(b []byte, v reflect.Value) ([]byte, error) {
+	type pair struct {
+		key   string
+		value reflect.Value
+	}
+
+	pairs := make([]pair, 0, v.Len())
+
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := mapKeyString(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+
+		pairs = append(pairs, pair{key, iter.Value()})
+	}
+
+	slices.SortFunc(pairs, func(a, b pair) int { return strings.Compare(a.key, b.key) })
+
+	var err error
+
+	b = e.f.appendMapLen(b, len(pairs))
+
+	for _, p := range pairs {
+		b = e.f.appendString(b, p.key)
+
+		if b, err = e.append(b, p.value); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// appendNumber appends a json.Number as an integer if it is one and as
+// a float if it is not.
+func (e *binaryEncoder) appendNumber(b []byte, n string) ([]byte, error) {
+	if n == "" {
+		n = "0"
+	}
+
+	if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+		return e.f.appendInt(b, i), nil
+	}
+
+	if u, err := strconv.ParseUint(n, 10, 64); err == nil {
+		return e.f.appendUint(b, u), nil
+	}
+
+	f, err := strconv.ParseFloat(n, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.f.appendFloat(b, f), nil
+}
+
+func (e *binaryEncoder) appendStruct(b []byte, v reflect.Value) ([]byte, error) {
+	cs := structFields(v.Type())
+
+	n := 0
+
+	for i := range cs.fields {
+		if fv, ok := fieldValue(v, cs.fields[i].index); ok && !(cs.fields[i].omitEmpty && isEmptyValue(fv)) {
+			n++
+		}
+	}
+
+	var err error
+
+	b = e.f.appendMapLen(b, n)
+
+	for i := range cs.fields {
+		f := &cs.fields[i]
+
+		fv, ok := fieldValue(v, f.index)
+		if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+
+		b = e.f.appendString(b, f.name)
+
+		if f.quoted {
+			b, err = e.appendQuoted(b, fv)
+		} else {
+			b, err = e.append(b, fv)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// appendQuoted appends a field with the json string option as the
+// string json would write inside the quotes.
+func (e *binaryEncoder) appendQuoted(b []byte, v reflect.Value) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		return e.f.appendString(b, strconv.FormatBool(v.Bool())), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return e.f.appendString(b, strconv.FormatInt(v.Int(), 10)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return e.f.appendString(b, strconv.FormatUint(v.Uint(), 10)), nil
+	case reflect.Float32, reflect.Float64:
+		rawValue, err := json.Marshal(v.Interface())
+		if err != nil {
+			return nil, err
+		}
+
+		return e.f.appendString(b, string(rawValue)), nil
+	}
+
+	rawValue, err := json.Marshal(v.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return e.f.appendString(b, string(rawValue)), nil
+}
+
+// mapKeyString takes a map key and returns it as the string json would
+// use for it.
+func mapKeyString(key reflect.Value) (string, error) {
+	if key.Kind() == reflect.String {
+		return key.String(), nil
+	}
+
+	if typeInfo(key.Type()).textMarshaler {
+		if key.Kind() == reflect.Ptr && key.IsNil() {
+			return "", nil
+		}
+
+		text, err := key.Interface().(encoding.TextMarshaler).MarshalText()
+
+		return string(text), err
+	}
+
+	switch key.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	}
+
+	return "", &json.UnsupportedTypeError{Type: key.Type()}
+}
+
+// isByteSlice reports whether a slice type is one json writes as a
+// base64 string.
+func isByteSlice(t reflect.Type) bool {
+	elem := t.Elem()
+
+	if elem.Kind() != reflect.Uint8 {
+		return false
+	}
+
+	return !typeInfo(elem).ptrMarshaler
+}
+
+// binaryDecoder stores data items read in a binary format in Go values.
+type binaryDecoder struct {
+	r     binaryReader
+	depth int
+}
+
+// unmarshalBinary takes a reader for a binary format and a pointer and
+// stores the next data item in the value the pointer points to.
+func unmarshalBinary(r binaryReader, v interface{}) error {
+	rv := reflect.ValueOf(v)
+
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &json.InvalidUnmarshalError{Type: reflect.TypeOf(v)}
+	}
+
+	d := binaryDecoder{r: r}
+
+	return d.decode(rv.Elem())
+}
+
+func (d *binaryDecoder) decode(v reflect.Value) error {
+	tok, err := d.r.next()
+	if err != nil {
+		return err
+	}
+
+	return d.decodeToken(tok, v)
+}
+
+func (d *binaryDecoder) decodeToken(tok token, v reflect.Value) error {
+	if d.depth++; d.depth > maxNesting {
+		return errNestedTooDeep
+	}
+
+	err := d.decodeValue(tok, v)
+
+	d.depth--
+
+	return err
+}
+
+func (d *binaryDecoder) decodeValue(tok token, v reflect.Value) error {
+	if tok.kind == tokNil {
+		switch v.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+
+		return nil
+	}
+
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		v = v.Elem()
+	}
+
+	info := typeInfo(v.Type())
+
+	if v.CanAddr() && (info.ptrJSONUnmarshaler || info.ptrTextUnmarshaler) {
+		ptr := v.Addr()
+
+		if info.ptrJSONUnmarshaler {
+			generic, err := d.generic(tok, true)
+			if err != nil {
+				return err
+			}
+
+			rawValue, err := json.Marshal(generic)
+			if err != nil {
+				return err
+			}
+
+			return ptr.Interface().(json.Unmarshaler).UnmarshalJSON(rawValue)
+		}
+
+		if tok.kind == tokString {
+			return ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText(tok.s)
+		}
+	}
+
+	if v.Kind() == reflect.Interface {
+		if v.NumMethod() != 0 {
+			return &json.UnmarshalTypeError{Value: tok.describe(), Type: v.Type()}
+		}
+
+		generic, err := d.generic(tok, false)
+		if err != nil {
+			return err
+		}
+
+		if generic == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(generic))
+		}
+
+		return nil
+	}
+
+	switch tok.kind {
+	case tokBool:
+		if v.Kind() == reflect.Bool {
+			v.SetBool(tok.b)
+			return nil
+		}
+	case tokInt, tokUint, tokFloat:
+		if v.Type() == jsonNumberType {
+			v.SetString(tok.number())
+			return nil
+		}
+
+		if setNumber(v, tok) {
+			return nil
+		}
+	case tokString:
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(tok.s))
+			return nil
+		case v.Kind() == reflect.Slice && isByteSlice(v.Type()):
+			data, err := base64.StdEncoding.DecodeString(string(tok.s))
+			if err != nil {
+				return err
+			}
+
+			v.SetBytes(data)
+			return nil
+		}
+	case tokArray:
+		switch v.Kind() {
+		case reflect.Slice, reflect.Array:
+			return d.decodeArray(tok, v)
+		}
+	case tokMap:
+		switch v.Kind() {
+		case reflect.Struct:
+			return d.decodeStruct(tok, v)
+		case reflect.Map:
+			return d.decodeMap(tok, v)
+		}
+	}
+
+	return &json.UnmarshalTypeError{Value: tok.describe(), Type: v.Type()}
+}
+
+func (d *binaryDecoder) decodeArray(tok token, v reflect.Value) error {
+	if v.Kind() == reflect.Slice {
+		v.Set(reflect.MakeSlice(v.Type(), 0, sizeHint(tok)))
+	}
+
+	i := 0
+
+	for ; ; i++ {
+		more, err := d.more(tok, i)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+
+		if v.Kind() == reflect.Slice {
+			if i >= v.Cap() {
+				v.Grow(1)
+			}
+			v.SetLen(i + 1)
+		}
+
+		if v.Kind() == reflect.Array && i >= v.Len() {
+			if err := d.skip(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := d.decode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+
+	if v.Kind() == reflect.Array {
+		for ; i < v.Len(); i++ {
+			v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+		}
+	}
+
+	return nil
+}
+
+func (d *binaryDecoder) decodeMap(tok token, v reflect.Value) error {
+	t := v.Type()
+
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(t))
+	}
+
+	for i := 0; ; i++ {
+		more, err := d.more(tok, i)
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+
+		key, err := d.key()
+		if err != nil {
+			return err
+		}
+
+		kv, err := mapKeyValue(t.Key(), key)
+		if err != nil {
+			return err
+		}
+
+		elem := reflect.New(t.Elem()).Elem()
+
+		if err := d.decode(elem); err != nil {
+			return err
+		}
+
+		v.SetMapIndex(kv, elem)
+	}
+}
+
+func (d *binaryDecoder) decodeStruct(tok token, v reflect.Value) error {
+	cs := structFields(v.Type())
+
+	for i := 0; ; i++ {
+		more, err := d.more(tok, i)
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+
+		key, err := d.key()
+		if err != nil {
+			return err
+		}
+
+		f := cs.byName[string(key)]
+		if f == nil {
+			// json falls back to a case-insensitive match.
+			for j := range cs.fields {
+				if strings.EqualFold(cs.fields[j].name, string(key)) {
+					f = &cs.fields[j]
+					break
+				}
+			}
+		}
+
+		var fv reflect.Value
+
+		ok := false
+		if f != nil {
+			fv, ok = settableField(v, f.index)
+		}
+
+		if !ok {
+			if err := d.skip(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if f.quoted {
+			err = d.decodeQuoted(fv)
+		} else {
+			err = d.decode(fv)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// decodeQuoted decodes a field with the json string option, which is
+// stored as a string holding the json for its value.
+func (d *binaryDecoder) decodeQuoted(v reflect.Value) error {
+	tok, err := d.r.next()
+	if err != nil {
+		return err
+	}
+
+	if tok.kind == tokNil {
+		return nil
+	}
+
+	if tok.kind != tokString {
+		return &json.UnmarshalTypeError{Value: tok.describe(), Type: v.Type()}
+	}
+
+	return json.Unmarshal(tok.s, v.Addr().Interface())
+}
+
+// generic takes a token and returns it, and any items that follow it,
+// as generic values.  Numbers are float64, the way json decodes them,
+// unless exact is set.
+func (d *binaryDecoder) generic(tok token, exact bool) (interface{}, error) {
+	switch tok.kind {
+	case tokNil:
+		return nil, nil
+	case tokBool:
+		return tok.b, nil
+	case tokInt:
+		if exact {
+			return tok.i, nil
+		}
+		return float64(tok.i), nil
+	case tokUint:
+		if exact {
+			return tok.u, nil
+		}
+		return float64(tok.u), nil
+	case tokFloat:
+		return tok.f, nil
+	case tokString:
+		return string(tok.s), nil
+	}
+
+	if d.depth++; d.depth > maxNesting {
+		return nil, errNestedTooDeep
+	}
+	defer func() { d.depth-- }()
+
+	if tok.kind == tokArray {
+		arr := make([]interface{}, 0, sizeHint(tok))
+
+		for i := 0; ; i++ {
+			more, err := d.more(tok, i)
+			if err != nil {
+				return nil, err
+			}
+			if !more {
+				return arr, nil
+			}
+
+			elemTok, err := d.r.next()
+			if err != nil {
+				return nil, err
+			}
+
+			elem, err := d.generic(elemTok, exact)
+			if err != nil {
+				return nil, err
+			}
+
+			arr = append(arr, elem)
+		}
+	}
+
+	obj := make(map[string]interface{}, sizeHint(tok))
+
+	for i := 0; ; i++ {
+		more, err := d.more(tok, i)
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			return obj, nil
+		}
+
+		key, err := d.key()
+		if err != nil {
+			return nil, err
+		}
+
+		valueTok, err := d.r.next()
+		if err != nil {
+			return nil, err
+		}
+
+		if obj[string(key)], err = d.generic(valueTok, exact); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// key reads a map key, which has to be a string.
+func (d *binaryDecoder) key() ([]byte, error) {
+	tok, err := d.r.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok.kind != tokString {
+		return nil, d.r.invalid()
+	}
+
+	return tok.s, nil
+}
+
+// more takes an array or map token and the number of items or pairs
+// read so far and reports whether there is another.
+func (d *binaryDecoder) more(tok token, i int) (bool, error) {
+	if tok.n >= 0 {
+		return i < tok.n, nil
+	}
+
+	done, err := d.r.atBreak()
+
+	return !done, err
+}
+
+// skip reads past the next data item.
+func (d *binaryDecoder) skip() error {
+	tok, err := d.r.next()
+	if err != nil {
+		return err
+	}
+
+	_, err = d.generic(tok, true)
+
+	return err
+}
+
+// mapKeyValue takes a map key type and a key read from the data and
+// returns the key as a value of that type.
+func mapKeyValue(t reflect.Type, key []byte) (reflect.Value, error) {
+	if typeInfo(t).ptrTextUnmarshaler {
+		kv := reflect.New(t)
+
+		if err := kv.Interface().(encoding.TextUnmarshaler).UnmarshalText(key); err != nil {
+			return reflect.Value{}, err
+		}
+
+		return kv.Elem(), nil
+	}
+
+	kv := reflect.New(t).Elem()
+
+	switch t.Kind() {
+	case reflect.String:
+		kv.SetString(string(key))
+		return kv, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(string(key), 10, 64)
+		if err == nil && !kv.OverflowInt(i) {
+			kv.SetInt(i)
+			return kv, nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(string(key), 10, 64)
+		if err == nil && !kv.OverflowUint(u) {
+			kv.SetUint(u)
+			return kv, nil
+		}
+	}
+
+	return reflect.Value{}, &json.UnmarshalTypeError{Value: "number " + string(key), Type: t}
+}
+
+// setNumber takes a value and a number token and stores the number in
+// the value.  It returns false if the value cannot hold the number.
+func setNumber(v reflect.Value, tok token) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := tok.int64()
+		if !ok || v.OverflowInt(i) {
+			return false
+		}
+
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, ok := tok.uint64()
+		if !ok || v.OverflowUint(u) {
+			return false
+		}
+
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f := tok.float()
+		if v.OverflowFloat(f) {
+			return false
+		}
+
+		v.SetFloat(f)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// settableField takes a struct value and a field index and returns the
+// field, allocating any nil embedded pointers on the way.  It returns
+// false if one of them cannot be set.
+func settableField(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+
+		v = v.Field(x)
+	}
+
+	return v, true
+}
+
+// sizeHint takes an array or map token and returns how many items to
+// allocate room for.
+func sizeHint(tok token) int {
+	return min(max(tok.n, 0), maxSizeHint)
+}
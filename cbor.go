@@ -0,0 +1,314 @@
+package hare
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var errCBOR = errors.New("hare: invalid or unsupported CBOR data")
+
+// The CBOR major types.
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+)
+
+// cborIndefinite is the additional information that starts an
+// indefinite-length string, array, or map, which ends with cborBreak.
+const (
+	cborIndefinite = 31
+	cborBreak      = 0xff
+)
+
+type cborCodec struct{}
+
+func (cborCodec) Name() string {
+	return "cbor"
+}
+
+func (cborCodec) Marshal(v interface{}) ([]byte, error) {
+	return marshalBinary(cborCodec{}, v)
+}
+
+func (cborCodec) Unmarshal(data []byte, v interface{}) error {
+	d := cborDecoder{data: data}
+
+	if err := unmarshalBinary(&d, v); err != nil {
+		return err
+	}
+
+	if d.pos != len(data) {
+		return errCBOR
+	}
+
+	return nil
+}
+
+// unexported methods
+
+func (cborCodec) appendArrayLen(b []byte, n int) []byte {
+	return appendCBORHead(b, cborArray, uint64(n))
+}
+
+func (cborCodec) appendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xf5)
+	}
+
+	return append(b, 0xf4)
+}
+
+func (cborCodec) appendFloat(b []byte, f float64) []byte {
+	return binary.BigEndian.AppendUint64(append(b, 0xfb), math.Float64bits(f))
+}
+
+func (cborCodec) appendInt(b []byte, i int64) []byte {
+	if i < 0 {
+		return appendCBORHead(b, cborNegInt, uint64(-1-i))
+	}
+
+	return appendCBORHead(b, cborUint, uint64(i))
+}
+
+func (cborCodec) appendMapLen(b []byte, n int) []byte {
+	return appendCBORHead(b, cborMap, uint64(n))
+}
+
+func (cborCodec) appendNil(b []byte) []byte {
+	return append(b, 0xf6)
+}
+
+func (cborCodec) appendString(b []byte, s string) []byte {
+	return append(appendCBORHead(b, cborText, uint64(len(s))), s...)
+}
+
+func (cborCodec) appendUint(b []byte, u uint64) []byte {
+	return appendCBORHead(b, cborUint, u)
+}
+
+// appendCBORHead appends the first bytes of a data item: its major type
+// and an argument, which is a value, a length, or a count.
+func appendCBORHead(b []byte, major byte, arg uint64) []byte {
+	major <<= 5
+
+	switch {
+	case arg < 24:
+		return append(b, major|byte(arg))
+	case arg <= math.MaxUint8:
+		return append(b, major|24, byte(arg))
+	case arg <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(arg))
+	case arg <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(arg))
+	}
+
+	return binary.BigEndian.AppendUint64(append(b, major|27), arg)
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+// arg reads the argument that follows the first byte of a data item.
+func (d *cborDecoder) arg(info byte) (uint64, error) {
+	size := 0
+
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, errCBOR
+	}
+
+	if size > len(d.data)-d.pos {
+		return 0, errCBOR
+	}
+
+	var u uint64
+	for _, c := range d.data[d.pos : d.pos+size] {
+		u = u<<8 | uint64(c)
+	}
+	d.pos += size
+
+	return u, nil
+}
+
+// atBreak reports whether the next byte ends an indefinite-length item,
+// and skips it if it does.
+func (d *cborDecoder) atBreak() (bool, error) {
+	if d.pos >= len(d.data) {
+		return false, errCBOR
+	}
+
+	if d.data[d.pos] != cborBreak {
+		return false, nil
+	}
+
+	d.pos++
+
+	return true, nil
+}
+
+func (d *cborDecoder) indefinite(major byte) (token, error) {
+	switch major {
+	case cborArray:
+		return token{kind: tokArray, n: -1}, nil
+	case cborMap:
+		return token{kind: tokMap, n: -1}, nil
+	case cborBytes, cborText:
+		// A string of unknown length is sent as chunks, which are
+		// joined here.
+		var s []byte
+
+		for {
+			done, err := d.atBreak()
+			if err != nil {
+				return token{}, err
+			}
+			if done {
+				return token{kind: tokString, s: s}, nil
+			}
+
+			chunk, err := d.next()
+			if err != nil {
+				return token{}, err
+			}
+
+			if chunk.kind != tokString {
+				return token{}, errCBOR
+			}
+
+			s = append(s, chunk.s...)
+		}
+	}
+
+	return token{}, errCBOR
+}
+
+func (d *cborDecoder) invalid() error {
+	return errCBOR
+}
+
+func (d *cborDecoder) next() (token, error) {
+	if d.pos >= len(d.data) {
+		return token{}, errCBOR
+	}
+
+	c := d.data[d.pos]
+	d.pos++
+
+	major := c >> 5
+	info := c & 0x1f
+
+	if major == cborSimple {
+		return d.simple(info)
+	}
+
+	if info == cborIndefinite {
+		return d.indefinite(major)
+	}
+
+	arg, err := d.arg(info)
+	if err != nil {
+		return token{}, err
+	}
+
+	switch major {
+	case cborUint:
+		return token{kind: tokUint, u: arg}, nil
+	case cborNegInt:
+		if arg > math.MaxInt64 {
+			return token{}, errCBOR
+		}
+		return token{kind: tokInt, i: -1 - int64(arg)}, nil
+	case cborBytes, cborText:
+		return d.str(arg)
+	case cborArray, cborMap:
+		if arg > uint64(len(d.data)-d.pos) {
+			return token{}, errCBOR
+		}
+
+		if major == cborArray {
+			return token{kind: tokArray, n: int(arg)}, nil
+		}
+		return token{kind: tokMap, n: int(arg)}, nil
+	}
+
+	// Tags add meaning to the item that follows them, which hare does
+	// not need, so the item is returned as is.
+	return d.next()
+}
+
+func (d *cborDecoder) simple(info byte) (token, error) {
+	switch info {
+	case 20:
+		return token{kind: tokBool, b: false}, nil
+	case 21:
+		return token{kind: tokBool, b: true}, nil
+	case 22, 23:
+		// null and undefined
+		return token{kind: tokNil}, nil
+	case 25:
+		u, err := d.arg(info)
+		return token{kind: tokFloat, f: halfToFloat(uint16(u))}, err
+	case 26:
+		u, err := d.arg(info)
+		return token{kind: tokFloat, f: float64(math.Float32frombits(uint32(u)))}, err
+	case 27:
+		u, err := d.arg(info)
+		return token{kind: tokFloat, f: math.Float64frombits(u)}, err
+	}
+
+	return token{}, errCBOR
+}
+
+func (d *cborDecoder) str(n uint64) (token, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return token{}, errCBOR
+	}
+
+	s := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+
+	return token{kind: tokString, s: s}, nil
+}
+
+// halfToFloat takes an IEEE 754 half-precision float and returns it as a
+// float64.
+func halfToFloat(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1.0
+	}
+
+	exp := int(h>>10) & 0x1f
+	frac := float64(h & 0x3ff)
+
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac == 0 {
+			return sign * math.Inf(1)
+		}
+		return math.NaN()
+	}
+
+	return sign * math.Ldexp(frac+1024, exp-25)
+}
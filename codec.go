@@ -0,0 +1,155 @@
+package hare
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// Codec encodes records for storage and decodes them again.  Records
+// are structs with json tags, and the built-in binary codecs encode the
+// same fields json would, so a struct can be stored with any of them.
+type Codec interface {
+	// Name returns the name recorded in the header of the tables
+	// written with the codec.
+	Name() string
+
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// The built-in codecs.
+var (
+	// JSON stores records as newline-delimited json.  It is the
+	// default.
+	JSON Codec = jsonCodec{}
+
+	// MessagePack stores records as MessagePack.
+	MessagePack Codec = msgpackCodec{}
+
+	// CBOR stores records as CBOR (RFC 8949).
+	CBOR Codec = cborCodec{}
+)
+
+// Option configures a Database.
+type Option func(*Database)
+
+// WithCodec takes a codec and returns an option that encodes the records
+// of new tables with it.  Tables that already exist keep the codec they
+// were created with, so a custom codec has to be passed every time a
+// database holding its tables is opened.
+func WithCodec(codec Codec) Option {
+	return func(db *Database) {
+		db.codec = codec
+		db.codecs[codec.Name()] = codec
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// unexported methods
+
+// codecFor takes a table name and returns the codec its records are
+// encoded with.
+func (db *Database) codecFor(tableName string) Codec {
+	if codec, _, ok := db.tableInfo(tableName); ok {
+		return codec
+	}
+
+	return db.codec
+}
+
+// decodeDoc takes a table name and a raw record and returns the record
+// decoded into generic json values.
+func (db *Database) decodeDoc(tableName string, rawRec []byte) (interface{}, error) {
+	var doc interface{}
+
+	codec := db.codecFor(tableName)
+
+	if err := codec.Unmarshal(rawRec, &doc); err != nil {
+		return nil, err
+	}
+
+	// The built-in codecs decode into the same generic values json
+	// does.
+	switch codec {
+	case JSON, MessagePack, CBOR:
+		return doc, nil
+	}
+
+	return normalizeValue(doc)
+}
+
+// loadCodec takes a table name and returns the codec named in the
+// table's settings.
+func (db *Database) loadCodec(tableName string) (Codec, error) {
+	store, ok := db.store.(metaStorer)
+	if !ok {
+		return db.codec, nil
+	}
+
+	meta, err := store.TableMeta(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	name, ok := meta["codec"]
+	if !ok {
+		name = JSON.Name()
+	}
+
+	codec, ok := db.codecs[name]
+	if !ok {
+		return nil, dberr.ErrUnknownCodec
+	}
+
+	return codec, nil
+}
+
+// toJSON takes a table name and a raw record and returns the record as
+// json.
+func (db *Database) toJSON(tableName string, rawRec []byte) ([]byte, error) {
+	if db.codecFor(tableName) == JSON {
+		return rawRec, nil
+	}
+
+	doc, err := db.decodeDoc(tableName, rawRec)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(doc)
+}
+
+// toGeneric takes a value and returns it as generic json values, with
+// numbers left as json.Number so integers keep their precision.
+func toGeneric(v interface{}) (interface{}, error) {
+	rawValue, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic interface{}
+
+	d := json.NewDecoder(bytes.NewReader(rawValue))
+	d.UseNumber()
+
+	if err := d.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	return generic, nil
+}
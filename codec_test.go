@@ -0,0 +1,397 @@
+package hare
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jameycribbs/hare/datastores/disk"
+	"github.com/jameycribbs/hare/dberr"
+)
+
+type codecBase struct {
+	Created time.Time `json:"created"`
+	Shadow  string    `json:"shadow"`
+}
+
+type codecExtra struct {
+	Note string `json:"note"`
+}
+
+type codecNode struct {
+	Next *codecNode `json:"next"`
+}
+
+type codecTagged struct {
+	ID      int    `json:"id"`
+	Shadow  string `json:"shadow"`
+	Skipped string `json:"-"`
+	Dash    string `json:"-,"`
+	Plain   string
+	Count   int64           `json:"count,string"`
+	Empty   string          `json:"empty,omitempty"`
+	Blob    []byte          `json:"blob"`
+	ByNum   map[int]string  `json:"by_num"`
+	Raw     json.RawMessage `json:"raw"`
+	Num     json.Number     `json:"num"`
+	Small   float32         `json:"small"`
+	Any     interface{}     `json:"any"`
+	hidden  string
+	codecBase
+	*codecExtra
+}
+
+type codecRec struct {
+	ID     int               `json:"id"`
+	Name   string            `json:"name"`
+	Long   string            `json:"long"`
+	Neg    int64             `json:"neg"`
+	Big    uint64            `json:"big"`
+	Ratio  float64           `json:"ratio"`
+	Flag   bool              `json:"flag"`
+	Tags   []string          `json:"tags"`
+	Attrs  map[string]int    `json:"attrs"`
+	Nested *codecRec         `json:"nested"`
+	Extra  map[string]string `json:"extra,omitempty"`
+}
+
+func TestCodecRoundTripTests(t *testing.T) {
+	want := codecRec{
+		ID:    7,
+		Name:  "Zoë\nline two",
+		Long:  strings.Repeat("long ", 70000),
+		Neg:   math.MinInt64,
+		Big:   math.MaxUint64,
+		Ratio: -2.5e-7,
+		Flag:  true,
+		Tags:  []string{"a", "", strings.Repeat("b", 40)},
+		Attrs: map[string]int{"x": -33, "y": 128, "z": 70000},
+		Nested: &codecRec{
+			ID:   -1,
+			Tags: make([]string, 20),
+		},
+	}
+
+	for _, codec := range []Codec{JSON, MessagePack, CBOR} {
+		data, err := codec.Marshal(&want)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got codecRec
+
+		if err := codec.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("%s: round trip does not match", codec.Name())
+		}
+	}
+}
+
+func TestCodecDecodeTests(t *testing.T) {
+	tests := []struct {
+		codec Codec
+		data  []byte
+		want  string
+	}{
+		{MessagePack, []byte{0x81, 0xa1, 'a', 0x01}, `{"a":1}`},
+		{MessagePack, []byte{0x93, 0xc0, 0xc2, 0xff}, `[null,false,-1]`},
+		{MessagePack, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, `1.5`},
+		{MessagePack, []byte{0xd1, 0xfc, 0x18}, `-1000`},
+		{CBOR, []byte{0xa2, 0x61, 'a', 0x01, 0x61, 'b', 0x82, 0x02, 0x03}, `{"a":1,"b":[2,3]}`},
+		{CBOR, []byte{0x19, 0x03, 0xe8}, `1000`},
+		{CBOR, []byte{0x39, 0x03, 0xe7}, `-1000`},
+		{CBOR, []byte{0xf9, 0x3c, 0x00}, `1`},
+		{CBOR, []byte{0xf9, 0xc4, 0x00}, `-4`},
+		{CBOR, []byte{0x9f, 0x01, 0x82, 0x02, 0x03, 0x9f, 0x04, 0x05, 0xff, 0xff}, `[1,[2,3],[4,5]]`},
+		{CBOR, []byte{0x7f, 0x62, 'h', 'a', 0x61, 'r', 0x61, 'e', 0xff}, `"hare"`},
+		{CBOR, []byte{0xc1, 0x1a, 0x51, 0x4b, 0x67, 0xb0}, `1363896240`},
+	}
+
+	for _, tt := range tests {
+		var got interface{}
+
+		if err := tt.codec.Unmarshal(tt.data, &got); err != nil {
+			t.Fatalf("%s %x: %v", tt.codec.Name(), tt.data, err)
+		}
+
+		want, err := JSON.Marshal(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tt.want != string(want) {
+			t.Errorf("%s %x: want %v; got %s", tt.codec.Name(), tt.data, tt.want, want)
+		}
+	}
+
+	for _, data := range [][]byte{{}, {0xa5, 'a'}, {0xc1}, {0x81, 0x01, 0x01}, {0x01, 0x02}} {
+		var got interface{}
+
+		if err := MessagePack.Unmarshal(data, &got); err == nil {
+			t.Errorf("msgpack %x: want an error", data)
+		}
+	}
+
+	for _, data := range [][]byte{{}, {0x65, 'a'}, {0x9f, 0x01}, {0xa1, 0x01, 0x01}, {0x1c}} {
+		var got interface{}
+
+		if err := CBOR.Unmarshal(data, &got); err == nil {
+			t.Errorf("cbor %x: want an error", data)
+		}
+	}
+}
+
+func TestCodecJSONRulesTests(t *testing.T) {
+	want := codecTagged{
+		ID:      3,
+		Shadow:  "outer",
+		Skipped: "skipped",
+		Dash:    "dash",
+		Plain:   "plain",
+		Count:   math.MaxInt64,
+		Blob:    []byte{0, 1, 254, 255},
+		ByNum:   map[int]string{-2: "a", 10: "b"},
+		Raw:     json.RawMessage(`{"a":[1,2]}`),
+		Num:     json.Number("12.5"),
+		Small:   0.1,
+		Any:     []interface{}{1.5, "x", map[string]interface{}{"y": true}},
+		hidden:  "hidden",
+		codecBase: codecBase{
+			Created: time.Date(2020, 5, 17, 8, 30, 0, 0, time.UTC),
+			Shadow:  "inner",
+		},
+	}
+
+	jsonData, err := json.Marshal(&want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wantDoc interface{}
+	if err := json.Unmarshal(jsonData, &wantDoc); err != nil {
+		t.Fatal(err)
+	}
+
+	var wantRec codecTagged
+	if err := json.Unmarshal(jsonData, &wantRec); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, codec := range []Codec{MessagePack, CBOR} {
+		data, err := codec.Marshal(&want)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var gotDoc interface{}
+		if err := codec.Unmarshal(data, &gotDoc); err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(wantDoc, gotDoc) {
+			t.Errorf("%s: want %v; got %v", codec.Name(), wantDoc, gotDoc)
+		}
+
+		var gotRec codecTagged
+		if err := codec.Unmarshal(data, &gotRec); err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(wantRec, gotRec) {
+			t.Errorf("%s: want %+v; got %+v", codec.Name(), wantRec, gotRec)
+		}
+
+		// A cyclic value and deeply nested data are refused rather than
+		// overflowing the stack.
+		node := &codecNode{}
+		node.Next = node
+
+		if _, err := codec.Marshal(node); !errors.Is(err, errNestedTooDeep) {
+			t.Errorf("%s: want %v; got %v", codec.Name(), errNestedTooDeep, err)
+		}
+
+		deep, err := codec.Marshal([]interface{}{nil})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		deep = append(bytes.Repeat(deep[:1], maxNesting), deep...)
+
+		if err := codec.Unmarshal(deep, &gotDoc); !errors.Is(err, errNestedTooDeep) {
+			t.Errorf("%s: want %v; got %v", codec.Name(), errNestedTooDeep, err)
+		}
+	}
+}
+
+func TestCodecDatabaseTests(t *testing.T) {
+	for _, codec := range []Codec{MessagePack, CBOR} {
+		testSetup(t)
+
+		ds, err := disk.New("./testdata", ".json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err := New(ds, WithCodec(codec))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.CreateTable("newtable"); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, c := range []Contact{{FirstName: "Robin", LastName: "Williams", Age: 88}, {FirstName: "Rex", LastName: "Stout\n", Age: 77}} {
+			if _, err := db.Insert("newtable", &c); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := db.Update("newtable", &Contact{ID: 1, FirstName: "Robin", LastName: "Hood", Age: 33}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// The codec is read from the table's header, so it does not
+		// need to be passed again.
+		ds, err = disk.New("./testdata", ".json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err = New(ds)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := Contact{}
+
+		if err := db.Find("newtable", 1, &c); err != nil {
+			t.Fatal(err)
+		}
+
+		want := Contact{ID: 1, FirstName: "Robin", LastName: "Hood", Age: 33}
+
+		if !reflect.DeepEqual(want, c) {
+			t.Errorf("%s: want %v; got %v", codec.Name(), want, c)
+		}
+
+		ids, err := db.Query("newtable").Where("age", ">", 50).IDs()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual([]int{2}, ids) {
+			t.Errorf("%s: want %v; got %v", codec.Name(), []int{2}, ids)
+		}
+
+		it, err := db.Iterate("newtable")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var gotRecs []string
+		for _, rawRec := range it.All() {
+			gotRecs = append(gotRecs, string(rawRec))
+		}
+
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		wantRecs := []string{
+			`{"age":33,"first_name":"Robin","id":1,"last_name":"Hood"}`,
+			`{"age":77,"first_name":"Rex","id":2,"last_name":"Stout\n"}`,
+		}
+
+		if !reflect.DeepEqual(wantRecs, gotRecs) {
+			t.Errorf("%s: want %v; got %v", codec.Name(), wantRecs, gotRecs)
+		}
+
+		// Json tables are still json.
+		if err := db.Find("contacts", 1, &c); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		testTeardown(t)
+	}
+}
+
+func TestUnknownCodecTests(t *testing.T) {
+	testSetup(t)
+	defer testTeardown(t)
+
+	ds, err := disk.New("./testdata", ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ds.CreateTableWithMeta("newtable", map[string]string{"codec": "gob", "frames": "binary"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = New(ds)
+	checkErr(t, dberr.ErrUnknownCodec, err)
+
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func BenchmarkCodecs(b *testing.B) {
+	rec := codecRec{
+		ID:    7,
+		Name:  "Robin Williams",
+		Long:  strings.Repeat("long ", 20),
+		Neg:   -33,
+		Big:   math.MaxUint32,
+		Ratio: 0.25,
+		Flag:  true,
+		Tags:  []string{"actor", "comedian"},
+		Attrs: map[string]int{"x": 1, "y": 2},
+	}
+
+	for _, codec := range []Codec{JSON, MessagePack, CBOR} {
+		data, err := codec.Marshal(&rec)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(codec.Name()+"/Marshal", func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := codec.Marshal(&rec); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(codec.Name()+"/Unmarshal", func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				var got codecRec
+
+				if err := codec.Unmarshal(data, &got); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package hare
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// Most Database methods have a variant whose name ends in Ctx and that
+// takes a context.Context first.  The variant gives up waiting for the
+// table lock when the context is done, and stops scans of the table
+// partway through, returning the context's error wrapped in
+// dberr.ErrCanceled:
+//
+//	err := db.FindCtx(r.Context(), "contacts", 1, &c)
+//	if errors.Is(err, dberr.ErrCanceled) {
+//		...
+//	}
+//
+// The methods without a context wait as long as it takes.
+
+// ctxErr takes a context and returns its error wrapped in
+// dberr.ErrCanceled, or nil if the context is not done.
+func ctxErr(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%w: %w", dberr.ErrCanceled, err)
+	}
+
+	return nil
+}
+
+// lockCtx takes a context and the lock, try lock, and unlock functions
+// of a mutex, and takes the lock, giving up if the context is done
+// first.  A lock that is taken after the context is done is released
+// again at once.
+func lockCtx(ctx context.Context, lock func(), tryLock func() bool, unlock func()) error {
+	if err := ctxErr(ctx); err != nil {
+		return err
+	}
+
+	if tryLock() {
+		return nil
+	}
+
+	if ctx.Done() == nil {
+		lock()
+		return nil
+	}
+
+	locked := make(chan struct{})
+
+	go func() {
+		lock()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		return nil
+	case <-ctx.Done():
+		go func() {
+			<-locked
+			unlock()
+		}()
+
+		return ctxErr(ctx)
+	}
+}
+
+// lockTable takes a context and a table name and takes the table's write
+// lock, giving up if the context is done first, or if the table is
+// dropped or the database closed while waiting.  It returns a function
+// that releases the lock.
+func (db *Database) lockTable(ctx context.Context, tableName string) (func(), error) {
+	tbl, ok := db.table(tableName)
+	if !ok {
+		return nil, dberr.ErrNoTable
+	}
+
+	lock := &tbl.lock
+
+	if err := lockCtx(ctx, lock.Lock, lock.TryLock, lock.Unlock); err != nil {
+		return nil, err
+	}
+
+	if tbl.removed != nil {
+		lock.Unlock()
+		return nil, tbl.removed
+	}
+
+	return lock.Unlock, nil
+}
+
+// rlockTable takes a context and a table name and takes the table's read
+// lock, giving up if the context is done first, or if the table is
+// dropped or the database closed while waiting.  It returns a function
+// that releases the lock.
+func (db *Database) rlockTable(ctx context.Context, tableName string) (func(), error) {
+	tbl, ok := db.table(tableName)
+	if !ok {
+		return nil, dberr.ErrNoTable
+	}
+
+	lock := &tbl.lock
+
+	if err := lockCtx(ctx, lock.RLock, lock.TryRLock, lock.RUnlock); err != nil {
+		return nil, err
+	}
+
+	if tbl.removed != nil {
+		lock.RUnlock()
+		return nil, tbl.removed
+	}
+
+	return lock.RUnlock, nil
+}
+
+// lockMutex takes a context and a mutex and takes the mutex, giving up
+// if the context is done first.
+func lockMutex(ctx context.Context, mu *sync.Mutex) error {
+	return lockCtx(ctx, mu.Lock, mu.TryLock, mu.Unlock)
+}
@@ -0,0 +1,138 @@
+package hare
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func checkCtxErr(t *testing.T, wantErr error, gotErr error) {
+	t.Helper()
+
+	if !errors.Is(gotErr, dberr.ErrCanceled) || !errors.Is(gotErr, wantErr) {
+		t.Errorf("want %v and %v; got %v", dberr.ErrCanceled, wantErr, gotErr)
+	}
+}
+
+func TestContextTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//FindCtx...
+
+			return func(t *testing.T) {
+				c := Contact{}
+				if err := db.FindCtx(context.Background(), "contacts", 1, &c); err != nil {
+					t.Fatal(err)
+				}
+
+				if c.FirstName != "John" {
+					t.Errorf("want %v; got %v", "John", c.FirstName)
+				}
+
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				checkCtxErr(t, context.Canceled, db.FindCtx(ctx, "contacts", 1, &c))
+				checkErr(t, dberr.ErrNoTable, db.FindCtx(context.Background(), "nonexistent", 1, &c))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Lock timeouts...
+
+			return func(t *testing.T) {
+				tx, err := db.Begin()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Delete("contacts", 2); err != nil {
+					t.Fatal(err)
+				}
+
+				tbl, _ := db.table("contacts")
+				tbl.lock.Lock()
+
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				defer cancel()
+
+				c := Contact{}
+				checkCtxErr(t, context.DeadlineExceeded, db.FindCtx(ctx, "contacts", 1, &c))
+
+				_, err = db.InsertCtx(ctx, "contacts", &Contact{FirstName: "Robin"})
+				checkCtxErr(t, context.DeadlineExceeded, err)
+
+				_, err = db.QueryCtx(ctx, "contacts").IDs()
+				checkCtxErr(t, context.DeadlineExceeded, err)
+
+				checkCtxErr(t, context.DeadlineExceeded, tx.CommitCtx(ctx))
+
+				tbl.lock.Unlock()
+
+				// Locks taken after giving up are given back, so the
+				// table can still be written.
+				if _, err := db.Insert("contacts", &Contact{FirstName: "Robin"}); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.Find("contacts", 2, &c); err != nil {
+					t.Fatal(err)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//IterateCtx...
+
+			return func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+
+				it, err := db.IterateCtx(ctx, "contacts")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !it.Next() {
+					t.Fatal(it.Err())
+				}
+
+				cancel()
+
+				if it.Next() {
+					t.Errorf("want %v; got %v", false, true)
+				}
+
+				checkCtxErr(t, context.Canceled, it.Err())
+
+				// The iterator gave back the read lock when it stopped.
+				if err := db.Delete("contacts", 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//CloseCtx...
+
+			return func(t *testing.T) {
+				tbl, _ := db.table("contacts")
+				tbl.lock.RLock()
+
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				defer cancel()
+
+				checkCtxErr(t, context.DeadlineExceeded, db.CloseCtx(ctx))
+
+				tbl.lock.RUnlock()
+
+				// The database is still open.
+				c := Contact{}
+				if err := db.Find("contacts", 1, &c); err != nil {
+					t.Fatal(err)
+				}
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
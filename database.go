@@ -3,18 +3,23 @@
 package hare
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"sync"
 
 	"github.com/jameycribbs/hare/dberr"
+	"github.com/jameycribbs/hare/keys"
 )
 
-// Record interface defines the methods a struct representing
-// a table record must implement.
+// Record interface defines the methods a struct representing a table
+// record can implement to get and set its id.  Structs that do not
+// implement it need an integer field tagged `json:"id"`, or named ID,
+// which is found by reflection.
 type Record interface {
 	SetID(int)
 	GetID() int
-	AfterFind(*Database) error
 }
 
 type datastorage interface {
@@ -31,153 +36,361 @@ type datastorage interface {
 	UpdateRec(string, int, []byte) error
 }
 
+// compacter is implemented by datastores that leave dead space behind
+// when records are updated or deleted and can reclaim it.
+type compacter interface {
+	Compact(string) error
+}
+
+// metaStorer is implemented by datastores that keep settings for each
+// table, like the codec its records are encoded with.
+type metaStorer interface {
+	CreateTableWithMeta(string, map[string]string) error
+	TableMeta(string) (map[string]string, error)
+}
+
+// fileOrderer is implemented by datastores that can list a table's ids
+// in the order the records are stored.
+type fileOrderer interface {
+	IDsInFileOrder(string) ([]int, error)
+}
+
+// indexStorer is implemented by datastores that can save a table's
+// field indexes next to the table and tell, when loading them, whether
+// the table has been written to since.
+type indexStorer interface {
+	LoadFieldIndexes(string) ([]byte, error)
+	SaveFieldIndexes(string, []byte) error
+}
+
+// sequencer is implemented by datastores that keep, for each table, the
+// greatest id ever written to it, so the ids of deleted records are not
+// handed out again.
+type sequencer interface {
+	Sequence(string) (int, error)
+	SetSequence(string, int) error
+}
+
 // Database struct is the main struct for the Hare package.
 type Database struct {
-	store   datastorage
-	locks   map[string]*sync.RWMutex
-	lastIDs map[string]int
+	store  datastorage
+	txLock sync.Mutex
+
+	tablesLock sync.RWMutex
+	tables     map[string]*tableState
+	closed     bool
+	createLock sync.Mutex
+	readOnly   bool
+
+	codec  Codec
+	codecs map[string]Codec
+
+	persistIndexes bool
+
+	watchLock sync.Mutex
+	watchers  map[*Watcher]struct{}
+	watchSeq  uint64
 }
 
-// New takes a datastorage and returns a pointer to a
+// New takes a datastorage and any options and returns a pointer to a
 // Database struct.
-func New(ds datastorage) (*Database, error) {
+func New(ds datastorage, opts ...Option) (*Database, error) {
 	db := &Database{store: ds}
-	db.locks = make(map[string]*sync.RWMutex)
-	db.lastIDs = make(map[string]int)
+	db.tables = make(map[string]*tableState)
+	db.codec = JSON
+	db.codecs = map[string]Codec{JSON.Name(): JSON, MessagePack.Name(): MessagePack, CBOR.Name(): CBOR}
+	db.watchers = make(map[*Watcher]struct{})
+
+	for _, opt := range opts {
+		opt(db)
+	}
+
+	if store, ok := db.store.(readOnlyStore); ok && store.ReadOnly() {
+		db.readOnly = true
+	}
 
 	for _, tableName := range db.store.TableNames() {
-		db.locks[tableName] = &sync.RWMutex{}
+		codec, err := db.loadCodec(tableName)
+		if err != nil {
+			return nil, err
+		}
 
-		lastID, err := db.store.GetLastID(tableName)
+		keyType, err := db.loadKeyType(tableName)
 		if err != nil {
 			return nil, err
 		}
-		db.lastIDs[tableName] = lastID
+
+		if err := db.addTable(tableName, codec, keyType); err != nil {
+			return nil, err
+		}
 	}
 
 	return db, nil
 }
 
-// Close closes the associated datastore.
+// Close closes the associated datastore.  It waits for the methods
+// using a table to finish, and once it returns, every method returns
+// dberr.ErrNoTable, or dberr.ErrClosed if it is not about one table.
 func (db *Database) Close() error {
-	for _, lock := range db.locks {
-		lock.Lock()
+	return db.CloseCtx(context.Background())
+}
+
+// CloseCtx is Close with a context for waiting on the table locks.  If
+// the context is done before every lock is taken, the database is left
+// open.
+func (db *Database) CloseCtx(ctx context.Context) error {
+	db.tablesLock.Lock()
+
+	if db.closed {
+		db.tablesLock.Unlock()
+		return dberr.ErrClosed
+	}
+
+	// No tables can be created from here on, so the ones locked below
+	// are all of them.
+	db.closed = true
+
+	db.tablesLock.Unlock()
+
+	reopen := func(unlocks []func()) {
+		for _, unlock := range unlocks {
+			unlock()
+		}
+
+		db.tablesLock.Lock()
+		db.closed = false
+		db.tablesLock.Unlock()
+	}
+
+	tableNames := db.tableNames()
+	unlocks := make([]func(), 0, len(tableNames))
+
+	for _, tableName := range tableNames {
+		unlock, err := db.lockTable(ctx, tableName)
+		if err != nil {
+			reopen(unlocks)
+			return err
+		}
+
+		unlocks = append(unlocks, unlock)
+	}
+
+	db.closeWatchers()
+
+	if err := db.saveIndexes(tableNames); err != nil {
+		reopen(unlocks)
+		return err
 	}
 
 	if err := db.store.Close(); err != nil {
+		reopen(unlocks)
 		return err
 	}
 
-	for _, lock := range db.locks {
-		lock.Unlock()
+	for _, tableName := range tableNames {
+		tbl, _ := db.table(tableName)
+		tbl.removed = dberr.ErrClosed
 	}
 
-	db.store = nil
-	db.locks = nil
-	db.lastIDs = nil
+	db.tablesLock.Lock()
+	db.tables = nil
+	db.tablesLock.Unlock()
+
+	for _, unlock := range unlocks {
+		unlock()
+	}
 
 	return nil
 }
 
+// Compact takes a table name and, while holding the table lock, has the
+// datastore reclaim the space left behind by updated and deleted
+// records.  It does nothing for datastores, like Ram, that do not leave
+// any behind.
+func (db *Database) Compact(tableName string) error {
+	return db.CompactCtx(context.Background(), tableName)
+}
+
+// CompactCtx is Compact with a context for waiting on the table lock.
+func (db *Database) CompactCtx(ctx context.Context, tableName string) error {
+	if err := db.checkWritable(); err != nil {
+		return err
+	}
+
+	if !db.TableExists(tableName) {
+		return dberr.ErrNoTable
+	}
+
+	unlock, err := db.lockTable(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	store, ok := db.store.(compacter)
+	if !ok {
+		return nil
+	}
+
+	return store.Compact(tableName)
+}
+
 // CreateTable takes a table name and creates and
 // initializes a new table.
 func (db *Database) CreateTable(tableName string) error {
-	if db.TableExists(tableName) {
-		return dberr.ErrTableExists
+	if err := db.checkWritable(); err != nil {
+		return err
 	}
 
-	if err := db.store.CreateTable(tableName); err != nil {
-		return nil
+	if err := db.checkOpen(); err != nil {
+		return err
 	}
 
-	db.locks[tableName] = &sync.RWMutex{}
+	db.createLock.Lock()
+	defer db.createLock.Unlock()
 
-	lastID, err := db.store.GetLastID(tableName)
-	if err != nil {
+	if db.TableExists(tableName) {
+		return dberr.ErrTableExists
+	}
+
+	if err := db.createTable(tableName, keys.Int); err != nil {
 		return err
 	}
-	db.lastIDs[tableName] = lastID
 
-	return nil
+	return db.registerTable(tableName, keys.Int)
 }
 
 // Delete takes a table name and record id and removes that
 // record from the database.
 func (db *Database) Delete(tableName string, id int) error {
+	return db.DeleteCtx(context.Background(), tableName, id)
+}
+
+// DeleteCtx is Delete with a context for waiting on the table lock.
+func (db *Database) DeleteCtx(ctx context.Context, tableName string, id int) error {
+	return db.deleteID(ctx, tableName, id, "")
+}
+
+// DeleteRecord takes a table name and a pointer to a record struct and
+// removes the record with that record's id, or key, from the table.  The
+// struct is filled in with the stored record first, so its BeforeDelete
+// and AfterDelete hooks see what is being deleted.
+func (db *Database) DeleteRecord(tableName string, rec interface{}) error {
+	return db.DeleteRecordCtx(context.Background(), tableName, rec)
+}
+
+// DeleteRecordCtx is DeleteRecord with a context for waiting on the
+// table lock.
+func (db *Database) DeleteRecordCtx(ctx context.Context, tableName string, rec interface{}) error {
 	if !db.TableExists(tableName) {
 		return dberr.ErrNoTable
 	}
 
-	db.locks[tableName].Lock()
-	defer db.locks[tableName].Unlock()
-
-	if err := db.store.DeleteRec(tableName, id); err != nil {
+	id, key, err := db.recID(tableName, rec)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return db.deleteRecord(ctx, tableName, id, key, rec)
 }
 
 // DropTable takes a table name and deletes the table.
 func (db *Database) DropTable(tableName string) error {
+	return db.DropTableCtx(context.Background(), tableName)
+}
+
+// DropTableCtx is DropTable with a context for waiting on the table
+// lock.
+func (db *Database) DropTableCtx(ctx context.Context, tableName string) error {
+	if err := db.checkWritable(); err != nil {
+		return err
+	}
+
 	if !db.TableExists(tableName) {
 		return dberr.ErrNoTable
 	}
 
-	db.locks[tableName].Lock()
+	unlock, err := db.lockTable(ctx, tableName)
+	if err != nil {
+		return err
+	}
 
 	if err := db.store.RemoveTable(tableName); err != nil {
-		db.locks[tableName].Unlock()
+		unlock()
 		return err
 	}
 
-	delete(db.lastIDs, tableName)
+	tbl, _ := db.table(tableName)
+	db.removeTable(tableName, tbl, dberr.ErrNoTable)
 
-	db.locks[tableName].Unlock()
+	db.publish(EventDropTable, tableName, 0, nil, nil)
 
-	delete(db.locks, tableName)
+	unlock()
 
 	return nil
 }
 
-// Find takes a table name, a record id, and a pointer to a struct that
-// implements the Record interface, finds the associated record from the
-// table, and populates the struct.
-func (db *Database) Find(tableName string, id int, rec Record) error {
+// Find takes a table name, a record id, and a pointer to a struct,
+// finds the associated record from the table, and populates the struct.
+// If the struct has an AfterFind method, it is run afterwards.
+func (db *Database) Find(tableName string, id int, rec interface{}) error {
+	return db.FindCtx(context.Background(), tableName, id, rec)
+}
+
+// FindCtx is Find with a context for waiting on the table lock.
+func (db *Database) FindCtx(ctx context.Context, tableName string, id int, rec interface{}) error {
+	return db.find(ctx, tableName, id, "", rec)
+}
+
+// FindRaw takes a table name and a record id and returns the record as
+// json.  Records stored with another codec are converted to json.
+func (db *Database) FindRaw(tableName string, id int) (json.RawMessage, error) {
+	return db.FindRawCtx(context.Background(), tableName, id)
+}
+
+// FindRawCtx is FindRaw with a context for waiting on the table lock.
+func (db *Database) FindRawCtx(ctx context.Context, tableName string, id int) (json.RawMessage, error) {
 	if !db.TableExists(tableName) {
-		return dberr.ErrNoTable
+		return nil, dberr.ErrNoTable
 	}
 
-	db.locks[tableName].RLock()
-	defer db.locks[tableName].RUnlock()
-
-	rawRec, err := db.store.ReadRec(tableName, id)
+	unlock, err := db.rlockTable(ctx, tableName)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer unlock()
 
-	err = json.Unmarshal(rawRec, rec)
+	rawRec, err := db.store.ReadRec(tableName, id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = rec.AfterFind(db)
+	jsonRec, err := db.toJSON(tableName, rawRec)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return json.RawMessage(bytes.TrimSuffix(jsonRec, []byte{'\n'})), nil
 }
 
 // IDs takes a table name and returns a list of all record ids for
-// that table.
+// that table.  In a table with string keys, they are the ids the keys
+// are stored under; use Keys to get the keys.
 func (db *Database) IDs(tableName string) ([]int, error) {
+	return db.IDsCtx(context.Background(), tableName)
+}
+
+// IDsCtx is IDs with a context for waiting on the table lock.
+func (db *Database) IDsCtx(ctx context.Context, tableName string) ([]int, error) {
 	if !db.TableExists(tableName) {
 		return nil, dberr.ErrNoTable
 	}
 
-	db.locks[tableName].Lock()
-	defer db.locks[tableName].Unlock()
+	unlock, err := db.lockTable(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	ids, err := db.store.IDs(tableName)
 	if err != nil {
@@ -187,84 +400,561 @@ func (db *Database) IDs(tableName string) ([]int, error) {
 	return ids, err
 }
 
-// Insert takes a table name and a struct that implements the Record
-// interface and adds a new record to the table.  It returns the
-// new record's id.
-func (db *Database) Insert(tableName string, rec Record) (int, error) {
+// Insert takes a table name and a pointer to a record struct and adds a
+// new record to the table.  It returns the new record's id.  In a table
+// with string keys, the record's key is generated if the table's key
+// type calls for it, and the id returned is the one the key is stored
+// under; use InsertKey to get the key instead.
+func (db *Database) Insert(tableName string, rec interface{}) (int, error) {
+	return db.InsertCtx(context.Background(), tableName, rec)
+}
+
+// InsertCtx is Insert with a context for waiting on the table lock.
+func (db *Database) InsertCtx(ctx context.Context, tableName string, rec interface{}) (int, error) {
+	if err := db.checkWritable(); err != nil {
+		return 0, err
+	}
+
 	if !db.TableExists(tableName) {
 		return 0, dberr.ErrNoTable
 	}
 
-	db.locks[tableName].Lock()
-	defer db.locks[tableName].Unlock()
-
-	id := db.incrementLastID(tableName)
-	rec.SetID(id)
+	unlock, err := db.lockTable(ctx, tableName)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
 
-	rawRec, err := json.Marshal(rec)
+	id, err := db.assignID(tableName, rec)
 	if err != nil {
 		return 0, err
 	}
 
-	if err := db.store.InsertRec(tableName, id, rawRec); err != nil {
+	if err := db.beforeInsert(rec); err != nil {
+		db.releaseID(tableName, id)
 		return 0, err
 	}
 
+	if err := db.writeInsert(tableName, id, rec); err != nil {
+		db.releaseID(tableName, id)
+		return 0, err
+	}
+
+	if err := db.afterInsert(rec); err != nil {
+		return id, err
+	}
+
 	return id, nil
 }
 
+// InsertWithID takes a table name and a pointer to a record struct and
+// adds the record to the table under the id it already has, instead of
+// handing out a new one, which is what imports that have to keep their
+// ids need.  The table's sequence is moved forward past the id if it is
+// not there yet.  It returns dberr.ErrIDExists if the table already
+// holds a record with that id.
+func (db *Database) InsertWithID(tableName string, rec interface{}) error {
+	return db.InsertWithIDCtx(context.Background(), tableName, rec)
+}
+
+// InsertWithIDCtx is InsertWithID with a context for waiting on the
+// table lock.
+func (db *Database) InsertWithIDCtx(ctx context.Context, tableName string, rec interface{}) error {
+	if err := db.checkWritable(); err != nil {
+		return err
+	}
+
+	if !db.TableExists(tableName) {
+		return dberr.ErrNoTable
+	}
+
+	if db.keyType(tableName) != keys.Int {
+		return dberr.ErrKeyType
+	}
+
+	unlock, err := db.lockTable(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	id, err := recID(rec)
+	if err != nil {
+		return err
+	}
+
+	if id <= 0 {
+		return dberr.ErrInvalidID
+	}
+
+	if err := db.beforeInsert(rec); err != nil {
+		return err
+	}
+
+	if err := db.writeInsert(tableName, id, rec); err != nil {
+		return err
+	}
+
+	db.advanceLastID(tableName, id)
+
+	return db.afterInsert(rec)
+}
+
+// SetSequence takes a table name and a record id and moves the table's
+// sequence forward to that id, so the next record inserted gets the id
+// after it.  It is meant for imports that bring their own ids.  It
+// returns dberr.ErrSequenceTooLow if a greater id has already been
+// handed out.  Datastores that keep a sequence, like Disk, save it with
+// the table.
+func (db *Database) SetSequence(tableName string, seq int) error {
+	return db.SetSequenceCtx(context.Background(), tableName, seq)
+}
+
+// SetSequenceCtx is SetSequence with a context for waiting on the table
+// lock.
+func (db *Database) SetSequenceCtx(ctx context.Context, tableName string, seq int) error {
+	if err := db.checkWritable(); err != nil {
+		return err
+	}
+
+	if !db.TableExists(tableName) {
+		return dberr.ErrNoTable
+	}
+
+	if db.keyType(tableName) != keys.Int {
+		return dberr.ErrKeyType
+	}
+
+	unlock, err := db.lockTable(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tbl, _ := db.table(tableName)
+
+	if seq < tbl.lastID {
+		return dberr.ErrSequenceTooLow
+	}
+
+	if store, ok := db.store.(sequencer); ok {
+		if err := store.SetSequence(tableName, seq); err != nil {
+			return err
+		}
+	}
+
+	tbl.lastID = seq
+
+	return nil
+}
+
 // TableExists takes a table name and returns true if the table exists,
 // false if it does not.
 func (db *Database) TableExists(tableName string) bool {
 	return db.tableExists(tableName) && db.store.TableExists(tableName)
 }
 
-// Update takes a table name and a struct that implements the Record
-// interface and updates the record in the table that has that record's
+// Update takes a table name and a pointer to a record struct and updates
+// the record in the table that has that record's id, or key.
+func (db *Database) Update(tableName string, rec interface{}) error {
+	return db.UpdateCtx(context.Background(), tableName, rec)
+}
+
+// UpdateCtx is Update with a context for waiting on the table lock.
+func (db *Database) UpdateCtx(ctx context.Context, tableName string, rec interface{}) error {
+	if err := db.checkWritable(); err != nil {
+		return err
+	}
+
+	if !db.TableExists(tableName) {
+		return dberr.ErrNoTable
+	}
+
+	unlock, err := db.lockTable(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	id, key, err := db.recID(tableName, rec)
+	if err != nil {
+		return err
+	}
+
+	if err := db.checkKey(tableName, id, key); err != nil {
+		return err
+	}
+
+	if err := db.beforeUpdate(rec); err != nil {
+		return err
+	}
+
+	if err := db.writeUpdate(tableName, id, rec); err != nil {
+		return err
+	}
+
+	return db.afterUpdate(rec)
+}
+
+// Upsert takes a table name and a pointer to a record struct and, while
+// holding the table lock, replaces the record in the table that has that
+// record's id, or key, or adds the record if there is none.  A record
+// without an id gets a new one, as with Insert.  The record's insert or
+// update hooks run, depending on which it was.  It returns the record's
+// id.
+func (db *Database) Upsert(tableName string, rec interface{}) (int, error) {
+	return db.UpsertCtx(context.Background(), tableName, rec)
+}
+
+// UpsertCtx is Upsert with a context for waiting on the table lock.
+func (db *Database) UpsertCtx(ctx context.Context, tableName string, rec interface{}) (int, error) {
+	if err := db.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	if !db.TableExists(tableName) {
+		return 0, dberr.ErrNoTable
+	}
+
+	unlock, err := db.lockTable(ctx, tableName)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	// In a table with string keys, assignID keeps the record's key and
+	// only generates one if the record has none.  In a table with int
+	// ids, a record without an id is always new.
+	keyed := db.keyType(tableName) != keys.Int
+
+	var id int
+	var key string
+
+	if keyed {
+		if id, err = db.assignID(tableName, rec); err == nil {
+			key, err = recKey(rec)
+		}
+	} else {
+		id, err = recID(rec)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	assigned := false
+	if id == 0 && !keyed {
+		if id, err = db.assignID(tableName, rec); err != nil {
+			return 0, err
+		}
+
+		assigned = true
+	}
+
+	if id < 0 {
+		return 0, dberr.ErrInvalidID
+	}
+
+	if !assigned {
+		rawRec, err := db.store.ReadRec(tableName, id)
+		if err == nil {
+			// Another key is stored under the same id, so the record
+			// can neither replace it nor be added.
+			if db.matchKey(tableName, rawRec, key) != nil {
+				return 0, dberr.ErrIDExists
+			}
+
+			if err := db.beforeUpdate(rec); err != nil {
+				return 0, err
+			}
+
+			if err := db.writeUpdate(tableName, id, rec); err != nil {
+				return 0, err
+			}
+
+			return id, db.afterUpdate(rec)
+		}
+
+		if !errors.Is(err, dberr.ErrNoRecord) {
+			return 0, err
+		}
+	}
+
+	if err := db.beforeInsert(rec); err != nil {
+		if assigned {
+			db.releaseID(tableName, id)
+		}
+		return 0, err
+	}
+
+	if err := db.writeInsert(tableName, id, rec); err != nil {
+		if assigned {
+			db.releaseID(tableName, id)
+		}
+		return 0, err
+	}
+
+	if !keyed {
+		db.advanceLastID(tableName, id)
+	}
+
+	return id, db.afterInsert(rec)
+}
+
+// unexported methods
+
+// createTable takes a table name and a key type and creates the table
+// in the datastore, recording the codec in the table's settings when it
+// is not json, and the key type when it is not int.
+func (db *Database) createTable(tableName string, keyType keys.Type) error {
+	meta := make(map[string]string)
+
+	if db.codec != JSON {
+		meta["codec"] = db.codec.Name()
+		meta["frames"] = "binary"
+	}
+
+	if keyType != keys.Int {
+		meta["key"] = string(keyType)
+	}
+
+	store, ok := db.store.(metaStorer)
+	if !ok && keyType != keys.Int {
+		return dberr.ErrKeyType
+	}
+
+	if !ok || len(meta) == 0 {
+		return db.store.CreateTable(tableName)
+	}
+
+	return store.CreateTableWithMeta(tableName, meta)
+}
+
+// deleteID takes a context, a table name, a record id, and the key the
+// id was made from, or an empty key, and deletes the record with that
 // id.
-func (db *Database) Update(tableName string, rec Record) error {
+func (db *Database) deleteID(ctx context.Context, tableName string, id int, key string) error {
+	if err := db.checkWritable(); err != nil {
+		return err
+	}
+
 	if !db.TableExists(tableName) {
 		return dberr.ErrNoTable
 	}
 
-	db.locks[tableName].Lock()
-	defer db.locks[tableName].Unlock()
+	unlock, err := db.lockTable(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	id := rec.GetID()
+	if err := db.checkKey(tableName, id, key); err != nil {
+		return err
+	}
+
+	oldRaw := db.watchedRec(tableName, id)
 
-	rawRec, err := json.Marshal(rec)
+	if err := db.store.DeleteRec(tableName, id); err != nil {
+		return err
+	}
+
+	db.unindexRec(tableName, id)
+
+	db.publish(EventDelete, tableName, id, oldRaw, nil)
+
+	return nil
+}
+
+// deleteRecord takes a context, a table name, a record id, the key the
+// id was made from, or an empty key, and a pointer to a record struct,
+// fills in the struct with the stored record, and deletes it, running
+// the record's delete hooks.
+func (db *Database) deleteRecord(ctx context.Context, tableName string, id int, key string, rec interface{}) error {
+	if err := db.checkWritable(); err != nil {
+		return err
+	}
+
+	unlock, err := db.lockTable(ctx, tableName)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	if err := db.store.UpdateRec(tableName, id, rawRec); err != nil {
+	rawRec, err := db.store.ReadRec(tableName, id)
+	if err != nil {
+		return err
+	}
+
+	if err := db.matchKey(tableName, rawRec, key); err != nil {
+		return err
+	}
+
+	if err := db.codecFor(tableName).Unmarshal(rawRec, rec); err != nil {
+		return err
+	}
+
+	if err := db.beforeDelete(rec); err != nil {
+		return err
+	}
+
+	if err := db.store.DeleteRec(tableName, id); err != nil {
+		return err
+	}
+
+	db.unindexRec(tableName, id)
+
+	db.publish(EventDelete, tableName, id, rawRec, nil)
+
+	return db.afterDelete(rec)
+}
+
+// find takes a context, a table name, a record id, the key the id was
+// made from, or an empty key, and a pointer to a struct, and populates
+// the struct with the record.
+func (db *Database) find(ctx context.Context, tableName string, id int, key string, rec interface{}) error {
+	if !db.TableExists(tableName) {
+		return dberr.ErrNoTable
+	}
+
+	unlock, err := db.rlockTable(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	rawRec, err := db.store.ReadRec(tableName, id)
+	if err != nil {
+		return err
+	}
+
+	if err := db.matchKey(tableName, rawRec, key); err != nil {
+		return err
+	}
+
+	err = db.codecFor(tableName).Unmarshal(rawRec, rec)
+	if err != nil {
+		return err
+	}
+
+	err = db.afterFind(rec)
+	if err != nil {
 		return err
 	}
 
 	return nil
 }
 
-// unexported methods
+// registerTable takes the name and key type of a table that was just
+// created in the datastore and sets up the database to use it.
+func (db *Database) registerTable(tableName string, keyType keys.Type) error {
+	if err := db.addTable(tableName, db.codec, keyType); err != nil {
+		return err
+	}
+
+	db.publish(EventCreateTable, tableName, 0, nil, nil)
+
+	return nil
+}
+
+// loadLastID takes a table name and returns the last id handed out for
+// the table, which is the datastore's sequence, if it keeps one, or else
+// the greatest id in the table.
+func (db *Database) loadLastID(tableName string) (int, error) {
+	lastID, err := db.store.GetLastID(tableName)
+	if err != nil {
+		return 0, err
+	}
+
+	if store, ok := db.store.(sequencer); ok {
+		seq, err := store.Sequence(tableName)
+		if err != nil {
+			return 0, err
+		}
+
+		if seq > lastID {
+			lastID = seq
+		}
+	}
+
+	return lastID, nil
+}
+
+// advanceLastID takes a table name and the id of a record that was
+// written with an id it already had, and makes sure that id is not handed
+// out again.  It expects the caller to hold the table lock.
+func (db *Database) advanceLastID(tableName string, id int) {
+	tbl, _ := db.table(tableName)
+
+	if id > tbl.lastID {
+		tbl.lastID = id
+	}
+}
 
 func (db *Database) incrementLastID(tableName string) int {
-	lastID := db.lastIDs[tableName]
+	tbl, _ := db.table(tableName)
+
+	tbl.lastID++
+
+	return tbl.lastID
+}
+
+// writeInsert takes a table name, a record id, and a pointer to a record
+// struct whose before hooks have run, and adds the record to the table
+// under that id, as the first version of the record if it is versioned.
+// If the record cannot be indexed, it is removed from the table again,
+// so a failed insert leaves nothing behind.  It expects the caller to
+// hold the table lock.
+func (db *Database) writeInsert(tableName string, id int, rec interface{}) error {
+	firstVersion(rec)
 
-	lastID++
+	rawRec, err := db.codecFor(tableName).Marshal(rec)
+	if err != nil {
+		return err
+	}
 
-	db.lastIDs[tableName] = lastID
+	if err := db.store.InsertRec(tableName, id, rawRec); err != nil {
+		return err
+	}
 
-	return lastID
+	if err := db.indexRec(tableName, id, rawRec); err != nil {
+		db.unindexRec(tableName, id)
+
+		if deleteErr := db.store.DeleteRec(tableName, id); deleteErr != nil {
+			return deleteErr
+		}
+
+		return err
+	}
+
+	db.publish(EventInsert, tableName, id, nil, rawRec)
+
+	return nil
 }
 
-func (db *Database) tableExists(tableName string) bool {
-	_, ok := db.locks[tableName]
-	if !ok {
-		return false
+// writeUpdate takes a table name, a record id, and a pointer to a record
+// struct whose before hooks have run, and replaces the record in the
+// table that has that id, as its next version if it is versioned.  It
+// expects the caller to hold the table lock.
+func (db *Database) writeUpdate(tableName string, id int, rec interface{}) error {
+	if err := db.nextVersion(tableName, id, rec); err != nil {
+		return err
 	}
-	_, ok = db.lastIDs[tableName]
-	if !ok {
-		return false
+
+	rawRec, err := db.codecFor(tableName).Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	oldRaw := db.watchedRec(tableName, id)
+
+	if err := db.store.UpdateRec(tableName, id, rawRec); err != nil {
+		return err
+	}
+
+	if err := db.indexRec(tableName, id, rawRec); err != nil {
+		return err
 	}
 
-	return ok
+	db.publish(EventUpdate, tableName, id, oldRaw, rawRec)
+
+	return nil
 }
@@ -2,6 +2,7 @@ package hare
 
 import (
 	"fmt"
+	"reflect"
 	"sort"
 	"strconv"
 	"testing"
@@ -11,6 +12,13 @@ import (
 	"github.com/jameycribbs/hare/dberr"
 )
 
+// nestedContact is a contact with an extra field that can hold any
+// value, so tests can store records json cannot handle.
+type nestedContact struct {
+	Contact
+	Extra interface{} `json:"extra"`
+}
+
 func TestCloseDatabaseTests(t *testing.T) {
 	var tests = []func(t *testing.T){
 		func(t *testing.T) {
@@ -28,20 +36,12 @@ func TestCloseDatabaseTests(t *testing.T) {
 			db.Close()
 
 			checkErr(t, dberr.ErrNoTable, db.Find("contacts", 3, &Contact{}))
+			checkErr(t, dberr.ErrClosed, db.CreateTable("newtable"))
+			checkErr(t, dberr.ErrClosed, db.Close())
 
-			gotStore := db.store
-			if nil != gotStore {
-				t.Errorf("want %v; got %v", nil, gotStore)
-			}
-
-			gotLocks := db.locks
-			if nil != gotLocks {
-				t.Errorf("want %v; got %v", nil, gotLocks)
-			}
-
-			gotLastIDs := db.lastIDs
-			if nil != gotLastIDs {
-				t.Errorf("want %v; got %v", nil, gotLastIDs)
+			gotTables := db.tables
+			if nil != gotTables {
+				t.Errorf("want %v; got %v", nil, gotTables)
 			}
 		},
 		func(t *testing.T) {
@@ -59,20 +59,12 @@ func TestCloseDatabaseTests(t *testing.T) {
 			db.Close()
 
 			checkErr(t, dberr.ErrNoTable, db.Find("contacts", 3, &Contact{}))
+			checkErr(t, dberr.ErrClosed, db.CreateTable("newtable"))
+			checkErr(t, dberr.ErrClosed, db.Close())
 
-			gotStore := db.store
-			if nil != gotStore {
-				t.Errorf("want %v; got %v", nil, gotStore)
-			}
-
-			gotLocks := db.locks
-			if nil != gotLocks {
-				t.Errorf("want %v; got %v", nil, gotLocks)
-			}
-
-			gotLastIDs := db.lastIDs
-			if nil != gotLastIDs {
-				t.Errorf("want %v; got %v", nil, gotLastIDs)
+			gotTables := db.tables
+			if nil != gotTables {
+				t.Errorf("want %v; got %v", nil, gotTables)
 			}
 		},
 	}
@@ -89,7 +81,8 @@ func TestNonMutatingDatabaseTests(t *testing.T) {
 
 			return func(t *testing.T) {
 				want := 4
-				got := db.lastIDs["contacts"]
+				tbl, _ := db.table("contacts")
+				got := tbl.lastID
 				if want != got {
 					t.Errorf("want %v; got %v", want, got)
 				}
@@ -160,6 +153,23 @@ func TestMutatingDatabaseTests(t *testing.T) {
 				checkErr(t, dberr.ErrTableExists, db.CreateTable("contacts"))
 			}
 		},
+		func(db *Database) func(*testing.T) {
+			//CreateTable (datastore error)...
+
+			return func(t *testing.T) {
+				// The datastore already has the table, but the database
+				// has not registered it.
+				if err := db.store.CreateTable("newtable"); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrTableExists, db.CreateTable("newtable"))
+
+				if db.tableExists("newtable") {
+					t.Errorf("want %v; got %v", false, true)
+				}
+			}
+		},
 		func(db *Database) func(*testing.T) {
 			//DropTable...
 
@@ -203,6 +213,39 @@ func TestMutatingDatabaseTests(t *testing.T) {
 
 func TestTableTests(t *testing.T) {
 	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//Compact...
+
+			return func(t *testing.T) {
+				if err := db.Delete("contacts", 2); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.Compact("contacts"); err != nil {
+					t.Fatal(err)
+				}
+
+				c := Contact{}
+
+				if err := db.Find("contacts", 4, &c); err != nil {
+					t.Fatal(err)
+				}
+
+				want := "Helen Keller is 25"
+				got := fmt.Sprintf("%s %s is %d", c.FirstName, c.LastName, c.Age)
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Compact (NoTable error)...
+
+			return func(t *testing.T) {
+				checkErr(t, dberr.ErrNoTable, db.Compact("nonexistent"))
+			}
+		},
 		func(db *Database) func(*testing.T) {
 			//IDs()...
 
@@ -333,6 +376,65 @@ func TestRecordTests(t *testing.T) {
 				checkErr(t, dberr.ErrNoTable, gotErr)
 			}
 		},
+		func(db *Database) func(*testing.T) {
+			//Insert (record that cannot be encoded)...
+
+			return func(t *testing.T) {
+				if _, err := db.Insert("contacts", &nestedContact{Extra: make(chan int)}); err == nil {
+					t.Fatal("want an error for a record json cannot encode")
+				}
+
+				// The id handed out to the record is handed out again.
+				id, err := db.Insert("contacts", &Contact{FirstName: "Ann"})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if id != 5 {
+					t.Errorf("want %v; got %v", 5, id)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Insert (record that cannot be indexed)...
+
+			return func(t *testing.T) {
+				if err := db.CreateIndex("contacts", "last_name"); err != nil {
+					t.Fatal(err)
+				}
+
+				// json writes a value nested this deep but will not read
+				// it back, so the record is stored but cannot be indexed.
+				var deep interface{}
+				for i := 0; i <= 10000; i++ {
+					deep = []interface{}{deep}
+				}
+
+				if _, err := db.Insert("contacts", &nestedContact{Contact: Contact{LastName: "Deep"}, Extra: deep}); err == nil {
+					t.Fatal("want an error for a record that cannot be indexed")
+				}
+
+				checkErr(t, dberr.ErrNoRecord, db.Find("contacts", 5, &Contact{}))
+
+				id, err := db.Insert("contacts", &Contact{LastName: "Deep"})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if id != 5 {
+					t.Errorf("want %v; got %v", 5, id)
+				}
+
+				ids, err := db.Query("contacts").Where("last_name", "=", "Deep").IDs()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !reflect.DeepEqual([]int{5}, ids) {
+					t.Errorf("want %v; got %v", []int{5}, ids)
+				}
+			}
+		},
 		func(db *Database) func(*testing.T) {
 			//Update...
 
@@ -370,3 +472,325 @@ func TestRecordTests(t *testing.T) {
 
 	runTestFns(t, tests)
 }
+
+func TestSequenceTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//Insert (after deleting the last record)...
+
+			return func(t *testing.T) {
+				if err := db.Delete("contacts", 4); err != nil {
+					t.Fatal(err)
+				}
+
+				want := 5
+				got, err := db.Insert("contacts", &Contact{FirstName: "Rex", LastName: "Stout", Age: 77})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//SetSequence...
+
+			return func(t *testing.T) {
+				if err := db.SetSequence("contacts", 100); err != nil {
+					t.Fatal(err)
+				}
+
+				want := 101
+				got, err := db.Insert("contacts", &Contact{FirstName: "Rex", LastName: "Stout", Age: 77})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//SetSequence (SequenceTooLow error)...
+
+			return func(t *testing.T) {
+				checkErr(t, dberr.ErrSequenceTooLow, db.SetSequence("contacts", 3))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//SetSequence (NoTable error)...
+
+			return func(t *testing.T) {
+				checkErr(t, dberr.ErrNoTable, db.SetSequence("nonexistent", 100))
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
+
+func TestSequenceDiskTests(t *testing.T) {
+	testSetup(t)
+	defer testTeardown(t)
+
+	ds, err := disk.New("./testdata", ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := New(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Delete("contacts", 4); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTable("newtable"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.SetSequence("newtable", 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither the deleted id nor the ids below the sequence are handed
+	// out again after the database is reopened.
+	ds, err = disk.New("./testdata", ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = New(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for tableName, want := range map[string]int{"contacts": 5, "newtable": 1001} {
+		got, err := db.Insert(tableName, &Contact{FirstName: "Rex", LastName: "Stout", Age: 77})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want != got {
+			t.Errorf("%s: want %v; got %v", tableName, want, got)
+		}
+	}
+}
+
+func TestInsertWithIDTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//InsertWithID...
+
+			return func(t *testing.T) {
+				want := Contact{ID: 50, FirstName: "Rex", LastName: "Stout", Age: 77}
+
+				if err := db.InsertWithID("contacts", &want); err != nil {
+					t.Fatal(err)
+				}
+
+				got := Contact{}
+				if err := db.Find("contacts", 50, &got); err != nil {
+					t.Fatal(err)
+				}
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				// The sequence moves past the id.
+				id, err := db.Insert("contacts", &Contact{FirstName: "Ann"})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if id != 51 {
+					t.Errorf("want %v; got %v", 51, id)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//InsertWithID (below the sequence)...
+
+			return func(t *testing.T) {
+				if err := db.Delete("contacts", 2); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.InsertWithID("contacts", &Contact{ID: 2, FirstName: "Abe"}); err != nil {
+					t.Fatal(err)
+				}
+
+				id, err := db.Insert("contacts", &Contact{FirstName: "Ann"})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if id != 5 {
+					t.Errorf("want %v; got %v", 5, id)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//InsertWithID (IDExists error)...
+
+			return func(t *testing.T) {
+				checkErr(t, dberr.ErrIDExists, db.InsertWithID("contacts", &Contact{ID: 3, FirstName: "Bill"}))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//InsertWithID (InvalidID error)...
+
+			return func(t *testing.T) {
+				checkErr(t, dberr.ErrInvalidID, db.InsertWithID("contacts", &Contact{FirstName: "Ann"}))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//InsertWithID (NoTable error)...
+
+			return func(t *testing.T) {
+				checkErr(t, dberr.ErrNoTable, db.InsertWithID("nonexistent", &Contact{ID: 50}))
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
+
+func TestUpsertTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//Upsert (existing record)...
+
+			return func(t *testing.T) {
+				c := hookedContact{Contact: Contact{ID: 3, FirstName: "William", LastName: "Shakespeare", Age: 77}}
+
+				id, err := db.Upsert("contacts", &c)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if id != 3 {
+					t.Errorf("want %v; got %v", 3, id)
+				}
+
+				wantCalls := []string{"BeforeUpdate", "Validate", "AfterUpdate"}
+				if !reflect.DeepEqual(wantCalls, c.calls) {
+					t.Errorf("want %v; got %v", wantCalls, c.calls)
+				}
+
+				got := Contact{}
+				if err := db.Find("contacts", 3, &got); err != nil {
+					t.Fatal(err)
+				}
+
+				if got != c.Contact {
+					t.Errorf("want %v; got %v", c.Contact, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Upsert (new record with an id)...
+
+			return func(t *testing.T) {
+				c := hookedContact{Contact: Contact{ID: 20, FirstName: "Rex", LastName: "Stout", Age: 77}}
+
+				id, err := db.Upsert("contacts", &c)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if id != 20 {
+					t.Errorf("want %v; got %v", 20, id)
+				}
+
+				wantCalls := []string{"BeforeInsert", "Validate", "AfterInsert"}
+				if !reflect.DeepEqual(wantCalls, c.calls) {
+					t.Errorf("want %v; got %v", wantCalls, c.calls)
+				}
+
+				nextID, err := db.Insert("contacts", &Contact{FirstName: "Ann"})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if nextID != 21 {
+					t.Errorf("want %v; got %v", 21, nextID)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Upsert (new record without an id)...
+
+			return func(t *testing.T) {
+				c := Contact{FirstName: "Rex", LastName: "Stout", Age: 77}
+
+				id, err := db.Upsert("contacts", &c)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if id != 5 || c.ID != 5 {
+					t.Errorf("want %v; got %v and %v", 5, id, c.ID)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Upsert (hook error)...
+
+			return func(t *testing.T) {
+				_, gotErr := db.Upsert("contacts", &hookedContact{})
+				checkErr(t, errTestHook, gotErr)
+
+				// The id handed out to the rejected record is handed out
+				// again.
+				id, err := db.Insert("contacts", &Contact{FirstName: "Ann"})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if id != 5 {
+					t.Errorf("want %v; got %v", 5, id)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Upsert (record that cannot be encoded)...
+
+			return func(t *testing.T) {
+				if _, err := db.Upsert("contacts", &nestedContact{Extra: make(chan int)}); err == nil {
+					t.Fatal("want an error for a record json cannot encode")
+				}
+
+				id, err := db.Insert("contacts", &Contact{FirstName: "Ann"})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if id != 5 {
+					t.Errorf("want %v; got %v", 5, id)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Upsert (NoTable error)...
+
+			return func(t *testing.T) {
+				_, gotErr := db.Upsert("nonexistent", &Contact{ID: 3})
+				checkErr(t, dberr.ErrNoTable, gotErr)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
@@ -0,0 +1,266 @@
+package disk
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"sort"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+const compactExt = ".compact"
+
+var errCompactCorrupt = fmt.Errorf("%w; run Repair before compacting it", dberr.ErrCorruptRecord)
+
+// Compact takes a table name and rewrites the table file without its
+// dummy records.  The new file is written next to the old one, synced,
+// and renamed over it, so the table is never left half compacted.  If
+// the datastore's options ask for compression or encryption the table
+// does not have yet, the table is rewritten with them, and encrypted
+// records are re-encrypted with the current key.  A table with corrupt
+// records that Lenient skipped is not compacted, since they would be
+// lost; Repair moves them to a quarantine file first.
+func (dsk *Disk) Compact(tableName string) error {
+	if dsk.readOnly() {
+		return dberr.ErrReadOnly
+	}
+
+	dsk.lockWAL()
+	defer dsk.unlockWAL()
+
+	tableFile, err := dsk.getTableFile(tableName)
+	if err != nil {
+		return err
+	}
+
+	// Journaled records could not be undone if the table's settings
+	// changed under them.
+	if dsk.batching(tableName) {
+		return dberr.ErrBatchInProgress
+	}
+
+	if tableFile.corrupt > 0 {
+		return errCompactCorrupt
+	}
+
+	return dsk.compactTable(tableName, tableFile, true)
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+// compactTable takes a table name, its table file, and whether to add
+// the datastore's compression and encryption to the table.  It expects
+// the caller to hold the wal lock.
+func (dsk *Disk) compactTable(tableName string, tableFile *tableFile, migrate bool) error {
+	meta := tableFile.meta
+	if migrate {
+		meta = dsk.withOptions(meta)
+
+		// The dictionary is only added or dropped here, since
+		// Compact is never run during a batch and empties the
+		// write-ahead log when the settings change, so no journaled
+		// or logged record is left stored the old way.
+		var err error
+		if meta, err = tableFile.withDictionary(meta); err != nil {
+			return err
+		}
+	}
+
+	changed := !maps.Equal(meta, tableFile.meta)
+
+	tmpPath := dsk.tablePath(tableName) + compactExt
+
+	tmpPtr, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0660)
+	if err != nil {
+		return err
+	}
+
+	offsets, err := tableFile.copyRecs(tmpPtr, meta)
+	if err == nil {
+		err = tmpPtr.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, dsk.tablePath(tableName))
+	}
+	if err != nil {
+		tmpPtr.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := syncDir(dsk.path); err != nil {
+		return err
+	}
+
+	oldPtr := tableFile.ptr
+
+	tableFile.ptr = tmpPtr
+	tableFile.offsets = offsets
+	tableFile.dupOffsets = make(map[int][]int64)
+	tableFile.free = make(map[int64]int)
+
+	if err := oldPtr.Close(); err != nil {
+		return err
+	}
+
+	if err := tableFile.readHeader(); err != nil {
+		return err
+	}
+
+	// The write-ahead log holds records the way they were stored
+	// before, so it is emptied rather than replayed against the new
+	// settings.
+	if changed && dsk.wal != nil {
+		if err := dsk.checkpoint(); err != nil {
+			return err
+		}
+	}
+
+	// The old offset index no longer matches the table file.
+	tableFile.dirty = false
+
+	return tableFile.invalidateIndex()
+}
+
+// maybeCompact compacts a table if automatic compaction is turned on
+// and the table file has passed the threshold.  A table with corrupt
+// records is left alone until it is repaired.
+func (dsk *Disk) maybeCompact(tableName string, tableFile *tableFile) error {
+	if dsk.opts.CompactThreshold <= 0 || tableFile.corrupt > 0 {
+		return nil
+	}
+
+	info, err := tableFile.ptr.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() == 0 || info.Size() < dsk.opts.CompactMinSize {
+		return nil
+	}
+
+	if float64(tableFile.deadBytes())/float64(info.Size()) < dsk.opts.CompactThreshold {
+		return nil
+	}
+
+	return dsk.compactTable(tableName, tableFile, false)
+}
+
+// copyRecs takes an open file and the table's settings and writes a
+// header and every live record to it, in the order they appear in the
+// table file, and returns their new offsets.  Records are re-encoded if
+// the settings have changed.
+func (t *tableFile) copyRecs(filePtr *os.File, meta map[string]string) (map[int]int64, error) {
+	var header []byte
+	var err error
+
+	offsets := make(map[int]int64)
+
+	dst := tableFile{name: t.name, crypt: t.crypt}
+	if err := dst.applyMeta(meta); err != nil {
+		return nil, err
+	}
+
+	reencode := !maps.Equal(t.meta, dst.meta)
+
+	// Records encrypted with an older key are re-encrypted.
+	var currentKeyID string
+
+	if dst.meta[metaEncryption] != "" && dst.crypt != nil {
+		if currentKeyID, err = dst.crypt.currentKeyID(); err != nil {
+			return nil, err
+		}
+	}
+
+	ids := t.ids()
+	sort.Slice(ids, func(i, j int) bool { return t.offsets[ids[i]] < t.offsets[ids[j]] })
+
+	w := bufio.NewWriter(filePtr)
+
+	if len(meta) > 0 {
+		if header, err = encodeHeader(meta); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	offset := int64(len(header))
+
+	for _, id := range ids {
+		f, err := t.readFrameAt(t.offsets[id])
+		if err != nil {
+			return nil, err
+		}
+
+		stored := t.frm.trim(f.rec)
+		reencodeRec := reencode
+
+		if !reencodeRec && currentKeyID != "" {
+			keyID, _, err := splitKeyID(stored)
+			if err != nil {
+				return nil, err
+			}
+
+			reencodeRec = keyID != currentKeyID
+		}
+
+		if reencodeRec {
+			rec, err := t.decodeRec(id, f.rec)
+			if err != nil {
+				return nil, err
+			}
+
+			if stored, err = dst.encodeRec(id, t.frm.trim(rec)); err != nil {
+				return nil, err
+			}
+		}
+
+		data := dst.frm.frame(id, stored, 0)
+
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+
+		offsets[id] = offset
+		offset += int64(len(data))
+	}
+
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	return offsets, nil
+}
+
+// deadBytes returns the number of bytes taken up by dummy records.
+func (t *tableFile) deadBytes() int64 {
+	var dead int64
+
+	for _, freeLen := range t.free {
+		dead += int64(freeLen + t.frm.overhead())
+	}
+
+	return dead
+}
+
+// syncDir syncs a directory so that a rename inside it is durable.
+func syncDir(path string) error {
+	dirPtr, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dirPtr.Close()
+
+	// Some platforms do not support syncing a directory, and there is
+	// nothing more that can be done about it there.
+	dirPtr.Sync()
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package disk
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestCompactDiskTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//Compact...
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			if err := dsk.DeleteRec("contacts", 2); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.Compact("contacts"); err != nil {
+				t.Fatal(err)
+			}
+
+			wantOffsets := map[int]int64{1: 0, 3: 56, 4: 120}
+			gotOffsets := dsk.tableFiles["contacts"].offsets
+
+			if !reflect.DeepEqual(wantOffsets, gotOffsets) {
+				t.Errorf("want %v; got %v", wantOffsets, gotOffsets)
+			}
+
+			data, err := ioutil.ReadFile("./testdata/contacts.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := "{\"id\":1,\"first_name\":\"John\",\"last_name\":\"Doe\",\"age\":37}\n" +
+				"{\"id\":3,\"first_name\":\"Bill\",\"last_name\":\"Shakespeare\",\"age\":18}\n" +
+				"{\"id\":4,\"first_name\":\"Helen\",\"last_name\":\"Keller\",\"age\":25}\n"
+			got := string(data)
+
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			if err := dsk.InsertRec("contacts", 5, []byte(`{"id":5,"first_name":"Rex","last_name":"Stout","age":77}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			rec, err := dsk.ReadRec("contacts", 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want = "{\"id\":5,\"first_name\":\"Rex\",\"last_name\":\"Stout\",\"age\":77}\n"
+			got = string(rec)
+
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+		func(t *testing.T) {
+			//Compact (NoTable error)...
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			wantErr := dberr.ErrNoTable
+			gotErr := dsk.Compact("nonexistent")
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+		},
+		func(t *testing.T) {
+			//maybeCompact...
+
+			dsk := newTestDiskWithOptions(t, Options{CompactThreshold: 0.4})
+			defer dsk.Close()
+
+			if err := dsk.DeleteRec("contacts", 2); err != nil {
+				t.Fatal(err)
+			}
+
+			want := 2
+			got := len(dsk.tableFiles["contacts"].free)
+
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			if err := dsk.DeleteRec("contacts", 4); err != nil {
+				t.Fatal(err)
+			}
+
+			want = 0
+			got = len(dsk.tableFiles["contacts"].free)
+
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			wantOffsets := map[int]int64{1: 0, 3: 56}
+			gotOffsets := dsk.tableFiles["contacts"].offsets
+
+			if !reflect.DeepEqual(wantOffsets, gotOffsets) {
+				t.Errorf("want %v; got %v", wantOffsets, gotOffsets)
+			}
+		},
+		func(t *testing.T) {
+			//Compact and maybeCompact (corrupt records skipped by Lenient)...
+
+			corruptTestFile(t, "contacts.json", `"Abe",`, `"Abe";`)
+
+			dsk := newTestDiskWithOptions(t, Options{Lenient: true, CompactThreshold: 0.1})
+			defer dsk.Close()
+
+			wantErr := dberr.ErrCorruptRecord
+			gotErr := dsk.Compact("contacts")
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+
+			// The delete passes the threshold, but the table is not
+			// compacted automatically either.
+			if err := dsk.DeleteRec("contacts", 4); err != nil {
+				t.Fatal(err)
+			}
+
+			want := []Corruption{{Table: "contacts", Offset: 101, Length: 59, Reason: "record is not valid json"}}
+			got, err := dsk.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("want %+v; got %+v", want, got)
+			}
+
+			if _, err := dsk.Repair(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.Compact("contacts"); err != nil {
+				t.Fatal(err)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
@@ -0,0 +1,254 @@
+package disk
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// Compression decides how the records of new table files are
+// compressed.
+type Compression int
+
+const (
+	// CompressNone stores records as they are.
+	CompressNone Compression = iota
+
+	// CompressFlate compresses each record on its own with DEFLATE,
+	// so any record can still be read without reading its neighbors.
+	// The first time the table is compacted with enough records in
+	// it, a dictionary is built from a sample of them that every
+	// record is then compressed against, which is what lets small
+	// records shrink.
+	CompressFlate
+)
+
+const (
+	metaCompression  = "compression"
+	compressionFlate = "flate"
+
+	// metaDictionary holds the table's dictionary, base64 encoded.
+	metaDictionary = "dictionary"
+)
+
+// Each compressed record starts with a byte saying how it is stored,
+// since records too small to shrink are better left as they are.
+const (
+	storedRaw       = 0
+	storedFlate     = 1
+	storedFlateDict = 2
+)
+
+// maxDictLen is the size of a table's dictionary.  DEFLATE could use up
+// to 32KiB, but the dictionary is hashed again for every record that is
+// compressed, and past 8KiB it saves little.
+const maxDictLen = 8 << 10
+
+// maxRecLen is the largest record a compressed table holds, so a
+// corrupt or crafted record cannot decompress into more memory than
+// that.
+const maxRecLen = 64 << 20
+
+var errUnknownCompression = errors.New("hare: table uses an unknown compression")
+
+var errBadCompressedRec = errors.New("hare: compressed record is corrupt")
+
+var errRecTooLarge = errors.New("hare: record is too large for a compressed table")
+
+var errBadDictionary = errors.New("hare: table's compression dictionary is corrupt")
+
+var flateWriters = sync.Pool{
+	New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	},
+}
+
+// dictionary is a preset DEFLATE dictionary made of a sample of a
+// table's records.  Records share most of their field names and many of
+// their values, so a record compressed against the dictionary shrinks
+// even when it is too small to shrink on its own.
+type dictionary struct {
+	data    []byte
+	writers sync.Pool
+}
+
+func newDictionary(data []byte) *dictionary {
+	d := dictionary{data: data}
+
+	// Only the slower levels look for matches in the dictionary when
+	// the record is short.
+	d.writers.New = func() interface{} {
+		w, _ := flate.NewWriterDict(nil, flate.BestCompression, data)
+		return w
+	}
+
+	return &d
+}
+
+// compressRec takes a record and the table's dictionary, or nil, and
+// returns the record compressed.
+func compressRec(rec []byte, dict *dictionary) ([]byte, error) {
+	if len(rec) > maxRecLen {
+		return nil, errRecTooLarge
+	}
+
+	pool, stored := &flateWriters, byte(storedFlate)
+	if dict != nil {
+		pool, stored = &dict.writers, storedFlateDict
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteByte(stored)
+
+	w := pool.Get().(*flate.Writer)
+	defer pool.Put(w)
+
+	// A writer made with a dictionary keeps it when it is reset.
+	w.Reset(&buf)
+
+	if _, err := w.Write(rec); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	if buf.Len() >= len(rec)+1 {
+		return append([]byte{storedRaw}, rec...), nil
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decompressRec takes a record written by compressRec and the
+// dictionary it was compressed against, or nil, and returns it
+// decompressed.
+func decompressRec(data []byte, dict *dictionary) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errBadCompressedRec
+	}
+
+	var r io.ReadCloser
+
+	switch data[0] {
+	case storedRaw:
+		return data[1:], nil
+	case storedFlate:
+		r = flate.NewReader(bytes.NewReader(data[1:]))
+	case storedFlateDict:
+		if dict == nil {
+			return nil, errBadCompressedRec
+		}
+
+		r = flate.NewReaderDict(bytes.NewReader(data[1:]), dict.data)
+	default:
+		return nil, errBadCompressedRec
+	}
+	defer r.Close()
+
+	rec, err := ioutil.ReadAll(io.LimitReader(r, maxRecLen+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rec) > maxRecLen {
+		return nil, errRecTooLarge
+	}
+
+	return rec, nil
+}
+
+// decodeDictionary takes a table's settings and returns the dictionary
+// they hold, or nil if they hold none.
+func decodeDictionary(meta map[string]string) (*dictionary, error) {
+	encoded := meta[metaDictionary]
+	if encoded == "" {
+		return nil, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(data) > maxDictLen {
+		return nil, errBadDictionary
+	}
+
+	return newDictionary(data), nil
+}
+
+// withDictionary takes the settings a table is about to be compacted
+// with and, if they are for a compressed table without a dictionary,
+// returns them with a dictionary sampled from the table's records.  A
+// table too small to fill half the dictionary is left without one, so
+// it is not stuck with a sample of a few records.  Encrypted tables get
+// no dictionary, since it would hold records in the clear.
+func (t *tableFile) withDictionary(meta map[string]string) (map[string]string, error) {
+	if meta[metaCompression] == "" || meta[metaEncryption] != "" {
+		delete(meta, metaDictionary)
+		return meta, nil
+	}
+
+	if meta[metaDictionary] != "" {
+		return meta, nil
+	}
+
+	dict, err := t.sampleRecs(maxDictLen)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(dict) >= maxDictLen/2 {
+		meta[metaDictionary] = base64.StdEncoding.EncodeToString(dict)
+	}
+
+	return meta, nil
+}
+
+// sampleRecs takes a number of bytes and returns up to that many bytes
+// of records, spread evenly through the table file.
+func (t *tableFile) sampleRecs(maxLen int) ([]byte, error) {
+	ids := t.ids()
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return t.offsets[ids[i]] < t.offsets[ids[j]] })
+
+	info, err := t.ptr.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// Stored records are smaller than the records themselves, so this
+	// step errs toward reading more records than needed.
+	step := int(info.Size()/int64(maxLen)) + 1
+	if step > len(ids) {
+		step = len(ids)
+	}
+
+	var sample []byte
+
+	for i := 0; i < len(ids); i += step {
+		rec, err := t.readRec(ids[i])
+		if err != nil {
+			return nil, err
+		}
+
+		rec = t.frm.trim(rec)
+
+		if len(sample)+len(rec)+1 > maxLen {
+			break
+		}
+
+		sample = append(sample, rec...)
+		sample = append(sample, '\n')
+	}
+
+	return sample, nil
+}
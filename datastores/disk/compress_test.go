@@ -0,0 +1,340 @@
+package disk
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompressRecTests(t *testing.T) {
+	tests := []struct {
+		rec        []byte
+		wantStored byte
+	}{
+		{[]byte(`{"id":1}`), storedRaw},
+		{[]byte(strings.Repeat(`{"id":1,"first_name":"John"}`, 20)), storedFlate},
+		{[]byte{}, storedRaw},
+	}
+
+	for _, tt := range tests {
+		data, err := compressRec(tt.rec, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if data[0] != tt.wantStored {
+			t.Errorf("want stored as %v; got %v", tt.wantStored, data[0])
+		}
+
+		got, err := decompressRec(data, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(tt.rec, got) {
+			t.Errorf("want %s; got %s", tt.rec, got)
+		}
+	}
+
+	if _, err := decompressRec([]byte{9, 1, 2}, nil); err == nil {
+		t.Error("want an error for an unknown storage byte")
+	}
+
+	// A record too small to shrink on its own shrinks against a
+	// dictionary of records like it.
+	dict := newDictionary([]byte(`{"id":1,"first_name":"John","last_name":"Doe","age":37}` + "\n"))
+	rec := []byte(`{"id":9,"first_name":"John","last_name":"Doe","age":37}`)
+
+	data, err := compressRec(rec, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data[0] != storedFlateDict || len(data) >= len(rec)/2 {
+		t.Errorf("want stored as %v in under %v bytes; got %v in %v", storedFlateDict, len(rec)/2, data[0], len(data))
+	}
+
+	got, err := decompressRec(data, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(rec, got) {
+		t.Errorf("want %s; got %s", rec, got)
+	}
+
+	if _, err := decompressRec(data, nil); !errors.Is(err, errBadCompressedRec) {
+		t.Errorf("want %v; got %v", errBadCompressedRec, err)
+	}
+
+	if _, err := compressRec(make([]byte, maxRecLen+1), nil); !errors.Is(err, errRecTooLarge) {
+		t.Errorf("want %v; got %v", errRecTooLarge, err)
+	}
+
+	// A record that decompresses past the limit is not read into memory.
+	var buf bytes.Buffer
+
+	buf.WriteByte(storedFlate)
+
+	w, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write(make([]byte, maxRecLen+1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := decompressRec(buf.Bytes(), nil); !errors.Is(err, errRecTooLarge) {
+		t.Errorf("want %v; got %v", errRecTooLarge, err)
+	}
+}
+
+func TestCompressionDiskTests(t *testing.T) {
+	rec := func(id int) []byte {
+		return []byte(`{"id":` + string(rune('0'+id)) + `,"notes":"` + strings.Repeat("very repetitive ", 50) + `"}`)
+	}
+
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//InsertRec, UpdateRec, and ReadRec (compressed table)...
+
+			dsk := newTestDiskWithOptions(t, Options{Compression: CompressFlate})
+
+			if err := dsk.CreateTable("newtable"); err != nil {
+				t.Fatal(err)
+			}
+
+			for id := 1; id <= 3; id++ {
+				if err := dsk.InsertRec("newtable", id, rec(id)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := dsk.UpdateRec("newtable", 2, []byte(`{"id":2}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.DeleteRec("newtable", 3); err != nil {
+				t.Fatal(err)
+			}
+
+			// Uncompressed tables stay as they are.
+			if err := dsk.UpdateRec("contacts", 3, []byte(`{"id":3,"first_name":"Bill","last_name":"Shakespeare","age":19}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := os.Stat("./testdata/newtable.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if info.Size() >= int64(len(rec(1))) {
+				t.Errorf("want the table file to be smaller than one record; got %v bytes", info.Size())
+			}
+
+			// The compression is read from the header, so the table can
+			// be read without the option.
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			want := map[int][]byte{1: rec(1), 2: []byte(`{"id":2}`)}
+
+			for id, wantRec := range want {
+				got, err := dsk.ReadRec("newtable", id)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !bytes.Equal(wantRec, got) {
+					t.Errorf("want %s; got %s", wantRec, got)
+				}
+			}
+
+			got, err := dsk.ReadRec("contacts", 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantRec := "{\"id\":3,\"first_name\":\"Bill\",\"last_name\":\"Shakespeare\",\"age\":19}\n"
+
+			if wantRec != string(got) {
+				t.Errorf("want %s; got %s", wantRec, got)
+			}
+		},
+		func(t *testing.T) {
+			//Compact (compresses an uncompressed table)...
+
+			dsk := newTestDisk(t)
+
+			before := make(map[int][]byte)
+			for _, id := range []int{1, 2, 3, 4} {
+				rec, err := dsk.ReadRec("contacts", id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				before[id] = bytes.TrimSuffix(rec, []byte{'\n'})
+			}
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk = newTestDiskWithOptions(t, Options{Compression: CompressFlate})
+			defer dsk.Close()
+
+			if err := dsk.Compact("contacts"); err != nil {
+				t.Fatal(err)
+			}
+
+			meta, err := dsk.TableMeta("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantMeta := map[string]string{metaCompression: compressionFlate, metaFrames: framesBinary}
+
+			if !reflect.DeepEqual(wantMeta, meta) {
+				t.Errorf("want %v; got %v", wantMeta, meta)
+			}
+
+			for id, want := range before {
+				got, err := dsk.ReadRec("contacts", id)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !bytes.Equal(want, got) {
+					t.Errorf("want %s; got %s", want, got)
+				}
+			}
+
+			if err := dsk.InsertRec("contacts", 5, rec(5)); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := dsk.ReadRec("contacts", 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(rec(5), got) {
+				t.Errorf("want %s; got %s", rec(5), got)
+			}
+		},
+		func(t *testing.T) {
+			//Compact (builds a dictionary for small records)...
+
+			small := func(id int) []byte {
+				return []byte(fmt.Sprintf(`{"id":%d,"first_name":"John","last_name":"Doe","age":%d}`, id, 20+id%50))
+			}
+
+			dsk := newTestDiskWithOptions(t, Options{Compression: CompressFlate})
+
+			if err := dsk.CreateTable("newtable"); err != nil {
+				t.Fatal(err)
+			}
+
+			for id := 1; id <= 200; id++ {
+				if err := dsk.InsertRec("newtable", id, small(id)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			before, err := dsk.tableFiles["newtable"].ptr.Stat()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.Compact("newtable"); err != nil {
+				t.Fatal(err)
+			}
+
+			after, err := dsk.tableFiles["newtable"].ptr.Stat()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The dictionary is in the header, so the file only gets
+			// smaller once there are enough records.
+			if dsk.tableFiles["newtable"].dict == nil || after.Size()-before.Size() > maxDictLen*4/3 {
+				t.Errorf("want a dictionary; got %v bytes before and %v after", before.Size(), after.Size())
+			}
+
+			if err := dsk.InsertRec("newtable", 201, small(201)); err != nil {
+				t.Fatal(err)
+			}
+
+			// Later compactions keep the dictionary, so the records do
+			// not have to be compressed again.
+			want := dsk.tableFiles["newtable"].meta[metaDictionary]
+
+			if err := dsk.Compact("newtable"); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := dsk.tableFiles["newtable"].meta[metaDictionary]; want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			dsk.Close()
+
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			for _, id := range []int{1, 100, 201} {
+				got, err := dsk.ReadRec("newtable", id)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !bytes.Equal(small(id), got) {
+					t.Errorf("want %s; got %s", small(id), got)
+				}
+			}
+
+			f, err := dsk.tableFiles["newtable"].readFrameAt(dsk.tableFiles["newtable"].offsets[201])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stored := dsk.tableFiles["newtable"].frm.trim(f.rec)
+			if stored[0] != storedFlateDict || len(stored) >= len(small(201))/2 {
+				t.Errorf("want stored as %v in under %v bytes; got %v in %v", storedFlateDict, len(small(201))/2, stored[0], len(stored))
+			}
+		},
+		func(t *testing.T) {
+			//Compact (no dictionary for an encrypted table)...
+
+			dsk := newTestDiskWithOptions(t, Options{Compression: CompressFlate, Encryption: testKeyring()})
+			defer dsk.Close()
+
+			if err := dsk.Compact("contacts"); err != nil {
+				t.Fatal(err)
+			}
+
+			if tf := dsk.tableFiles["contacts"]; tf.dict != nil || tf.meta[metaDictionary] != "" {
+				t.Errorf("want no dictionary; got %v", tf.meta[metaDictionary])
+			}
+
+			if _, err := dsk.ReadRec("contacts", 1); err != nil {
+				t.Fatal(err)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
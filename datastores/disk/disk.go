@@ -3,28 +3,125 @@ package disk
 import (
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/jameycribbs/hare/dberr"
 )
 
 // Disk is a struct that holds a map of all the
-// table files in a database directory.
+// table files in a database directory.  The map has a lock of its own,
+// so tables can be created and removed while other tables are in use.
 type Disk struct {
 	path       string
 	ext        string
+	opts       Options
+	tablesLock sync.RWMutex
 	tableFiles map[string]*tableFile
+	batchLock  sync.Mutex
+	batch      *batch
+	wal        *wal
+	lock       *dirLock
+	crypt      *crypter
+}
+
+// Options holds the settings for a Disk datastore.
+type Options struct {
+	// WAL turns on the write-ahead log.  Every write is appended to
+	// the log and synced before the table file is changed, and the log
+	// is replayed the next time the datastore is opened.
+	WAL bool
+
+	// CheckpointEvery is how many writes the write-ahead log holds
+	// before the table files are synced and the log is truncated.  It
+	// defaults to 1000.
+	CheckpointEvery int
+
+	// FitPolicy decides which dummy record a new or grown record is
+	// written over.  It defaults to FirstFit.
+	FitPolicy FitPolicy
+
+	// CompactThreshold turns on automatic compaction.  When a delete
+	// or update leaves a table file with at least this share (0.0 to
+	// 1.0) of its bytes in dummy records, the table is compacted as
+	// part of that write.  Zero turns automatic compaction off.
+	CompactThreshold float64
+
+	// CompactMinSize is the size in bytes a table file must reach
+	// before it is compacted automatically.
+	CompactMinSize int64
+
+	// Encryption turns on encryption at rest.  The records of new
+	// table files are encrypted with AES-GCM using the provider's
+	// current key, and reading a record that was changed on disk
+	// returns dberr.ErrTampered.  Compacting a table that is not
+	// encrypted yet rewrites it encrypted.  Tables that are already
+	// encrypted can only be opened with a provider.
+	Encryption KeyProvider
+
+	// Compression decides how the records of new table files are
+	// compressed.  Compacting a table that is not compressed yet
+	// rewrites it compressed.  It defaults to CompressNone.
+	Compression Compression
+
+	// Checksums turns on a crc32 checksum for every record of new
+	// table files, so a damaged record is reported instead of being
+	// read.  Compacting a table that has no checksums yet rewrites it
+	// with them.
+	Checksums bool
+
+	// Lenient skips corrupt records when the table files are opened,
+	// instead of refusing to open the datastore.  The skipped records
+	// can then be found with Verify and moved out of the way with
+	// Repair.
+	Lenient bool
+
+	// LockMode decides whether other processes can open the same
+	// directory at the same time.  It defaults to LockNone.
+	LockMode LockMode
+
+	// LockTimeout is how long to wait for another process to release
+	// the directory lock before giving up with dberr.ErrLocked.  Zero
+	// means fail at once.
+	LockTimeout time.Duration
+
+	// ReadOnly opens the table files read-only, and nothing is written
+	// to the directory.  Every write returns dberr.ErrReadOnly, and
+	// Reload picks up the changes other processes make to the files.
+	// A shared lock is taken on the directory if a process that locks
+	// it has made the lock file.  Without a LockMode, the datastore
+	// goes without a lock where locking is not supported.
+	ReadOnly bool
 }
 
 // New takes a datastorage path and an extension
 // and returns a pointer to a Disk struct.
 func New(path string, ext string) (*Disk, error) {
+	return NewWithOptions(path, ext, Options{})
+}
+
+// NewWithOptions takes a datastorage path, an extension, and
+// options and returns a pointer to a Disk struct.
+func NewWithOptions(path string, ext string, opts Options) (*Disk, error) {
 	var dsk Disk
 
 	dsk.path = path
 	dsk.ext = ext
+	dsk.opts = opts
+
+	if opts.Encryption != nil {
+		dsk.crypt = newCrypter(opts.Encryption)
+	}
 
 	if err := dsk.init(); err != nil {
+		for _, tableFile := range dsk.tableFiles {
+			tableFile.ptr.Close()
+		}
+
+		dsk.unlockDir()
+
 		return nil, err
 	}
 
@@ -33,12 +130,23 @@ func New(path string, ext string) (*Disk, error) {
 
 // Close closes the datastore.
 func (dsk *Disk) Close() error {
-	for _, tableFile := range dsk.tableFiles {
+	if err := dsk.closeWAL(); err != nil {
+		return err
+	}
+
+	for _, tableFile := range dsk.allTableFiles() {
 		if err := tableFile.close(); err != nil {
 			return err
 		}
 	}
 
+	if err := dsk.unlockDir(); err != nil {
+		return err
+	}
+
+	dsk.tablesLock.Lock()
+	defer dsk.tablesLock.Unlock()
+
 	dsk.path = ""
 	dsk.ext = ""
 	dsk.tableFiles = nil
@@ -50,38 +158,79 @@ func (dsk *Disk) Close() error {
 // file, and adds it to the map of tables in the
 // datastore.
 func (dsk *Disk) CreateTable(tableName string) error {
+	return dsk.CreateTableWithMeta(tableName, nil)
+}
+
+// CreateTableWithMeta takes a table name and the table's settings,
+// creates a new disk file with the settings written in its header, and
+// adds it to the map of tables in the datastore.  A "frames" setting of
+// "binary" stores the records with a length prefix instead of one per
+// line.
+func (dsk *Disk) CreateTableWithMeta(tableName string, meta map[string]string) error {
+	if dsk.readOnly() {
+		return dberr.ErrReadOnly
+	}
+
 	if dsk.TableExists(tableName) {
 		return dberr.ErrTableExists
 	}
 
-	filePtr, err := dsk.openFile(tableName, true)
-	if err != nil {
-		return err
-	}
+	meta = dsk.withOptions(meta)
 
-	tableFile, err := newTableFile(tableName, filePtr)
-	if err != nil {
-		return err
-	}
+	if len(meta) > 0 {
+		header, err := encodeHeader(meta)
+		if err != nil {
+			return err
+		}
 
-	dsk.tableFiles[tableName] = tableFile
+		if err := ioutil.WriteFile(dsk.tablePath(tableName), header, 0660); err != nil {
+			return err
+		}
+	}
 
-	return nil
+	return dsk.loadTable(tableName, true)
 }
 
 // DeleteRec takes a table name and a record id and deletes
 // the associated record.
 func (dsk *Disk) DeleteRec(tableName string, id int) error {
+	if dsk.readOnly() {
+		return dberr.ErrReadOnly
+	}
+
+	dsk.lockWAL()
+	defer dsk.unlockWAL()
+
 	tableFile, err := dsk.getTableFile(tableName)
 	if err != nil {
 		return err
 	}
 
+	if _, ok := tableFile.offsets[id]; !ok {
+		return dberr.ErrNoRecord
+	}
+
+	if err := dsk.journal(opDelete, tableName, id); err != nil {
+		return err
+	}
+
+	if err := dsk.logWrite(opDelete, tableName, id, nil); err != nil {
+		return err
+	}
+
 	if err = tableFile.deleteRec(id); err != nil {
 		return err
 	}
 
-	return nil
+	if err := tableFile.keepSeq(id); err != nil {
+		return err
+	}
+
+	if err := dsk.maybeCompact(tableName, tableFile); err != nil {
+		return err
+	}
+
+	return dsk.maybeCheckpoint()
 }
 
 // GetLastID takes a table name and returns the greatest record
@@ -106,9 +255,33 @@ func (dsk *Disk) IDs(tableName string) ([]int, error) {
 	return tableFile.ids(), nil
 }
 
+// IDsInFileOrder takes a table name and returns the ids of the records
+// in the table in the order they appear in the table file.
+func (dsk *Disk) IDsInFileOrder(tableName string) ([]int, error) {
+	tableFile, err := dsk.getTableFile(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := tableFile.ids()
+
+	sort.Slice(ids, func(i, j int) bool {
+		return tableFile.offsets[ids[i]] < tableFile.offsets[ids[j]]
+	})
+
+	return ids, nil
+}
+
 // InsertRec takes a table name, a record id, and a byte array and adds
 // the record to the table.
 func (dsk *Disk) InsertRec(tableName string, id int, rec []byte) error {
+	if dsk.readOnly() {
+		return dberr.ErrReadOnly
+	}
+
+	dsk.lockWAL()
+	defer dsk.unlockWAL()
+
 	tableFile, err := dsk.getTableFile(tableName)
 	if err != nil {
 		return err
@@ -121,18 +294,19 @@ func (dsk *Disk) InsertRec(tableName string, id int, rec []byte) error {
 		}
 	}
 
-	offset, err := tableFile.offsetForWritingRec(len(rec))
-	if err != nil {
+	if err := dsk.journal(opInsert, tableName, id); err != nil {
 		return err
 	}
 
-	if err := tableFile.writeRec(offset, 0, rec); err != nil {
+	if err := dsk.logWrite(opInsert, tableName, id, rec); err != nil {
 		return err
 	}
 
-	tableFile.offsets[id] = offset
+	if err := tableFile.insertRec(id, rec); err != nil {
+		return err
+	}
 
-	return nil
+	return dsk.maybeCheckpoint()
 }
 
 // ReadRec takes a table name and an id, reads the record from the
@@ -154,18 +328,42 @@ func (dsk *Disk) ReadRec(tableName string, id int) ([]byte, error) {
 // RemoveTable takes a table name and deletes that table file from the
 // disk.
 func (dsk *Disk) RemoveTable(tableName string) error {
+	if dsk.readOnly() {
+		return dberr.ErrReadOnly
+	}
+
 	tableFile, err := dsk.getTableFile(tableName)
 	if err != nil {
 		return err
 	}
 
+	// Make sure nothing is left in the write-ahead log that could be
+	// replayed into a new table with the same name.
+	if err := dsk.Checkpoint(); err != nil {
+		return err
+	}
+
 	tableFile.close()
 
-	if err := os.Remove(dsk.path + "/" + tableName + dsk.ext); err != nil {
+	if err := os.Remove(dsk.tablePath(tableName)); err != nil {
 		return err
 	}
 
+	if err := os.Remove(dsk.indexPath(tableName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.Remove(dsk.seqPath(tableName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.Remove(dsk.fieldIndexPath(tableName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	dsk.tablesLock.Lock()
 	delete(dsk.tableFiles, tableName)
+	dsk.tablesLock.Unlock()
 
 	return nil
 }
@@ -173,13 +371,38 @@ func (dsk *Disk) RemoveTable(tableName string) error {
 // TableExists takes a table name and returns a bool indicating
 // whether or not the table exists in the datastore.
 func (dsk *Disk) TableExists(tableName string) bool {
+	dsk.tablesLock.RLock()
+	defer dsk.tablesLock.RUnlock()
+
 	_, ok := dsk.tableFiles[tableName]
 
 	return ok
 }
 
+// TableMeta takes a table name and returns the settings written in the
+// table's header.
+func (dsk *Disk) TableMeta(tableName string) (map[string]string, error) {
+	tableFile, err := dsk.getTableFile(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := make(map[string]string)
+	for name, value := range tableFile.meta {
+		meta[name] = value
+	}
+
+	// The dictionary is of no use outside the table file.
+	delete(meta, metaDictionary)
+
+	return meta, nil
+}
+
 // TableNames returns an array of table names.
 func (dsk *Disk) TableNames() []string {
+	dsk.tablesLock.RLock()
+	defer dsk.tablesLock.RUnlock()
+
 	var names []string
 
 	for k := range dsk.tableFiles {
@@ -192,23 +415,63 @@ func (dsk *Disk) TableNames() []string {
 // UpdateRec takes a table name, a record id, and a byte array and updates
 // the table record with that id.
 func (dsk *Disk) UpdateRec(tableName string, id int, rec []byte) error {
+	if dsk.readOnly() {
+		return dberr.ErrReadOnly
+	}
+
+	dsk.lockWAL()
+	defer dsk.unlockWAL()
+
 	tableFile, err := dsk.getTableFile(tableName)
 	if err != nil {
 		return err
 	}
 
+	if _, ok := tableFile.offsets[id]; !ok {
+		return dberr.ErrNoRecord
+	}
+
+	if err := dsk.journal(opUpdate, tableName, id); err != nil {
+		return err
+	}
+
+	if err := dsk.logWrite(opUpdate, tableName, id, rec); err != nil {
+		return err
+	}
+
 	if err = tableFile.updateRec(id, rec); err != nil {
 		return err
 	}
 
-	return nil
+	if err := dsk.maybeCompact(tableName, tableFile); err != nil {
+		return err
+	}
+
+	return dsk.maybeCheckpoint()
 }
 
 //******************************************************************************
 // UNEXPORTED METHODS
 //******************************************************************************
 
+// allTableFiles returns the table files in the datastore.
+func (dsk *Disk) allTableFiles() []*tableFile {
+	dsk.tablesLock.RLock()
+	defer dsk.tablesLock.RUnlock()
+
+	tableFiles := make([]*tableFile, 0, len(dsk.tableFiles))
+
+	for _, tableFile := range dsk.tableFiles {
+		tableFiles = append(tableFiles, tableFile)
+	}
+
+	return tableFiles
+}
+
 func (dsk *Disk) getTableFile(tableName string) (*tableFile, error) {
+	dsk.tablesLock.RLock()
+	defer dsk.tablesLock.RUnlock()
+
 	tableFile, ok := dsk.tableFiles[tableName]
 	if !ok {
 		return nil, dberr.ErrNoTable
@@ -243,41 +506,118 @@ func (dsk *Disk) getTableNames() ([]string, error) {
 	return tableNames, nil
 }
 
+func (dsk *Disk) indexPath(tableName string) string {
+	return dsk.path + "/" + tableName + dsk.ext + indexExt
+}
+
 func (dsk *Disk) init() error {
 	dsk.tableFiles = make(map[string]*tableFile)
 
+	if err := dsk.lockDir(); err != nil {
+		return err
+	}
+
 	tableNames, err := dsk.getTableNames()
 	if err != nil {
 		return err
 	}
 
 	for _, tableName := range tableNames {
-		filePtr, err := dsk.openFile(tableName, false)
-		if err != nil {
+		if err := dsk.loadTable(tableName, false); err != nil {
 			return err
 		}
+	}
 
-		tableFile, err := newTableFile(tableName, filePtr)
-		if err != nil {
+	// A read-only datastore leaves recovery to the next process that
+	// opens the directory for writing.
+	if dsk.readOnly() {
+		return nil
+	}
+
+	if err := dsk.replayWAL(); err != nil {
+		return err
+	}
+
+	if err := dsk.recoverJournal(); err != nil {
+		return err
+	}
+
+	if dsk.opts.WAL {
+		if err := dsk.openWAL(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadTable takes a table name, opens the table file, and adds it to
+// the map of tables in the datastore.
+func (dsk *Disk) loadTable(tableName string, createIfNeeded bool) error {
+	filePtr, err := dsk.openFile(tableName, createIfNeeded)
+	if err != nil {
+		return err
+	}
+
+	tableFile, err := openTableFile(tableName, filePtr, dsk.indexPath(tableName), dsk.opts.Lenient)
+	if err != nil {
+		filePtr.Close()
+		return err
+	}
+
+	tableFile.fit = dsk.opts.FitPolicy
+	tableFile.crypt = dsk.crypt
+
+	if tableFile.meta[metaEncryption] != "" && tableFile.crypt == nil {
+		tableFile.ptr.Close()
+		return errNoKeyProvider
+	}
+
+	if err := tableFile.loadSeq(dsk.seqPath(tableName)); err != nil {
+		tableFile.ptr.Close()
+		return err
+	}
+
+	if !dsk.readOnly() {
+		if err := tableFile.trimTorn(dsk.tablePath(tableName) + quarantineExt); err != nil {
+			tableFile.ptr.Close()
 			return err
 		}
+	}
 
-		dsk.tableFiles[tableName] = tableFile
+	if tableFile.stamp, err = stampFile(filePtr); err != nil {
+		tableFile.ptr.Close()
+		return err
+	}
+
+	if dsk.readOnly() {
+		tableFile.indexPath = ""
+		tableFile.seqPath = ""
+	} else {
+		tableFile.fieldIndexPath = dsk.fieldIndexPath(tableName)
+		tableFile.fieldIndexLive = true
 	}
 
+	dsk.tablesLock.Lock()
+	dsk.tableFiles[tableName] = tableFile
+	dsk.tablesLock.Unlock()
+
 	return nil
 }
 
-func (dsk Disk) openFile(tableName string, createIfNeeded bool) (*os.File, error) {
+func (dsk *Disk) openFile(tableName string, createIfNeeded bool) (*os.File, error) {
 	var osFlag int
 
-	if createIfNeeded {
+	switch {
+	case dsk.readOnly():
+		osFlag = os.O_RDONLY
+	case createIfNeeded:
 		osFlag = os.O_CREATE | os.O_RDWR
-	} else {
+	default:
 		osFlag = os.O_RDWR
 	}
 
-	filePtr, err := os.OpenFile(dsk.path+"/"+tableName+dsk.ext, osFlag, 0660)
+	filePtr, err := os.OpenFile(dsk.tablePath(tableName), osFlag, 0660)
 	if err != nil {
 		return nil, err
 	}
@@ -285,10 +625,14 @@ func (dsk Disk) openFile(tableName string, createIfNeeded bool) (*os.File, error
 	return filePtr, nil
 }
 
+func (dsk *Disk) tablePath(tableName string) string {
+	return dsk.path + "/" + tableName + dsk.ext
+}
+
 func (dsk *Disk) closeTable(tableName string) error {
-	tableFile, ok := dsk.tableFiles[tableName]
-	if !ok {
-		return dberr.ErrNoTable
+	tableFile, err := dsk.getTableFile(tableName)
+	if err != nil {
+		return err
 	}
 
 	if err := tableFile.close(); err != nil {
@@ -214,6 +214,27 @@ func TestIDsDiskTests(t *testing.T) {
 				}
 			}
 		},
+		func(t *testing.T) {
+			//IDsInFileOrder...
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			// Growing record 1 moves it to the end of the file.
+			if err := dsk.UpdateRec("contacts", 1, []byte(`{"id":1,"first_name":"Jonathan","last_name":"Doestoevsky","age":37}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			want := []int{2, 3, 4, 1}
+			got, err := dsk.IDsInFileOrder("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
 		func(t *testing.T) {
 			//IDs (NoTable error)...
 
@@ -0,0 +1,191 @@
+package disk
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// KeyProvider hands out the AES keys used to encrypt records.  Every
+// encrypted record remembers the id of the key it was encrypted with, so
+// keys can be rotated: new records use the current key, older records
+// are still read with the key they were written with, and compacting a
+// table re-encrypts every record with the current key.
+type KeyProvider interface {
+	// CurrentKey returns the id and the value of the key new records
+	// are encrypted with.  The key must be 16, 24, or 32 bytes long.
+	CurrentKey() (string, []byte, error)
+
+	// Key takes a key id and returns the value of that key.
+	Key(string) ([]byte, error)
+}
+
+// Keyring is a KeyProvider that holds its keys in memory.
+type Keyring struct {
+	// Current is the id of the key new records are encrypted with.
+	Current string
+
+	// Keys maps key ids to keys.
+	Keys map[string][]byte
+}
+
+// CurrentKey returns the id and the value of the current key.
+func (k Keyring) CurrentKey() (string, []byte, error) {
+	key, err := k.Key(k.Current)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return k.Current, key, nil
+}
+
+// Key takes a key id and returns the value of that key.
+func (k Keyring) Key(keyID string) ([]byte, error) {
+	key, ok := k.Keys[keyID]
+	if !ok {
+		return nil, errUnknownKey
+	}
+
+	return key, nil
+}
+
+const (
+	metaEncryption   = "encryption"
+	encryptionAESGCM = "aes-gcm"
+)
+
+var errUnknownKey = errors.New("hare: key provider does not have that key")
+
+var errNoKeyProvider = errors.New("hare: table is encrypted but no key provider was given")
+
+var errUnknownEncryption = errors.New("hare: table uses an unknown encryption")
+
+// crypter encrypts and decrypts records, keeping a cipher for each key
+// it has seen.
+type crypter struct {
+	sync.Mutex
+	keys  KeyProvider
+	aeads map[string]cipher.AEAD
+}
+
+func newCrypter(keys KeyProvider) *crypter {
+	return &crypter{keys: keys, aeads: make(map[string]cipher.AEAD)}
+}
+
+// currentKeyID returns the id of the key new records are encrypted with.
+func (c *crypter) currentKeyID() (string, error) {
+	keyID, _, err := c.keys.CurrentKey()
+
+	return keyID, err
+}
+
+// encrypt takes the table name and record id, which the ciphertext is
+// bound to so it cannot be moved to another record, and a record, and
+// returns the key id, the nonce, and the sealed record.
+func (c *crypter) encrypt(tableName string, id int, rec []byte) ([]byte, error) {
+	keyID, key, err := c.keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := c.aead(keyID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 1+len(keyID)+aead.NonceSize(), 1+len(keyID)+aead.NonceSize()+len(rec)+aead.Overhead())
+	data[0] = byte(len(keyID))
+	copy(data[1:], keyID)
+
+	nonce := data[1+len(keyID):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(data, nonce, rec, additionalData(tableName, id)), nil
+}
+
+// decrypt takes the table name and record id and a record written by
+// encrypt, and returns the record, or dberr.ErrTampered if it does not
+// authenticate.
+func (c *crypter) decrypt(tableName string, id int, data []byte) ([]byte, error) {
+	keyID, rest, err := splitKeyID(data)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := c.aead(keyID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) < aead.NonceSize()+aead.Overhead() {
+		return nil, dberr.ErrTampered
+	}
+
+	rec, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], additionalData(tableName, id))
+	if err != nil {
+		return nil, dberr.ErrTampered
+	}
+
+	return rec, nil
+}
+
+// aead takes a key id and, if the caller already has it, the key, and
+// returns the cipher for that key.
+func (c *crypter) aead(keyID string, key []byte) (cipher.AEAD, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if aead, ok := c.aeads[keyID]; ok {
+		return aead, nil
+	}
+
+	if key == nil {
+		var err error
+
+		if key, err = c.keys.Key(keyID); err != nil {
+			return nil, err
+		}
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	c.aeads[keyID] = aead
+
+	return aead, nil
+}
+
+func additionalData(tableName string, id int) []byte {
+	ad := make([]byte, len(tableName)+8)
+
+	copy(ad, tableName)
+	binary.BigEndian.PutUint64(ad[len(tableName):], uint64(id))
+
+	return ad
+}
+
+// splitKeyID takes an encrypted record and returns the id of the key it
+// was encrypted with and the rest of the record.
+func splitKeyID(data []byte) (string, []byte, error) {
+	if len(data) == 0 || len(data) < 1+int(data[0]) {
+		return "", nil, dberr.ErrTampered
+	}
+
+	keyLen := int(data[0])
+
+	return string(data[1 : 1+keyLen]), data[1+keyLen:], nil
+}
@@ -0,0 +1,257 @@
+package disk
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func testKeyring() Keyring {
+	return Keyring{
+		Current: "k1",
+		Keys: map[string][]byte{
+			"k1": bytes.Repeat([]byte{1}, 32),
+			"k2": bytes.Repeat([]byte{2}, 16),
+		},
+	}
+}
+
+func TestCrypterTests(t *testing.T) {
+	c := newCrypter(testKeyring())
+	rec := []byte(`{"id":1,"first_name":"John"}`)
+
+	data, err := c.encrypt("contacts", 1, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.decrypt("contacts", 1, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(rec, got) {
+		t.Errorf("want %s; got %s", rec, got)
+	}
+
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-1] ^= 1
+
+	for _, tt := range []struct {
+		tableName string
+		id        int
+		data      []byte
+	}{
+		{"contacts", 1, tampered},
+		{"contacts", 2, data},
+		{"hosts", 1, data},
+		{"contacts", 1, data[:10]},
+		{"contacts", 1, []byte{40}},
+	} {
+		_, gotErr := c.decrypt(tt.tableName, tt.id, tt.data)
+
+		if !errors.Is(gotErr, dberr.ErrTampered) {
+			t.Errorf("want %v; got %v", dberr.ErrTampered, gotErr)
+		}
+	}
+
+	if _, err := newCrypter(Keyring{Current: "nope"}).encrypt("contacts", 1, rec); !errors.Is(err, errUnknownKey) {
+		t.Errorf("want %v; got %v", errUnknownKey, err)
+	}
+}
+
+func TestEncryptionDiskTests(t *testing.T) {
+	secret := []byte(`{"id":5,"first_name":"Secret","last_name":"Agent","age":42}`)
+
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//InsertRec and ReadRec (encrypted table)...
+
+			dsk := newTestDiskWithOptions(t, Options{Encryption: testKeyring()})
+
+			if err := dsk.CreateTable("newtable"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.InsertRec("newtable", 5, secret); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := ioutil.ReadFile("./testdata/newtable.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if bytes.Contains(data, []byte("Secret")) {
+				t.Error("want the record encrypted on disk")
+			}
+
+			if _, err := os.Stat("./testdata/newtable.json" + indexExt); err != nil {
+				t.Errorf("want an offset index; got %v", err)
+			}
+
+			if _, err := New("./testdata", ".json"); !errors.Is(err, errNoKeyProvider) {
+				t.Errorf("want %v; got %v", errNoKeyProvider, err)
+			}
+
+			dsk = newTestDiskWithOptions(t, Options{Encryption: testKeyring()})
+
+			got, err := dsk.ReadRec("newtable", 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(secret, got) {
+				t.Errorf("want %s; got %s", secret, got)
+			}
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Flip a bit in the last byte of the record.
+			data[len(data)-1] ^= 1
+			if err := ioutil.WriteFile("./testdata/newtable.json", data, 0660); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk = newTestDiskWithOptions(t, Options{Encryption: testKeyring()})
+			defer dsk.Close()
+
+			_, gotErr := dsk.ReadRec("newtable", 5)
+
+			if !errors.Is(gotErr, dberr.ErrTampered) {
+				t.Errorf("want %v; got %v", dberr.ErrTampered, gotErr)
+			}
+		},
+		func(t *testing.T) {
+			//Compact (encrypts a plain table and rotates keys)...
+
+			keys := testKeyring()
+
+			dsk := newTestDiskWithOptions(t, Options{Encryption: keys})
+
+			if err := dsk.Compact("contacts"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.InsertRec("contacts", 5, secret); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Rotate to the second key, compact, and then drop the
+			// first key.
+			keys.Current = "k2"
+
+			dsk = newTestDiskWithOptions(t, Options{Encryption: keys})
+
+			if err := dsk.Compact("contacts"); err != nil {
+				t.Fatal(err)
+			}
+
+			tableFile := dsk.tableFiles["contacts"]
+
+			for _, id := range tableFile.ids() {
+				f, err := tableFile.readFrameAt(tableFile.offsets[id])
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				keyID, _, err := splitKeyID(f.rec)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if keyID != "k2" {
+					t.Errorf("want record %v encrypted with k2; got %v", id, keyID)
+				}
+			}
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			delete(keys.Keys, "k1")
+
+			dsk = newTestDiskWithOptions(t, Options{Encryption: keys})
+			defer dsk.Close()
+
+			got, err := dsk.ReadRec("contacts", 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(secret, got) {
+				t.Errorf("want %s; got %s", secret, got)
+			}
+
+			want := []byte(`{"id":1,"first_name":"John","last_name":"Doe","age":37}`)
+
+			if got, err = dsk.ReadRec("contacts", 1); err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(want, got) {
+				t.Errorf("want %s; got %s", want, got)
+			}
+		},
+		func(t *testing.T) {
+			//replayWAL (encrypted table)...
+
+			opts := Options{Encryption: testKeyring(), WAL: true}
+
+			dsk := newTestDiskWithOptions(t, opts)
+
+			if err := dsk.CreateTable("newtable"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.InsertRec("newtable", 5, secret); err != nil {
+				t.Fatal(err)
+			}
+
+			killTestDisk(t, dsk)
+
+			data, err := ioutil.ReadFile("./testdata/" + walFileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if bytes.Contains(data, []byte("Secret")) {
+				t.Error("want the record encrypted in the write-ahead log")
+			}
+
+			// Throw away the table file changes, as if they never
+			// made it to disk.
+			if err := os.Truncate("./testdata/newtable.json", headerBlock); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk = newTestDiskWithOptions(t, opts)
+			defer dsk.Close()
+
+			got, err := dsk.ReadRec("newtable", 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(secret, got) {
+				t.Errorf("want %s; got %s", secret, got)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
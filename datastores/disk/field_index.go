@@ -0,0 +1,152 @@
+package disk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// The field index file is a sidecar file written next to a table file
+// that holds the indexes a Database keeps on the table's json fields, so
+// they do not have to be built again by reading every record.  Like the
+// offset index, it is stamped with the table file's size, modification
+// time, and a checksum of the end of the table file, and it is removed
+// the first time the table is written to after it was loaded or saved.
+// The indexes of an encrypted table are encrypted too, since they hold
+// field values.
+const (
+	fieldIndexExt   = ".fdx"
+	fieldIndexMagic = "HAREFDX1"
+)
+
+// LoadFieldIndexes takes a table name and returns the field indexes
+// last saved with SaveFieldIndexes, or nil if there are none or the
+// table has been written to since.
+func (dsk *Disk) LoadFieldIndexes(tableName string) ([]byte, error) {
+	tableFile, err := dsk.getTableFile(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(dsk.fieldIndexPath(tableName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < len(fieldIndexMagic)+4 || string(data[:len(fieldIndexMagic)]) != fieldIndexMagic {
+		return nil, nil
+	}
+
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+		return nil, nil
+	}
+
+	r := bytes.NewReader(body[len(fieldIndexMagic):])
+
+	stamp, err := readStamp(r)
+	if err != nil {
+		return nil, nil
+	}
+
+	current, err := stampFile(tableFile.ptr)
+	if err != nil {
+		return nil, err
+	}
+
+	if stamp != current {
+		return nil, nil
+	}
+
+	indexes := body[len(body)-r.Len():]
+
+	if tableFile.meta[metaEncryption] != "" {
+		return tableFile.crypt.decrypt(tableName, 0, indexes)
+	}
+
+	return indexes, nil
+}
+
+// SaveFieldIndexes takes a table name and the table's field indexes,
+// encoded by the caller, and writes them next to the table file.
+func (dsk *Disk) SaveFieldIndexes(tableName string, indexes []byte) error {
+	if dsk.readOnly() {
+		return dberr.ErrReadOnly
+	}
+
+	tableFile, err := dsk.getTableFile(tableName)
+	if err != nil {
+		return err
+	}
+
+	// No record has id 0, so the encrypted indexes cannot be passed off
+	// as one.
+	if tableFile.meta[metaEncryption] != "" {
+		if indexes, err = tableFile.crypt.encrypt(tableName, 0, indexes); err != nil {
+			return err
+		}
+	}
+
+	stamp, err := stampFile(tableFile.ptr)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteString(fieldIndexMagic)
+	writeUvarint(&buf, uint64(stamp.size))
+	writeVarint(&buf, stamp.modTime)
+	writeUvarint(&buf, uint64(stamp.tailSum))
+	buf.Write(indexes)
+
+	sum := crc32.ChecksumIEEE(buf.Bytes())
+	if err := binary.Write(&buf, binary.BigEndian, sum); err != nil {
+		return err
+	}
+
+	tmpPath := tableFile.fieldIndexPath + ".tmp"
+
+	if err := ioutil.WriteFile(tmpPath, buf.Bytes(), 0660); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, tableFile.fieldIndexPath); err != nil {
+		return err
+	}
+
+	tableFile.fieldIndexLive = true
+
+	return nil
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+func (dsk *Disk) fieldIndexPath(tableName string) string {
+	return dsk.path + "/" + tableName + dsk.ext + fieldIndexExt
+}
+
+// invalidateFieldIndex removes the field index the first time the table
+// is written to after the index was loaded or saved.
+func (t *tableFile) invalidateFieldIndex() error {
+	if t.fieldIndexPath == "" || !t.fieldIndexLive {
+		return nil
+	}
+
+	if err := os.Remove(t.fieldIndexPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	t.fieldIndexLive = false
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package disk
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestFieldIndexTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//SaveFieldIndexes and LoadFieldIndexes...
+
+			dsk := newTestDisk(t)
+
+			want := `{"last_name":{"\"Doe\"":[1]}}`
+
+			if err := dsk.SaveFieldIndexes("contacts", []byte(want)); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk.Close()
+
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			got, err := dsk.LoadFieldIndexes("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want != string(got) {
+				t.Errorf("want %v; got %s", want, got)
+			}
+		},
+		func(t *testing.T) {
+			//LoadFieldIndexes (table written to since)...
+
+			dsk := newTestDisk(t)
+
+			if err := dsk.SaveFieldIndexes("contacts", []byte(`{}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk.Close()
+
+			dsk = newTestDisk(t)
+
+			if err := dsk.DeleteRec("contacts", 1); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := os.Stat("./testdata/contacts.json" + fieldIndexExt); !os.IsNotExist(err) {
+				t.Errorf("want field index removed; got %v", err)
+			}
+
+			if err := dsk.SaveFieldIndexes("contacts", []byte(`{}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk.Close()
+
+			// A write the datastore did not make is caught by the stamp.
+			f, err := os.OpenFile("./testdata/contacts.json", os.O_APPEND|os.O_WRONLY, 0660)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := f.WriteString("{\"id\":5,\"first_name\":\"Rex\",\"last_name\":\"Stout\",\"age\":77}\n"); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			got, err := dsk.LoadFieldIndexes("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != nil {
+				t.Errorf("want %v; got %s", nil, got)
+			}
+		},
+		func(t *testing.T) {
+			//SaveFieldIndexes (encrypted table)...
+
+			dsk := newTestDiskWithOptions(t, Options{Encryption: testKeyring()})
+
+			if err := dsk.CreateTable("newtable"); err != nil {
+				t.Fatal(err)
+			}
+
+			want := `{"last_name":{"\"Secret\"":[1]}}`
+
+			if err := dsk.SaveFieldIndexes("newtable", []byte(want)); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk.Close()
+
+			data, err := ioutil.ReadFile("./testdata/newtable.json" + fieldIndexExt)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if bytes.Contains(data, []byte("Secret")) {
+				t.Errorf("want field index encrypted; got %s", data)
+			}
+
+			dsk = newTestDiskWithOptions(t, Options{Encryption: testKeyring()})
+			defer dsk.Close()
+
+			got, err := dsk.LoadFieldIndexes("newtable")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want != string(got) {
+				t.Errorf("want %v; got %s", want, got)
+			}
+		},
+		func(t *testing.T) {
+			//SaveFieldIndexes (ErrReadOnly error)...
+
+			dsk := newTestDisk(t)
+
+			if err := dsk.SaveFieldIndexes("contacts", []byte(`{}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk.Close()
+
+			dsk = newTestDiskWithOptions(t, Options{ReadOnly: true})
+			defer dsk.Close()
+
+			wantErr := dberr.ErrReadOnly
+			gotErr := dsk.SaveFieldIndexes("contacts", []byte(`{}`))
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+
+			got, err := dsk.LoadFieldIndexes("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != `{}` {
+				t.Errorf("want %v; got %s", `{}`, got)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
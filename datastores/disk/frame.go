@@ -0,0 +1,334 @@
+package disk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"github.com/jameycribbs/hare/keys"
+)
+
+// A binary frame starts with a tag, the length of the record, and the
+// record id, so records can hold any bytes, newlines included.  Dummy
+// frames have the same header, with a zero id, followed by filler.  A
+// table with checksums adds a crc32 of the header and record after the
+// id.
+const (
+	binaryOverhead = 13
+	binaryRecTag   = 'R'
+	binaryDummyTag = 'X'
+
+	checksumLen = 4
+)
+
+// A line with a checksum ends with a space and the crc32 of the json, in
+// hex, before its newline.
+const lineChecksumLen = 1 + 2*checksumLen
+
+// corruptFrameError is returned by a framer for a frame it cannot use.
+// Size is the length of the frame, or 0 if the frame's length cannot be
+// told, in which case nothing after it can be read either.  Truncated
+// is true for a frame cut short by the end of the file.
+type corruptFrameError struct {
+	reason    string
+	size      int
+	truncated bool
+}
+
+func (e *corruptFrameError) Error() string {
+	return "hare: corrupt frame: " + e.reason
+}
+
+// framer turns records into the bytes written to a table file, and
+// back.
+type framer interface {
+	// dummy takes the length of a slot and returns a dummy frame that
+	// fills it.
+	dummy(slotLen int) []byte
+
+	// frame takes a record id, a record, and the length of the slot
+	// it is going into and returns the bytes to write.  If the slot is
+	// longer than the record needs, the rest is filled with a dummy.
+	frame(id int, rec []byte, slotLen int) []byte
+
+	// overhead returns the number of bytes a frame adds to a record.
+	overhead() int
+
+	// read reads the frame at the reader's position.  The record id is
+	// only decoded if wantID is true.
+	read(r *bufio.Reader, wantID bool) (frame, error)
+
+	// trim takes a record as returned by read and returns it the way
+	// it was written.
+	trim(rec []byte) []byte
+}
+
+// frame is a frame read from a table file.  Rec is nil for a dummy.
+type frame struct {
+	id   int
+	rec  []byte
+	size int
+}
+
+// lineFramer writes each record as a line of json.  Records are read
+// back with their newline, the way ReadRec has always returned them.
+// In a table with string keys, the id of a record is the hash of the
+// string in its id field.
+type lineFramer struct {
+	checksum bool
+	keyed    bool
+}
+
+func (lineFramer) dummy(slotLen int) []byte {
+	dummyData := make([]byte, slotLen)
+
+	for i := range dummyData {
+		dummyData[i] = dummyRune
+	}
+	dummyData[slotLen-1] = '\n'
+
+	return dummyData
+}
+
+func (l lineFramer) frame(id int, rec []byte, slotLen int) []byte {
+	data := make([]byte, 0, slotLen)
+	data = append(data, rec...)
+
+	if l.checksum {
+		data = append(data, ' ')
+		data = hex.AppendEncode(data, crc32Bytes(rec))
+	}
+
+	if padLength := slotLen - len(rec) - l.overhead(); padLength > 0 {
+		data = append(data, padRec(padLength)...)
+	}
+
+	return append(data, '\n')
+}
+
+func (l lineFramer) overhead() int {
+	if l.checksum {
+		return 1 + lineChecksumLen
+	}
+
+	return 1
+}
+
+func (l lineFramer) read(r *bufio.Reader, wantID bool) (frame, error) {
+	rec, err := r.ReadBytes('\n')
+	if err == io.EOF && len(rec) > 0 {
+		return frame{}, &corruptFrameError{reason: "record is cut short", size: len(rec), truncated: true}
+	}
+	if err != nil {
+		return frame{}, err
+	}
+
+	// Dummy records.
+	if (rec[0] == '\n') || (rec[0] == dummyRune) {
+		return frame{size: len(rec)}, nil
+	}
+
+	f := frame{rec: rec, size: len(rec)}
+
+	if l.checksum {
+		body := rec[:len(rec)-1]
+		sumAt := len(body) - lineChecksumLen
+
+		if sumAt < 0 || body[sumAt] != ' ' {
+			return frame{}, &corruptFrameError{reason: "checksum is missing", size: f.size}
+		}
+
+		sum, err := hex.DecodeString(string(body[sumAt+1:]))
+		if err != nil || !bytes.Equal(sum, crc32Bytes(body[:sumAt])) {
+			return frame{}, &corruptFrameError{reason: "checksum does not match", size: f.size}
+		}
+
+		f.rec = append(body[:sumAt:sumAt], '\n')
+	}
+
+	if wantID {
+		id, err := lineID(f.rec, l.keyed)
+		if err != nil {
+			return frame{}, &corruptFrameError{reason: reasonFor(err), size: f.size}
+		}
+		f.id = id
+	}
+
+	return f, nil
+}
+
+func (lineFramer) trim(rec []byte) []byte {
+	return bytes.TrimSuffix(rec, []byte{'\n'})
+}
+
+// binaryFramer writes each record with a length prefix, for codecs that
+// do not produce a single line of text.
+type binaryFramer struct {
+	checksum bool
+}
+
+func (b binaryFramer) dummy(slotLen int) []byte {
+	dummyData := make([]byte, slotLen)
+
+	dummyData[0] = binaryDummyTag
+	binary.BigEndian.PutUint32(dummyData[1:5], uint32(slotLen-b.overhead()))
+
+	return dummyData
+}
+
+func (b binaryFramer) frame(id int, rec []byte, slotLen int) []byte {
+	overhead := b.overhead()
+
+	if slotLen < len(rec)+overhead {
+		slotLen = len(rec) + overhead
+	}
+
+	data := make([]byte, overhead, slotLen)
+
+	data[0] = binaryRecTag
+	binary.BigEndian.PutUint32(data[1:5], uint32(len(rec)))
+	binary.BigEndian.PutUint64(data[5:13], uint64(id))
+	data = append(data, rec...)
+
+	if b.checksum {
+		copy(data[binaryOverhead:overhead], binarySum(data[:binaryOverhead], rec))
+	}
+
+	if rest := slotLen - len(data); rest > 0 {
+		data = append(data, b.dummy(rest)...)
+	}
+
+	return data
+}
+
+func (b binaryFramer) overhead() int {
+	if b.checksum {
+		return binaryOverhead + checksumLen
+	}
+
+	return binaryOverhead
+}
+
+func (b binaryFramer) read(r *bufio.Reader, wantID bool) (frame, error) {
+	overhead := b.overhead()
+	header := make([]byte, overhead)
+
+	// A frame cut short by a crash at the end of the file is reported
+	// as truncated, the same as a line without its newline.
+	if n, err := io.ReadFull(r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return frame{}, &corruptFrameError{reason: "frame header is cut short", size: n, truncated: true}
+		}
+		return frame{}, err
+	}
+
+	recLen := int(binary.BigEndian.Uint32(header[1:5]))
+	f := frame{size: overhead + recLen}
+
+	switch header[0] {
+	case binaryDummyTag:
+		if n, err := r.Discard(recLen); err != nil {
+			return frame{}, &corruptFrameError{reason: "dummy is cut short", size: overhead + n, truncated: true}
+		}
+
+		return f, nil
+	case binaryRecTag:
+	default:
+		return frame{}, &corruptFrameError{reason: "frame has an unknown tag"}
+	}
+
+	f.id = int(binary.BigEndian.Uint64(header[5:13]))
+	f.rec = make([]byte, recLen)
+
+	if n, err := io.ReadFull(r, f.rec); err != nil {
+		return frame{}, &corruptFrameError{reason: "record is cut short", size: overhead + n, truncated: true}
+	}
+
+	if b.checksum && !bytes.Equal(header[binaryOverhead:], binarySum(header[:binaryOverhead], f.rec)) {
+		return frame{}, &corruptFrameError{reason: "checksum does not match", size: f.size}
+	}
+
+	return f, nil
+}
+
+func (binaryFramer) trim(rec []byte) []byte {
+	return rec
+}
+
+// binarySum takes a binary frame's header, without its checksum, and
+// record and returns their checksum.
+func binarySum(header []byte, rec []byte) []byte {
+	sum := crc32.Update(crc32.ChecksumIEEE(header), crc32.IEEETable, rec)
+
+	return binary.BigEndian.AppendUint32(nil, sum)
+}
+
+// crc32Bytes takes some bytes and returns their checksum.
+func crc32Bytes(data []byte) []byte {
+	return binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(data))
+}
+
+// lineID takes a line of json and whether the table has string keys,
+// and returns its record id.
+func lineID(rec []byte, keyed bool) (int, error) {
+	if keyed {
+		return lineKeyID(rec)
+	}
+
+	var idRec struct {
+		ID *float64 `json:"id"`
+	}
+
+	if err := json.Unmarshal(rec, &idRec); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return 0, errBadID
+		}
+
+		return 0, errBadJSON
+	}
+
+	if idRec.ID == nil {
+		return 0, errNoID
+	}
+
+	id := *idRec.ID
+	if id != math.Trunc(id) || math.Abs(id) > math.MaxInt64/2 {
+		return 0, errBadID
+	}
+
+	return int(id), nil
+}
+
+// lineKeyID takes a line of json from a table with string keys and
+// returns its record id.
+func lineKeyID(rec []byte) (int, error) {
+	var keyRec struct {
+		Key *string `json:"id"`
+	}
+
+	if err := json.Unmarshal(rec, &keyRec); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return 0, errBadKey
+		}
+
+		return 0, errBadJSON
+	}
+
+	if keyRec.Key == nil {
+		return 0, errNoID
+	}
+
+	if *keyRec.Key == "" {
+		return 0, errBadKey
+	}
+
+	return keys.ID(*keyRec.Key), nil
+}
@@ -0,0 +1,221 @@
+package disk
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/jameycribbs/hare/keys"
+)
+
+func TestBinaryFrameDiskTests(t *testing.T) {
+	binaryMeta := map[string]string{"codec": "test", metaFrames: framesBinary}
+
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//CreateTableWithMeta and TableMeta...
+
+			dsk := newTestDisk(t)
+
+			if err := dsk.CreateTableWithMeta("newtable", binaryMeta); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			want := binaryMeta
+			got, err := dsk.TableMeta("newtable")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			got, err = dsk.TableMeta("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != 0 {
+				t.Errorf("want no settings; got %v", got)
+			}
+		},
+		func(t *testing.T) {
+			//InsertRec, UpdateRec, and DeleteRec (binary frames)...
+
+			dsk := newTestDisk(t)
+
+			if err := dsk.CreateTableWithMeta("newtable", binaryMeta); err != nil {
+				t.Fatal(err)
+			}
+
+			recs := map[int][]byte{
+				1: {0x0a, 0x00, 'X', 0x0a},
+				2: []byte("second\nrecord"),
+				3: {0xff},
+			}
+
+			for id := 1; id <= 3; id++ {
+				if err := dsk.InsertRec("newtable", id, recs[id]); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Shrinking by less than a frame header moves the record.
+			recs[2] = []byte("second\nrec")
+			if err := dsk.UpdateRec("newtable", 2, recs[2]); err != nil {
+				t.Fatal(err)
+			}
+
+			// Growing moves the record to the end of the file.
+			recs[1] = []byte("a much longer first record\n")
+			if err := dsk.UpdateRec("newtable", 1, recs[1]); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.DeleteRec("newtable", 3); err != nil {
+				t.Fatal(err)
+			}
+			delete(recs, 3)
+
+			// A small record fits into the space left behind.
+			recs[4] = []byte{0x0a}
+			if err := dsk.InsertRec("newtable", 4, recs[4]); err != nil {
+				t.Fatal(err)
+			}
+
+			checkRecs := func(dsk *Disk) {
+				for id, want := range recs {
+					got, err := dsk.ReadRec("newtable", id)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if !reflect.DeepEqual(want, got) {
+						t.Errorf("id %v: want %q; got %q", id, want, got)
+					}
+				}
+			}
+
+			checkRecs(dsk)
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Reopen with the offset index, then without it.
+			dsk = newTestDisk(t)
+			checkRecs(dsk)
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.Remove("./testdata/newtable.json" + indexExt); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			checkRecs(dsk)
+
+			tableFile := dsk.tableFiles["newtable"]
+			deadBefore := tableFile.deadBytes()
+
+			if err := dsk.Compact("newtable"); err != nil {
+				t.Fatal(err)
+			}
+
+			if deadBefore == 0 || tableFile.deadBytes() != 0 {
+				t.Errorf("want dead bytes to go from more than 0 to 0; got %v and %v", deadBefore, tableFile.deadBytes())
+			}
+
+			checkRecs(dsk)
+
+			got, err := dsk.TableMeta("newtable")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(binaryMeta, got) {
+				t.Errorf("want %v; got %v", binaryMeta, got)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
+
+func TestLineIDTests(t *testing.T) {
+	tests := []struct {
+		rec     string
+		keyed   bool
+		wantID  int
+		wantErr error
+	}{
+		{`{"id":3,"name":"Bill"}`, false, 3, nil},
+		{`{"name":"Bill"}`, false, 0, errNoID},
+		{`{"id":"3"}`, false, 0, errBadID},
+		{`{"id":3.5}`, false, 0, errBadID},
+		{`{"id":3,"name":"Bi`, false, 0, errBadJSON},
+		{`{"id":"bill"}`, true, keys.ID("bill"), nil},
+		{`{"id":3}`, true, 0, errBadKey},
+		{`{"id":""}`, true, 0, errBadKey},
+		{`{"name":"Bill"}`, true, 0, errNoID},
+	}
+
+	for _, tt := range tests {
+		gotID, gotErr := lineID([]byte(tt.rec), tt.keyed)
+
+		if gotErr != tt.wantErr {
+			t.Errorf("%s: want %v; got %v", tt.rec, tt.wantErr, gotErr)
+		}
+
+		if gotID != tt.wantID {
+			t.Errorf("%s: want %v; got %v", tt.rec, tt.wantID, gotID)
+		}
+	}
+}
+
+func TestKeyedLineDiskTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//Scanning a table with string keys...
+
+			dsk := newTestDisk(t)
+
+			if err := dsk.CreateTableWithMeta("newtable", map[string]string{metaKey: string(keys.String)}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.InsertRec("newtable", keys.ID("bill"), []byte(`{"id":"bill"}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			killTestDisk(t, dsk)
+
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			want := []byte(`{"id":"bill"}` + "\n")
+			got, err := dsk.ReadRec("newtable", keys.ID("bill"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("want %s; got %s", want, got)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
@@ -0,0 +1,355 @@
+package disk
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+const journalFileName = "hare.journal"
+
+const (
+	opInsert = "insert"
+	opUpdate = "update"
+	opDelete = "delete"
+)
+
+// logEntry records one write in the undo journal or the write-ahead
+// log.  In the undo journal Rec holds the record as it was before an
+// update or delete, in the write-ahead log it holds the record as it was
+// written.
+type logEntry struct {
+	Op    string `json:"op"`
+	Table string `json:"table"`
+	ID    int    `json:"id"`
+	Rec   []byte `json:"rec,omitempty"`
+}
+
+// batch holds the undo journal for the writes made between BeginBatch
+// and CommitBatch or RollbackBatch.  undoing is set while RollbackBatch
+// undoes the writes, so the undo writes are not journaled themselves.
+type batch struct {
+	tables  map[string]struct{}
+	ptr     *os.File
+	entries []logEntry
+	undoing bool
+}
+
+// BeginBatch takes the names of the tables that are about to be
+// changed together and starts an undo journal for them.  Every write to
+// those tables is journaled and synced before it is made, so that if the
+// process dies before CommitBatch the writes are undone the next time
+// the datastore is opened.
+func (dsk *Disk) BeginBatch(tableNames []string) error {
+	if dsk.readOnly() {
+		return dberr.ErrReadOnly
+	}
+
+	dsk.batchLock.Lock()
+	defer dsk.batchLock.Unlock()
+
+	if dsk.batch != nil {
+		return dberr.ErrBatchInProgress
+	}
+
+	b := batch{tables: make(map[string]struct{})}
+
+	for _, tableName := range tableNames {
+		if !dsk.TableExists(tableName) {
+			return dberr.ErrNoTable
+		}
+
+		b.tables[tableName] = struct{}{}
+	}
+
+	filePtr, err := os.OpenFile(dsk.journalPath(), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0660)
+	if err != nil {
+		return err
+	}
+
+	b.ptr = filePtr
+	dsk.batch = &b
+
+	return nil
+}
+
+// CommitBatch syncs the tables changed during the batch and discards
+// the undo journal.
+func (dsk *Disk) CommitBatch() error {
+	dsk.batchLock.Lock()
+	defer dsk.batchLock.Unlock()
+
+	if dsk.batch == nil || dsk.batch.undoing {
+		return dberr.ErrNoBatch
+	}
+
+	if err := dsk.syncTables(dsk.batch.tables); err != nil {
+		return err
+	}
+
+	return dsk.endBatch()
+}
+
+// RollbackBatch undoes every write made during the batch and discards
+// the undo journal.
+func (dsk *Disk) RollbackBatch() error {
+	dsk.batchLock.Lock()
+
+	b := dsk.batch
+	if b == nil || b.undoing {
+		dsk.batchLock.Unlock()
+		return dberr.ErrNoBatch
+	}
+
+	b.undoing = true
+	entries := b.entries
+
+	// The undo writes go through journal, which takes the batch lock.
+	dsk.batchLock.Unlock()
+
+	err := dsk.undo(entries)
+	if err == nil {
+		err = dsk.syncTables(b.tables)
+	}
+
+	dsk.batchLock.Lock()
+	defer dsk.batchLock.Unlock()
+
+	b.undoing = false
+
+	if err != nil {
+		return err
+	}
+
+	return dsk.endBatch()
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+// batching takes a table name and returns true if the table is part of
+// a batch.  An empty table name asks whether any batch is in progress.
+func (dsk *Disk) batching(tableName string) bool {
+	dsk.batchLock.Lock()
+	defer dsk.batchLock.Unlock()
+
+	if dsk.batch == nil {
+		return false
+	}
+
+	if tableName == "" {
+		return true
+	}
+
+	_, ok := dsk.batch.tables[tableName]
+
+	return ok
+}
+
+// endBatch closes and removes the undo journal.  It expects the caller
+// to hold the batch lock.
+func (dsk *Disk) endBatch() error {
+	if err := dsk.batch.ptr.Close(); err != nil {
+		return err
+	}
+
+	dsk.batch = nil
+
+	return os.Remove(dsk.journalPath())
+}
+
+// journal takes an operation, a table name, and a record id and, if the
+// table is part of a batch, writes an undo entry to the journal and
+// syncs it before the write is made.
+func (dsk *Disk) journal(op string, tableName string, id int) error {
+	dsk.batchLock.Lock()
+	defer dsk.batchLock.Unlock()
+
+	if dsk.batch == nil || dsk.batch.undoing {
+		return nil
+	}
+
+	if _, ok := dsk.batch.tables[tableName]; !ok {
+		return nil
+	}
+
+	entry := logEntry{Op: op, Table: tableName, ID: id}
+
+	if op != opInsert {
+		tableFile, err := dsk.getTableFile(tableName)
+		if err != nil {
+			return err
+		}
+
+		offset, ok := tableFile.offsets[id]
+		if !ok {
+			return dberr.ErrNoRecord
+		}
+
+		// The record is journaled the way it is stored, so encrypted
+		// tables are not written to the journal in the clear.
+		f, err := tableFile.readFrameAt(offset)
+		if err != nil {
+			return err
+		}
+
+		entry.Rec = tableFile.frm.trim(f.rec)
+	}
+
+	if err := writeLogEntry(dsk.batch.ptr, entry); err != nil {
+		return err
+	}
+
+	dsk.batch.entries = append(dsk.batch.entries, entry)
+
+	return nil
+}
+
+func (dsk *Disk) journalPath() string {
+	return dsk.path + "/" + journalFileName
+}
+
+// recoverJournal undoes the writes of a batch that was interrupted
+// before it was committed or rolled back.
+func (dsk *Disk) recoverJournal() error {
+	entries, err := readLog(dsk.journalPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	tables := make(map[string]struct{})
+
+	for _, entry := range entries {
+		tables[entry.Table] = struct{}{}
+	}
+
+	if err := dsk.undo(entries); err != nil {
+		return err
+	}
+
+	if err := dsk.syncTables(tables); err != nil {
+		return err
+	}
+
+	return os.Remove(dsk.journalPath())
+}
+
+func (dsk *Disk) syncTables(tables map[string]struct{}) error {
+	for tableName := range tables {
+		tableFile, err := dsk.getTableFile(tableName)
+		if err != nil {
+			continue
+		}
+
+		if err := tableFile.ptr.Sync(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// undo takes journal entries and reverts them in reverse order.  Each
+// step is safe to repeat, since recovery may be interrupted too.
+func (dsk *Disk) undo(entries []logEntry) error {
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+
+		tableFile, err := dsk.getTableFile(entry.Table)
+		if err != nil {
+			continue
+		}
+
+		if err := dsk.purgeRec(tableFile, entry.Table, entry.ID); err != nil {
+			return err
+		}
+
+		if entry.Op == opInsert {
+			continue
+		}
+
+		rec, err := tableFile.decodeRec(entry.ID, entry.Rec)
+		if err != nil {
+			return err
+		}
+
+		if err := dsk.InsertRec(entry.Table, entry.ID, rec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// purgeRec takes a table file, its table name, and a record id and
+// removes every copy of that record, logging the removal in the
+// write-ahead log.  The sequence is saved if it does not cover the id,
+// so an insert that is undone does not give its id back.
+func (dsk *Disk) purgeRec(tableFile *tableFile, tableName string, id int) error {
+	dsk.lockWAL()
+	defer dsk.unlockWAL()
+
+	if err := dsk.logWrite(opDelete, tableName, id, nil); err != nil {
+		return err
+	}
+
+	if err := tableFile.purgeRec(id); err != nil {
+		return err
+	}
+
+	return tableFile.keepSeq(id)
+}
+
+// readLog takes the path of an undo journal or write-ahead log and
+// returns its entries.
+func readLog(path string) ([]logEntry, error) {
+	var entries []logEntry
+
+	filePtr, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer filePtr.Close()
+
+	scanner := bufio.NewScanner(filePtr)
+	scanner.Buffer(nil, 1<<30)
+
+	for scanner.Scan() {
+		var entry logEntry
+
+		// A torn last line means the process died while logging a
+		// write that was never made, so it can be ignored.
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			break
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// writeLogEntry takes an open undo journal or write-ahead log and an
+// entry, appends the entry, and syncs the file.
+func writeLogEntry(filePtr *os.File, entry logEntry) error {
+	rawEntry, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if _, err := filePtr.Write(append(rawEntry, '\n')); err != nil {
+		return err
+	}
+
+	return filePtr.Sync()
+}
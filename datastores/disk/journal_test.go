@@ -0,0 +1,185 @@
+package disk
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestBatchDiskTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//CommitBatch...
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			if err := dsk.BeginBatch([]string{"contacts"}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.DeleteRec("contacts", 3); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.CommitBatch(); err != nil {
+				t.Fatal(err)
+			}
+
+			wantErr := dberr.ErrNoRecord
+			_, gotErr := dsk.ReadRec("contacts", 3)
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+
+			if _, err := os.Stat(dsk.journalPath()); !os.IsNotExist(err) {
+				t.Errorf("want journal removed; got %v", err)
+			}
+		},
+		func(t *testing.T) {
+			//RollbackBatch...
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			if err := dsk.BeginBatch([]string{"contacts"}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.UpdateRec("contacts", 3, []byte(`{"id":3,"first_name":"William","last_name":"Shakespeare","age":18}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.InsertRec("contacts", 5, []byte(`{"id":5,"first_name":"Rex","last_name":"Stout","age":77}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.RollbackBatch(); err != nil {
+				t.Fatal(err)
+			}
+
+			rec, err := dsk.ReadRec("contacts", 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := "{\"id\":3,\"first_name\":\"Bill\",\"last_name\":\"Shakespeare\",\"age\":18}\n"
+			got := string(rec)
+
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			wantErr := dberr.ErrNoRecord
+			_, gotErr := dsk.ReadRec("contacts", 5)
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+		},
+		func(t *testing.T) {
+			//RollbackBatch (inserted id is not handed out again after reopening)...
+
+			dsk := newTestDisk(t)
+
+			if err := dsk.BeginBatch([]string{"contacts"}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.InsertRec("contacts", 5, []byte(`{"id":5,"first_name":"Rex","last_name":"Stout","age":77}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.RollbackBatch(); err != nil {
+				t.Fatal(err)
+			}
+
+			killTestDisk(t, dsk)
+
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			seq, err := dsk.Sequence("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := 5
+			if got := seq; want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			if err := dsk.InsertRec("contacts", seq+1, []byte(`{"id":6,"first_name":"Nero","last_name":"Wolfe","age":56}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			wantErr := dberr.ErrNoRecord
+			_, gotErr := dsk.ReadRec("contacts", 5)
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+		},
+		func(t *testing.T) {
+			//recoverJournal...
+
+			dsk := newTestDisk(t)
+
+			if err := dsk.BeginBatch([]string{"contacts"}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.UpdateRec("contacts", 3, []byte(`{"id":3,"first_name":"William","last_name":"Shakespeare","age":18}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.DeleteRec("contacts", 1); err != nil {
+				t.Fatal(err)
+			}
+
+			killTestDisk(t, dsk)
+
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			for id, want := range map[int]string{
+				1: "{\"id\":1,\"first_name\":\"John\",\"last_name\":\"Doe\",\"age\":37}\n",
+				3: "{\"id\":3,\"first_name\":\"Bill\",\"last_name\":\"Shakespeare\",\"age\":18}\n",
+			} {
+				rec, err := dsk.ReadRec("contacts", id)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got := string(rec)
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(t *testing.T) {
+			//BeginBatch (ErrBatchInProgress error)...
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			if err := dsk.BeginBatch([]string{"contacts"}); err != nil {
+				t.Fatal(err)
+			}
+			defer dsk.RollbackBatch()
+
+			wantErr := dberr.ErrBatchInProgress
+			gotErr := dsk.BeginBatch([]string{"contacts"})
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
@@ -0,0 +1,126 @@
+package disk
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+const lockFileName = "hare.lock"
+
+const lockRetryInterval = 10 * time.Millisecond
+
+// LockMode decides how a Disk datastore shares its directory with other
+// processes.
+type LockMode int
+
+const (
+	// LockNone takes no lock.  Only one process should open the
+	// directory at a time.
+	LockNone LockMode = iota
+
+	// LockExclusive takes an exclusive lock on the directory, so no
+	// other process that uses locking can open it at the same time.
+	LockExclusive
+
+	// LockShared takes a shared lock on the directory, so other
+	// processes can open it with LockShared at the same time but not
+	// with LockExclusive.  The datastore is read-only in this mode, as
+	// with Options.ReadOnly.
+	LockShared
+)
+
+// dirLock is an advisory lock held on the lock file in a database
+// directory.
+type dirLock struct {
+	ptr *os.File
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+// lockDir takes the lock asked for in the options, which is always a
+// shared one for a read-only datastore.  With a zero LockTimeout it
+// fails at once if another process holds a conflicting lock, otherwise
+// it keeps trying until the timeout has passed.
+//
+// A read-only datastore with no LockMode never writes to the directory.
+// It goes without a lock if the lock file has not been made by a
+// process that locks the directory, or if locking is not supported.
+func (dsk *Disk) lockDir() error {
+	optional := dsk.opts.LockMode == LockNone
+	if optional && !dsk.opts.ReadOnly {
+		return nil
+	}
+
+	osFlag := os.O_CREATE | os.O_RDWR
+	switch {
+	case optional:
+		osFlag = os.O_RDONLY
+	case dsk.readOnly():
+		osFlag = os.O_CREATE | os.O_RDONLY
+	}
+
+	filePtr, err := os.OpenFile(dsk.path+"/"+lockFileName, osFlag, 0660)
+	if optional && os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	exclusive := !dsk.readOnly()
+	deadline := time.Now().Add(dsk.opts.LockTimeout)
+
+	for {
+		ok, err := tryLockFile(filePtr, exclusive)
+		if optional && errors.Is(err, dberr.ErrLockNotSupported) {
+			return filePtr.Close()
+		}
+		if err != nil {
+			filePtr.Close()
+			return err
+		}
+
+		if ok {
+			break
+		}
+
+		if !time.Now().Before(deadline) {
+			filePtr.Close()
+			return dberr.ErrLocked
+		}
+
+		time.Sleep(lockRetryInterval)
+	}
+
+	dsk.lock = &dirLock{ptr: filePtr}
+
+	return nil
+}
+
+// readOnly returns true if the datastore must not be written to.
+func (dsk *Disk) readOnly() bool {
+	return dsk.opts.ReadOnly || dsk.opts.LockMode == LockShared
+}
+
+func (dsk *Disk) unlockDir() error {
+	if dsk.lock == nil {
+		return nil
+	}
+
+	if err := unlockFile(dsk.lock.ptr); err != nil {
+		return err
+	}
+
+	if err := dsk.lock.ptr.Close(); err != nil {
+		return err
+	}
+
+	dsk.lock = nil
+
+	return nil
+}
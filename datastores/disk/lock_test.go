@@ -0,0 +1,82 @@
+//go:build !windows
+// +build !windows
+
+package disk
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestLockDiskTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//LockExclusive...
+
+			dsk := newTestDiskWithOptions(t, Options{LockMode: LockExclusive})
+
+			wantErr := dberr.ErrLocked
+			_, gotErr := NewWithOptions("./testdata", ".json", Options{LockMode: LockExclusive})
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+
+			_, gotErr = NewWithOptions("./testdata", ".json", Options{LockMode: LockShared})
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+
+			dsk.Close()
+
+			dsk = newTestDiskWithOptions(t, Options{LockMode: LockExclusive})
+			dsk.Close()
+		},
+		func(t *testing.T) {
+			//LockShared...
+
+			dsk1 := newTestDiskWithOptions(t, Options{LockMode: LockShared})
+			defer dsk1.Close()
+
+			dsk2 := newTestDiskWithOptions(t, Options{LockMode: LockShared})
+			defer dsk2.Close()
+
+			if _, err := dsk2.ReadRec("contacts", 3); err != nil {
+				t.Fatal(err)
+			}
+
+			wantErr := dberr.ErrReadOnly
+			gotErr := dsk2.DeleteRec("contacts", 3)
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+
+			wantErr = dberr.ErrLocked
+			_, gotErr = NewWithOptions("./testdata", ".json", Options{LockMode: LockExclusive})
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+		},
+		func(t *testing.T) {
+			//LockTimeout...
+
+			dsk := newTestDiskWithOptions(t, Options{LockMode: LockExclusive})
+
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				dsk.Close()
+			}()
+
+			dsk2 := newTestDiskWithOptions(t, Options{LockMode: LockExclusive, LockTimeout: 5 * time.Second})
+			dsk2.Close()
+		},
+	}
+
+	runTestFns(t, tests)
+}
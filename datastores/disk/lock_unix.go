@@ -0,0 +1,33 @@
+//go:build !windows
+// +build !windows
+
+package disk
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLockFile takes an open file and tries to take an flock on it
+// without waiting.  It returns false if another process holds a
+// conflicting lock.
+func tryLockFile(filePtr *os.File, exclusive bool) (bool, error) {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	err := syscall.Flock(int(filePtr.Fd()), how|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func unlockFile(filePtr *os.File) error {
+	return syscall.Flock(int(filePtr.Fd()), syscall.LOCK_UN)
+}
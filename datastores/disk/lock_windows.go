@@ -0,0 +1,21 @@
+//go:build windows
+// +build windows
+
+package disk
+
+import (
+	"os"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// tryLockFile is not supported on Windows, so asking for any lock mode
+// other than LockNone fails.  A read-only datastore with no LockMode
+// goes without a lock instead.
+func tryLockFile(filePtr *os.File, exclusive bool) (bool, error) {
+	return false, dberr.ErrLockNotSupported
+}
+
+func unlockFile(filePtr *os.File) error {
+	return nil
+}
@@ -0,0 +1,274 @@
+package disk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// The offset index is a sidecar file written next to a table file when
+// the table is closed.  It holds the table's record offsets and free
+// space, along with the size, modification time, and a checksum of the
+// end of the table file, so the table can be opened without reading
+// every line.  It is removed as soon as the table is written to again,
+// so a stale index is never left behind by a crash.
+const (
+	indexExt      = ".idx"
+	indexMagic    = "HAREIDX1"
+	indexTailSize = 4096
+)
+
+var errStaleIndex = errors.New("offset index is missing, corrupt, or out of date")
+
+type fileStamp struct {
+	size    int64
+	modTime int64
+	tailSum uint32
+}
+
+// openTableFile takes a table name, an open table file, the path of its
+// offset index, and whether to skip corrupt records and returns a
+// tableFile.  The offset index is used if it matches the table file,
+// otherwise the table file is scanned.
+func openTableFile(tableName string, filePtr *os.File, indexPath string, lenient bool) (*tableFile, error) {
+	tableFile, err := readIndex(filePtr, indexPath)
+	if err == nil {
+		err = tableFile.readHeader()
+	}
+	if err != nil {
+		tableFile, err = scanTableFile(tableName, filePtr, lenient)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tableFile.indexPath = indexPath
+	tableFile.name = tableName
+
+	return tableFile, nil
+}
+
+// invalidateIndex removes the offset index the first time the table is
+// written to after it was opened.
+func (t *tableFile) invalidateIndex() error {
+	if err := t.invalidateFieldIndex(); err != nil {
+		return err
+	}
+
+	if t.indexPath == "" || t.dirty {
+		return nil
+	}
+
+	if err := os.Remove(t.indexPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	t.dirty = true
+
+	return nil
+}
+
+// writeIndex writes the offset index to a temporary file and renames it
+// into place.
+func (t *tableFile) writeIndex() error {
+	// Copies left behind by an interrupted write, and corrupt records
+	// that were skipped, are only found by a scan, so leave the index
+	// out until they are cleaned up.
+	if t.indexPath == "" || len(t.dupOffsets) > 0 || t.corrupt > 0 {
+		return nil
+	}
+
+	stamp, err := stampFile(t.ptr)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteString(indexMagic)
+	writeUvarint(&buf, uint64(stamp.size))
+	writeVarint(&buf, stamp.modTime)
+	writeUvarint(&buf, uint64(stamp.tailSum))
+
+	ids := t.ids()
+	sort.Ints(ids)
+
+	writeUvarint(&buf, uint64(len(ids)))
+	for _, id := range ids {
+		writeVarint(&buf, int64(id))
+		writeUvarint(&buf, uint64(t.offsets[id]))
+	}
+
+	freeOffsets := make([]int64, 0, len(t.free))
+	for offset := range t.free {
+		freeOffsets = append(freeOffsets, offset)
+	}
+	sort.Slice(freeOffsets, func(i, j int) bool { return freeOffsets[i] < freeOffsets[j] })
+
+	writeUvarint(&buf, uint64(len(freeOffsets)))
+	for _, offset := range freeOffsets {
+		writeUvarint(&buf, uint64(offset))
+		writeUvarint(&buf, uint64(t.free[offset]))
+	}
+
+	sum := crc32.ChecksumIEEE(buf.Bytes())
+	if err := binary.Write(&buf, binary.BigEndian, sum); err != nil {
+		return err
+	}
+
+	tmpPath := t.indexPath + ".tmp"
+
+	if err := ioutil.WriteFile(tmpPath, buf.Bytes(), 0660); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, t.indexPath)
+}
+
+// readIndex takes an open table file and the path of its offset index
+// and returns a tableFile built from the index, or errStaleIndex if the
+// index does not match the table file.
+func readIndex(filePtr *os.File, indexPath string) (*tableFile, error) {
+	data, err := ioutil.ReadFile(indexPath)
+	if err != nil {
+		return nil, errStaleIndex
+	}
+
+	if len(data) < len(indexMagic)+4 || string(data[:len(indexMagic)]) != indexMagic {
+		return nil, errStaleIndex
+	}
+
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+		return nil, errStaleIndex
+	}
+
+	r := bytes.NewReader(body[len(indexMagic):])
+
+	stamp, err := readStamp(r)
+	if err != nil {
+		return nil, errStaleIndex
+	}
+
+	current, err := stampFile(filePtr)
+	if err != nil {
+		return nil, err
+	}
+
+	if stamp != current {
+		return nil, errStaleIndex
+	}
+
+	tableFile := tableFile{ptr: filePtr}
+	tableFile.offsets = make(map[int]int64)
+	tableFile.dupOffsets = make(map[int][]int64)
+	tableFile.free = make(map[int64]int)
+
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errStaleIndex
+	}
+
+	for i := uint64(0); i < count; i++ {
+		id, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, errStaleIndex
+		}
+
+		offset, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, errStaleIndex
+		}
+
+		tableFile.offsets[int(id)] = int64(offset)
+	}
+
+	if count, err = binary.ReadUvarint(r); err != nil {
+		return nil, errStaleIndex
+	}
+
+	for i := uint64(0); i < count; i++ {
+		offset, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, errStaleIndex
+		}
+
+		freeLen, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, errStaleIndex
+		}
+
+		tableFile.free[int64(offset)] = int(freeLen)
+	}
+
+	return &tableFile, nil
+}
+
+// readStamp takes a reader positioned at a stamp written by writeIndex
+// or SaveFieldIndexes and returns the stamp.
+func readStamp(r *bytes.Reader) (fileStamp, error) {
+	var stamp fileStamp
+
+	u, err := binary.ReadUvarint(r)
+	if err != nil {
+		return stamp, err
+	}
+	stamp.size = int64(u)
+
+	if stamp.modTime, err = binary.ReadVarint(r); err != nil {
+		return stamp, err
+	}
+
+	if u, err = binary.ReadUvarint(r); err != nil {
+		return stamp, err
+	}
+	stamp.tailSum = uint32(u)
+
+	return stamp, nil
+}
+
+// stampFile takes an open table file and returns its size, modification
+// time, and a checksum of its last few kilobytes.
+func stampFile(filePtr *os.File) (fileStamp, error) {
+	var stamp fileStamp
+
+	info, err := filePtr.Stat()
+	if err != nil {
+		return stamp, err
+	}
+
+	stamp.size = info.Size()
+	stamp.modTime = info.ModTime().UnixNano()
+
+	tailLen := stamp.size
+	if tailLen > indexTailSize {
+		tailLen = indexTailSize
+	}
+
+	tail := make([]byte, tailLen)
+
+	if _, err := filePtr.ReadAt(tail, stamp.size-tailLen); err != nil && err != io.EOF {
+		return stamp, err
+	}
+
+	stamp.tailSum = crc32.ChecksumIEEE(tail)
+
+	return stamp, nil
+}
+
+func writeUvarint(buf *bytes.Buffer, x uint64) {
+	var b [binary.MaxVarintLen64]byte
+
+	buf.Write(b[:binary.PutUvarint(b[:], x)])
+}
+
+func writeVarint(buf *bytes.Buffer, x int64) {
+	var b [binary.MaxVarintLen64]byte
+
+	buf.Write(b[:binary.PutVarint(b[:], x)])
+}
@@ -0,0 +1,105 @@
+package disk
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestOffsetIndexTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//writeIndex and readIndex...
+
+			dsk := newTestDisk(t)
+
+			if err := dsk.DeleteRec("contacts", 3); err != nil {
+				t.Fatal(err)
+			}
+
+			wantOffsets := dsk.tableFiles["contacts"].offsets
+			wantFree := dsk.tableFiles["contacts"].free
+
+			dsk.Close()
+
+			filePtr, err := os.OpenFile("./testdata/contacts.json", os.O_RDWR, 0660)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tf, err := readIndex(filePtr, "./testdata/contacts.json.idx")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tf.close()
+
+			if !reflect.DeepEqual(wantOffsets, tf.offsets) {
+				t.Errorf("want %v; got %v", wantOffsets, tf.offsets)
+			}
+
+			if !reflect.DeepEqual(wantFree, tf.free) {
+				t.Errorf("want %v; got %v", wantFree, tf.free)
+			}
+		},
+		func(t *testing.T) {
+			//readIndex (stale index)...
+
+			dsk := newTestDisk(t)
+			dsk.Close()
+
+			f, err := os.OpenFile("./testdata/contacts.json", os.O_APPEND|os.O_WRONLY, 0660)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := f.WriteString("{\"id\":5,\"first_name\":\"Rex\",\"last_name\":\"Stout\",\"age\":77}\n"); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			filePtr, err := os.OpenFile("./testdata/contacts.json", os.O_RDWR, 0660)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer filePtr.Close()
+
+			wantErr := errStaleIndex
+			_, gotErr := readIndex(filePtr, "./testdata/contacts.json.idx")
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			if _, err := dsk.ReadRec("contacts", 5); err != nil {
+				t.Fatal(err)
+			}
+		},
+		func(t *testing.T) {
+			//invalidateIndex...
+
+			dsk := newTestDisk(t)
+			dsk.Close()
+
+			if _, err := os.Stat("./testdata/contacts.json.idx"); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			if err := dsk.DeleteRec("contacts", 3); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := os.Stat("./testdata/contacts.json.idx"); !os.IsNotExist(err) {
+				t.Errorf("want index removed; got %v", err)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
@@ -0,0 +1,133 @@
+package disk
+
+import (
+	"errors"
+	"os"
+	"sort"
+)
+
+var errNotReadOnly = errors.New("hare: only a read-only datastore can be reloaded")
+
+// ReadOnly returns true if the datastore was opened read-only, with
+// Options.ReadOnly or LockShared.
+func (dsk *Disk) ReadOnly() bool {
+	return dsk.readOnly()
+}
+
+// Reload brings a read-only datastore up to date with the files in its
+// directory, which other processes may have written to since they were
+// opened.  Tables whose files changed are read again, new table files
+// are opened, and tables whose files are gone are closed.  It returns
+// the names of the tables that changed, sorted.  Nothing else should use
+// the datastore while it reloads.
+//
+// Changes still in another process's write-ahead log are not seen
+// until that process checkpoints them into the table files.
+func (dsk *Disk) Reload() ([]string, error) {
+	if !dsk.readOnly() {
+		return nil, errNotReadOnly
+	}
+
+	tableNames, err := dsk.getTableNames()
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+
+	onDisk := make(map[string]struct{}, len(tableNames))
+
+	for _, tableName := range tableNames {
+		onDisk[tableName] = struct{}{}
+
+		if tableFile, err := dsk.getTableFile(tableName); err == nil {
+			unchanged, err := tableFile.unchanged(dsk.tablePath(tableName))
+			if err != nil {
+				return changed, err
+			}
+
+			if unchanged {
+				continue
+			}
+
+			if err := dsk.unloadTable(tableName); err != nil {
+				return changed, err
+			}
+		}
+
+		if err := dsk.loadTable(tableName, false); err != nil {
+			// The file was removed after the directory was read.
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return changed, err
+		}
+
+		changed = append(changed, tableName)
+	}
+
+	for _, tableName := range dsk.TableNames() {
+		if _, ok := onDisk[tableName]; ok {
+			continue
+		}
+
+		if err := dsk.unloadTable(tableName); err != nil {
+			return changed, err
+		}
+
+		changed = append(changed, tableName)
+	}
+
+	sort.Strings(changed)
+
+	return changed, nil
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+// unloadTable takes a table name, closes the table file, and removes it
+// from the map of tables in the datastore.
+func (dsk *Disk) unloadTable(tableName string) error {
+	if err := dsk.closeTable(tableName); err != nil {
+		return err
+	}
+
+	dsk.tablesLock.Lock()
+	delete(dsk.tableFiles, tableName)
+	dsk.tablesLock.Unlock()
+
+	return nil
+}
+
+// unchanged takes the path of the table file and returns true if the
+// file there is still the one that was opened, and has not been written
+// to since.
+func (t *tableFile) unchanged(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	openInfo, err := t.ptr.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	// Compact writes a new file and renames it over the old one.
+	if !os.SameFile(info, openInfo) {
+		return false, nil
+	}
+
+	stamp, err := stampFile(t.ptr)
+	if err != nil {
+		return false, err
+	}
+
+	return stamp == t.stamp, nil
+}
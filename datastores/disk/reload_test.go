@@ -0,0 +1,159 @@
+//go:build !windows
+// +build !windows
+
+package disk
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestReloadDiskTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//ReadOnly...
+
+			dsk := newTestDiskWithOptions(t, Options{ReadOnly: true})
+			defer dsk.Close()
+
+			if !dsk.ReadOnly() {
+				t.Errorf("want %v; got %v", true, false)
+			}
+
+			if _, err := dsk.ReadRec("contacts", 3); err != nil {
+				t.Fatal(err)
+			}
+
+			wantErr := dberr.ErrReadOnly
+
+			for _, gotErr := range []error{
+				dsk.InsertRec("contacts", 5, []byte(`{"id":5}`)),
+				dsk.UpdateRec("contacts", 3, []byte(`{"id":3}`)),
+				dsk.DeleteRec("contacts", 3),
+				dsk.CreateTable("newtable"),
+				dsk.RemoveTable("contacts"),
+			} {
+				if !errors.Is(gotErr, wantErr) {
+					t.Errorf("want %v; got %v", wantErr, gotErr)
+				}
+			}
+
+			// No process that locks the directory has made the lock
+			// file, so none is made or locked.
+			if _, err := os.Stat("./testdata/" + lockFileName); !os.IsNotExist(err) {
+				t.Errorf("want no lock file; got %v", err)
+			}
+
+			if dsk.lock != nil {
+				t.Errorf("want no lock; got %v", dsk.lock)
+			}
+		},
+		func(t *testing.T) {
+			//ReadOnly (lock file made by a writer)...
+
+			writer := newTestDiskWithOptions(t, Options{LockMode: LockExclusive})
+			writer.Close()
+
+			dsk := newTestDiskWithOptions(t, Options{ReadOnly: true})
+			defer dsk.Close()
+
+			// The shared lock keeps writers that lock out.
+			wantErr := dberr.ErrLocked
+			_, gotErr := NewWithOptions("./testdata", ".json", Options{LockMode: LockExclusive})
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+		},
+		func(t *testing.T) {
+			//Reload...
+
+			reader := newTestDiskWithOptions(t, Options{ReadOnly: true})
+			defer reader.Close()
+
+			writer := newTestDisk(t)
+			defer writer.Close()
+
+			got, err := reader.Reload()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != 0 {
+				t.Errorf("want %v; got %v", nil, got)
+			}
+
+			if err := writer.InsertRec("contacts", 5, []byte(`{"id":5,"first_name":"Robin"}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := writer.CreateTable("newtable"); err != nil {
+				t.Fatal(err)
+			}
+
+			want := []string{"contacts", "newtable"}
+			got, err = reader.Reload()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			wantRec := "{\"id\":5,\"first_name\":\"Robin\"}\n"
+			gotRec, err := reader.ReadRec("contacts", 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if wantRec != string(gotRec) {
+				t.Errorf("want %v; got %s", wantRec, gotRec)
+			}
+
+			if err := writer.Compact("contacts"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := writer.RemoveTable("newtable"); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err = reader.Reload()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			if reader.TableExists("newtable") {
+				t.Errorf("want %v; got %v", false, true)
+			}
+
+			if _, err := reader.ReadRec("contacts", 5); err != nil {
+				t.Fatal(err)
+			}
+		},
+		func(t *testing.T) {
+			//Reload (errNotReadOnly error)...
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			wantErr := errNotReadOnly
+			_, gotErr := dsk.Reload()
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
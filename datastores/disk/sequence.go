@@ -0,0 +1,122 @@
+package disk
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// The sequence file is a sidecar file written next to a table file that
+// holds the greatest record id the table has ever handed out.  The ids
+// still in the table file cover the rest, so it only has to be written
+// when a record with an id greater than the saved sequence is deleted,
+// or when the sequence is set.
+const seqExt = ".seq"
+
+var errBadSeq = errors.New("hare: sequence file does not hold a whole number")
+
+// Sequence takes a table name and returns the greatest record id ever
+// written to the table, even if that record has since been deleted.
+func (dsk *Disk) Sequence(tableName string) (int, error) {
+	tableFile, err := dsk.getTableFile(tableName)
+	if err != nil {
+		return 0, err
+	}
+
+	return tableFile.seq, nil
+}
+
+// SetSequence takes a table name and a record id, moves the table's
+// sequence forward to that id, and saves it.
+func (dsk *Disk) SetSequence(tableName string, seq int) error {
+	if dsk.readOnly() {
+		return dberr.ErrReadOnly
+	}
+
+	dsk.lockWAL()
+	defer dsk.unlockWAL()
+
+	tableFile, err := dsk.getTableFile(tableName)
+	if err != nil {
+		return err
+	}
+
+	if seq < tableFile.seq {
+		return dberr.ErrSequenceTooLow
+	}
+
+	tableFile.seq = seq
+
+	return tableFile.saveSeq()
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+func (dsk *Disk) seqPath(tableName string) string {
+	return dsk.path + "/" + tableName + dsk.ext + seqExt
+}
+
+// keepSeq takes the id of a record that was just removed from the table
+// and, if the saved sequence does not cover it, saves the sequence, so
+// the id is not handed out again after the table is reopened.
+func (t *tableFile) keepSeq(id int) error {
+	if id <= t.savedSeq {
+		return nil
+	}
+
+	return t.saveSeq()
+}
+
+// loadSeq takes the path of the table's sequence file and sets the
+// table's sequence to the greater of the saved sequence and the greatest
+// id in the table.
+func (t *tableFile) loadSeq(seqPath string) error {
+	t.seqPath = seqPath
+	t.savedSeq = 0
+
+	data, err := ioutil.ReadFile(seqPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err == nil {
+		if t.savedSeq, err = strconv.Atoi(strings.TrimSpace(string(data))); err != nil {
+			return errBadSeq
+		}
+	}
+
+	t.seq = t.getLastID()
+	if t.savedSeq > t.seq {
+		t.seq = t.savedSeq
+	}
+
+	return nil
+}
+
+// saveSeq writes the table's sequence to a temporary file and renames it
+// into place.
+func (t *tableFile) saveSeq() error {
+	if t.seqPath == "" {
+		return nil
+	}
+
+	tmpPath := t.seqPath + ".tmp"
+
+	if err := ioutil.WriteFile(tmpPath, []byte(strconv.Itoa(t.seq)+"\n"), 0660); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, t.seqPath); err != nil {
+		return err
+	}
+
+	t.savedSeq = t.seq
+
+	return nil
+}
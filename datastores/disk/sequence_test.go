@@ -0,0 +1,135 @@
+package disk
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestSequenceDiskTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//Sequence (no sequence file)...
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			want := 4
+			got, err := dsk.Sequence("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+		func(t *testing.T) {
+			//Sequence (after deleting the last record and reopening)...
+
+			dsk := newTestDisk(t)
+
+			if err := dsk.DeleteRec("contacts", 4); err != nil {
+				t.Fatal(err)
+			}
+
+			// The sequence must be saved by the delete itself, not by
+			// Close.
+			killTestDisk(t, dsk)
+
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			want := 4
+			got, err := dsk.Sequence("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			gotLastID, err := dsk.GetLastID("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if gotLastID != 3 {
+				t.Errorf("want %v; got %v", 3, gotLastID)
+			}
+		},
+		func(t *testing.T) {
+			//SetSequence...
+
+			dsk := newTestDisk(t)
+
+			if err := dsk.SetSequence("contacts", 1000); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk.Close()
+
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			want := 1000
+			got, err := dsk.Sequence("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+		func(t *testing.T) {
+			//SetSequence (SequenceTooLow error)...
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			wantErr := dberr.ErrSequenceTooLow
+			gotErr := dsk.SetSequence("contacts", 3)
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+		},
+		func(t *testing.T) {
+			//SetSequence (ReadOnly error)...
+
+			dsk := newTestDiskWithOptions(t, Options{LockMode: LockShared})
+			defer dsk.Close()
+
+			wantErr := dberr.ErrReadOnly
+			gotErr := dsk.SetSequence("contacts", 1000)
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+		},
+		func(t *testing.T) {
+			//RemoveTable (removes the sequence file)...
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			if err := dsk.SetSequence("contacts", 1000); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.RemoveTable("contacts"); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := os.Stat("./testdata/contacts.json" + seqExt); !os.IsNotExist(err) {
+				t.Errorf("want %v; got %v", os.ErrNotExist, err)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
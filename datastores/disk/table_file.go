@@ -2,8 +2,7 @@ package disk
 
 import (
 	"bufio"
-	"encoding/json"
-	"io"
+	"errors"
 	"os"
 
 	"github.com/jameycribbs/hare/dberr"
@@ -11,65 +10,79 @@ import (
 
 const dummyRune = 'X'
 
-type tableFile struct {
-	ptr     *os.File
-	offsets map[int]int64
-}
-
-func newTableFile(tableName string, filePtr *os.File) (*tableFile, error) {
-	var currentOffset int64
-	var totalOffset int64
-	var recLen int
-	var recMap map[string]interface{}
-
-	tableFile := tableFile{ptr: filePtr}
-	tableFile.offsets = make(map[int]int64)
+// FitPolicy decides which dummy record a new or grown record is written
+// over.
+type FitPolicy int
 
-	r := bufio.NewReader(filePtr)
-
-	_, err := filePtr.Seek(0, 0)
-	if err != nil {
-		return nil, err
-	}
+const (
+	// FirstFit writes the record over the first dummy record in the
+	// file that is big enough to hold it.
+	FirstFit FitPolicy = iota
 
-	for {
-		rec, err := r.ReadBytes('\n')
+	// BestFit writes the record over the smallest dummy record that is
+	// big enough to hold it.
+	BestFit
 
-		currentOffset = totalOffset
-		recLen = len(rec)
-		totalOffset += int64(recLen)
-
-		if err == io.EOF {
-			break
-		}
+	// AlwaysAppend never reuses dummy records and always writes the
+	// record at the end of the file.
+	AlwaysAppend
+)
 
-		if err != nil {
-			return nil, err
-		}
+type tableFile struct {
+	ptr        *os.File
+	offsets    map[int]int64
+	dupOffsets map[int][]int64
+	free       map[int64]int
+	fit        FitPolicy
+	indexPath  string
+	dirty      bool
+	meta       map[string]string
+	dataStart  int64
+	frm        framer
+	name       string
+	crypt      *crypter
+	corrupt    int
+	seq        int
+	savedSeq   int
+	seqPath    string
+	stamp      fileStamp
+	torn       *Corruption
+	dict       *dictionary
+
+	fieldIndexPath string
+	fieldIndexLive bool
+}
 
-		// Skip dummy records.
-		if (rec[0] == '\n') || (rec[0] == dummyRune) {
-			continue
-		}
+func newTableFile(tableName string, filePtr *os.File) (*tableFile, error) {
+	return scanTableFile(tableName, filePtr, false)
+}
 
-		//Unmarshal so we can grab the record ID.
-		if err := json.Unmarshal(rec, &recMap); err != nil {
-			return nil, err
-		}
-		recMapID := int(recMap["id"].(float64))
+// scanTableFile takes a table name, an open table file, and whether to
+// skip corrupt records, and reads the table file to find every record.
+// Unless lenient is true, the first corrupt record is returned as a
+// *Corruption.
+func scanTableFile(tableName string, filePtr *os.File, lenient bool) (*tableFile, error) {
+	tableFile := tableFile{ptr: filePtr, name: tableName}
 
-		tableFile.offsets[recMapID] = currentOffset
+	if err := tableFile.scan(lenient); err != nil {
+		return nil, err
 	}
 
 	return &tableFile, nil
 }
 
 func (t *tableFile) close() error {
+	if err := t.writeIndex(); err != nil {
+		return err
+	}
+
 	if err := t.ptr.Close(); err != nil {
 		return err
 	}
 
 	t.offsets = nil
+	t.dupOffsets = nil
+	t.free = nil
 
 	return nil
 }
@@ -80,12 +93,12 @@ func (t *tableFile) deleteRec(id int) error {
 		return dberr.ErrNoRecord
 	}
 
-	rec, err := t.readRec(id)
+	f, err := t.readFrameAt(offset)
 	if err != nil {
 		return err
 	}
 
-	if err = t.overwriteRec(offset, len(rec)); err != nil {
+	if err = t.overwriteRec(offset, f.size); err != nil {
 		return err
 	}
 
@@ -143,62 +156,105 @@ func (t *tableFile) offsetForWritingRec(recLen int) (int64, error) {
 	return offset, nil
 }
 
-// offsetToFitRec takes a record length and checks all the dummy records to see
-// if any are big enough to fit the record.
+// offsetToFitRec takes a record length and looks through the free space
+// for a dummy record big enough to fit the record, using the table's fit
+// policy to choose between them.
 func (t *tableFile) offsetToFitRec(recLenNeeded int) (int64, error) {
-	var recLen int
 	var offset int64
-	var totalOffset int64
+	var found bool
 
-	r := bufio.NewReader(t.ptr)
+	if t.fit == AlwaysAppend {
+		return 0, dummiesTooShortError{}
+	}
+
+	for freeOffset, freeLen := range t.free {
+		// Whatever is left over has to be big enough to hold a dummy.
+		if freeLen != recLenNeeded && freeLen-recLenNeeded < t.frm.overhead() {
+			continue
+		}
+
+		switch {
+		case !found:
+		case t.fit == BestFit && freeLen < t.free[offset]:
+		case t.fit == BestFit && freeLen == t.free[offset] && freeOffset < offset:
+		case t.fit == FirstFit && freeOffset < offset:
+		default:
+			continue
+		}
 
-	if _, err := t.ptr.Seek(0, 0); err != nil {
-		return 0, err
+		offset = freeOffset
+		found = true
 	}
 
-	for {
-		rec, err := r.ReadBytes('\n')
+	if !found {
+		return 0, dummiesTooShortError{}
+	}
 
-		offset = totalOffset
-		recLen = len(rec)
-		totalOffset += int64(recLen)
+	return offset, nil
+}
 
-		// Need to account for newline character.
-		recLen--
+// insertRec takes a record id and a record, writes the record where it
+// fits, and remembers its offset.
+func (t *tableFile) insertRec(id int, rec []byte) error {
+	rec, err := t.encodeRec(id, rec)
+	if err != nil {
+		return err
+	}
 
-		if err == io.EOF {
-			break
-		}
+	offset, err := t.offsetForWritingRec(len(rec))
+	if err != nil {
+		return err
+	}
 
-		if err != nil {
-			return 0, err
-		}
+	if err := t.writeRec(offset, 0, t.frm.frame(id, rec, t.slotLen(offset))); err != nil {
+		return err
+	}
 
-		// If this is a dummy record, is it big enough to
-		// hold the needed record length?
-		if (rec[0] == '\n') || (rec[0] == dummyRune) {
-			if recLen >= recLenNeeded {
-				return offset, nil
-			}
-		}
+	t.claimFree(offset, len(rec))
+
+	t.offsets[id] = offset
+
+	if id > t.seq {
+		t.seq = id
 	}
 
-	return 0, dummiesTooShortError{}
+	return nil
 }
 
+// overwriteRec takes the offset and length of a record's frame and
+// turns it into a dummy.
 func (t *tableFile) overwriteRec(offset int64, recLen int) error {
 	// Overwrite record with XXXXXXXX...
-	dummyData := make([]byte, recLen-1)
+	if err := t.writeRec(offset, 0, t.frm.dummy(recLen)); err != nil {
+		return err
+	}
+
+	t.addFree(offset, recLen-t.frm.overhead())
+
+	return nil
+}
 
-	for i := range dummyData {
-		dummyData[i] = 'X'
+// purgeRec takes a record id and turns every live copy of that record
+// into a dummy, including copies left behind by an interrupted write.
+func (t *tableFile) purgeRec(id int) error {
+	for _, offset := range t.dupOffsets[id] {
+		f, err := t.readFrameAt(offset)
+		if err != nil {
+			return err
+		}
+
+		if err = t.overwriteRec(offset, f.size); err != nil {
+			return err
+		}
 	}
 
-	if err := t.writeRec(offset, 0, dummyData); err != nil {
-		return err
+	delete(t.dupOffsets, id)
+
+	if _, ok := t.offsets[id]; !ok {
+		return nil
 	}
 
-	return nil
+	return t.deleteRec(id)
 }
 
 func (t *tableFile) readRec(id int) ([]byte, error) {
@@ -207,59 +263,135 @@ func (t *tableFile) readRec(id int) ([]byte, error) {
 		return nil, dberr.ErrNoRecord
 	}
 
+	f, err := t.readFrameAt(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.decodeRec(id, f.rec)
+}
+
+// decodeRec takes a record id and the record as it is stored in the
+// table file and returns the record the way it was written.
+func (t *tableFile) decodeRec(id int, stored []byte) ([]byte, error) {
+	var err error
+
+	rec := stored
+
+	if rec == nil {
+		return nil, nil
+	}
+
+	if t.meta[metaEncryption] != "" {
+		if t.crypt == nil {
+			return nil, errNoKeyProvider
+		}
+
+		if rec, err = t.crypt.decrypt(t.name, id, rec); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.meta[metaCompression] != "" {
+		if rec, err = decompressRec(rec, t.dict); err != nil {
+			return nil, err
+		}
+	}
+
+	return rec, nil
+}
+
+// encodeRec takes a record id and a record and returns the record the
+// way it is stored in the table file.
+func (t *tableFile) encodeRec(id int, rec []byte) ([]byte, error) {
+	var err error
+
+	if t.meta[metaCompression] != "" {
+		if rec, err = compressRec(rec, t.dict); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.meta[metaEncryption] != "" {
+		if t.crypt == nil {
+			return nil, errNoKeyProvider
+		}
+
+		if rec, err = t.crypt.encrypt(t.name, id, rec); err != nil {
+			return nil, err
+		}
+	}
+
+	return rec, nil
+}
+
+// readFrameAt takes an offset and returns the frame found there, with
+// the record as it is stored.
+func (t *tableFile) readFrameAt(offset int64) (frame, error) {
 	r := bufio.NewReader(t.ptr)
 
 	if _, err := t.ptr.Seek(offset, 0); err != nil {
-		return nil, err
+		return frame{}, err
 	}
 
-	rec, err := r.ReadBytes('\n')
-	if err != nil {
-		return nil, err
+	f, err := t.frm.read(r, false)
+
+	var bad *corruptFrameError
+	if errors.As(err, &bad) {
+		return frame{}, &Corruption{Table: t.name, Offset: offset, Length: bad.size, Reason: bad.reason}
 	}
 
-	return rec, err
+	return f, err
 }
 
 func (t *tableFile) updateRec(id int, rec []byte) error {
+	rec, err := t.encodeRec(id, rec)
+	if err != nil {
+		return err
+	}
+
 	recLen := len(rec)
+	overhead := t.frm.overhead()
 
 	oldRecOffset, ok := t.offsets[id]
 	if !ok {
 		return dberr.ErrNoRecord
 	}
 
-	oldRec, err := t.readRec(id)
+	oldFrame, err := t.readFrameAt(oldRecOffset)
 	if err != nil {
 		return err
 	}
 
-	oldRecLen := len(oldRec)
+	oldRecLen := oldFrame.size
 
-	diff := oldRecLen - (recLen + 1)
+	diff := oldRecLen - (recLen + overhead)
 
-	if diff > 0 {
+	if diff >= overhead {
 		// Changed record is smaller than record in table, so dummy out
 		// extra space and write over old record.
 
-		rec = append(rec, padRec(diff)...)
-
-		if err = t.writeRec(oldRecOffset, 0, rec); err != nil {
+		if err = t.writeRec(oldRecOffset, 0, t.frm.frame(id, rec, oldRecLen)); err != nil {
 			return err
 		}
 
-	} else if diff < 0 {
-		// Changed record is larger than the record in table.
+		t.addFree(oldRecOffset+int64(recLen+overhead), diff-overhead)
+
+	} else if diff != 0 {
+		// Changed record is larger than the record in table, or the
+		// space left over would be too small to hold a dummy.
 
 		recOffset, err := t.offsetForWritingRec(recLen)
 		if err != nil {
 			return err
 		}
 
-		if err = t.writeRec(recOffset, 0, rec); err != nil {
+		if err = t.writeRec(recOffset, 0, t.frm.frame(id, rec, t.slotLen(recOffset))); err != nil {
 			return err
 		}
 
+		t.claimFree(recOffset, recLen)
+
 		// Turn the old record into a dummy.
 		if err = t.overwriteRec(oldRecOffset, oldRecLen); err != nil {
 			return err
@@ -270,7 +402,7 @@ func (t *tableFile) updateRec(id int, rec []byte) error {
 		t.offsets[id] = recOffset
 	} else {
 		// Changed record is the same length as the record in the table.
-		err = t.writeRec(oldRecOffset, 0, rec)
+		err = t.writeRec(oldRecOffset, 0, t.frm.frame(id, rec, oldRecLen))
 		if err != nil {
 			return err
 		}
@@ -279,22 +411,64 @@ func (t *tableFile) updateRec(id int, rec []byte) error {
 	return nil
 }
 
-func (t *tableFile) writeRec(offset int64, whence int, rec []byte) error {
+// writeRec takes an offset, a whence, and the bytes of one or more
+// frames, and writes them to the table file.
+func (t *tableFile) writeRec(offset int64, whence int, data []byte) error {
 	var err error
 
+	if err = t.invalidateIndex(); err != nil {
+		return err
+	}
+
 	w := bufio.NewWriter(t.ptr)
 
 	if _, err = t.ptr.Seek(offset, whence); err != nil {
 		return err
 	}
 
-	if _, err = w.Write(append(rec, '\n')); err != nil {
+	if _, err = w.Write(data); err != nil {
 		return err
 	}
 
-	w.Flush()
+	return w.Flush()
+}
 
-	return nil
+// addFree takes the offset and length, not counting the frame overhead,
+// of a dummy and remembers it as free space.
+func (t *tableFile) addFree(offset int64, recLen int) {
+	if recLen <= 0 {
+		return
+	}
+
+	t.free[offset] = recLen
+}
+
+// claimFree takes the offset and length of a record that was just
+// written and, if it was written over a dummy, forgets that dummy and
+// remembers whatever is left of it as free space.
+func (t *tableFile) claimFree(offset int64, recLen int) {
+	freeLen, ok := t.free[offset]
+	if !ok {
+		return
+	}
+
+	delete(t.free, offset)
+
+	overhead := t.frm.overhead()
+
+	t.addFree(offset+int64(recLen+overhead), freeLen-recLen-overhead)
+}
+
+// slotLen takes the offset a record is about to be written at and
+// returns the length of the dummy it is being written over, or 0 if it
+// is being written at the end of the file.
+func (t *tableFile) slotLen(offset int64) int {
+	freeLen, ok := t.free[offset]
+	if !ok {
+		return 0
+	}
+
+	return freeLen + t.frm.overhead()
 }
 
 func padRec(padLength int) []byte {
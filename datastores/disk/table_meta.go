@@ -0,0 +1,161 @@
+package disk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/jameycribbs/hare/keys"
+)
+
+// A table file can start with a header line holding the table's
+// settings, as a json object of strings, padded with spaces so that it
+// can be rewritten in place:
+//
+//	#{"codec":"msgpack","frames":"binary"}                 ...
+//
+// A table file without a header holds newline-delimited json records.
+const (
+	headerRune  = '#'
+	headerBlock = 128
+
+	metaFrames   = "frames"
+	framesBinary = "binary"
+
+	metaChecksum  = "checksum"
+	checksumCRC32 = "crc32"
+
+	metaKey = "key"
+)
+
+// encodeHeader takes a table's settings and returns its header line.
+func encodeHeader(meta map[string]string) ([]byte, error) {
+	rawMeta, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	headerLen := (len(rawMeta) + 2 + headerBlock - 1) / headerBlock * headerBlock
+
+	header := make([]byte, headerLen)
+	header[0] = headerRune
+	copy(header[1:], rawMeta)
+
+	for i := len(rawMeta) + 1; i < headerLen-1; i++ {
+		header[i] = ' '
+	}
+	header[headerLen-1] = '\n'
+
+	return header, nil
+}
+
+// readHeader reads the table file's header, if it has one, and sets up
+// the table file to read and write records the way the header says.
+func (t *tableFile) readHeader() error {
+	t.dataStart = 0
+
+	if _, err := t.ptr.Seek(0, 0); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(t.ptr)
+
+	first, err := r.Peek(1)
+	if err == io.EOF {
+		return t.applyMeta(nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	if first[0] != headerRune {
+		return t.applyMeta(nil)
+	}
+
+	header, err := r.ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+
+	var meta map[string]string
+
+	if err := json.Unmarshal(bytes.TrimSpace(header[1:]), &meta); err != nil {
+		return err
+	}
+
+	t.dataStart = int64(len(header))
+
+	return t.applyMeta(meta)
+}
+
+// applyMeta takes a table's settings and sets up the table file to read
+// and write records the way they say.
+func (t *tableFile) applyMeta(meta map[string]string) error {
+	switch meta[metaCompression] {
+	case "", compressionFlate:
+	default:
+		return errUnknownCompression
+	}
+
+	switch meta[metaEncryption] {
+	case "", encryptionAESGCM:
+	default:
+		return errUnknownEncryption
+	}
+
+	switch meta[metaChecksum] {
+	case "", checksumCRC32:
+	default:
+		return errUnknownChecksum
+	}
+
+	dict, err := decodeDictionary(meta)
+	if err != nil {
+		return err
+	}
+
+	t.dict = dict
+
+	t.meta = make(map[string]string)
+	for name, value := range meta {
+		t.meta[name] = value
+	}
+
+	checksum := t.meta[metaChecksum] != ""
+
+	keyed := t.meta[metaKey] != "" && keys.Type(t.meta[metaKey]) != keys.Int
+
+	t.frm = lineFramer{checksum: checksum, keyed: keyed}
+	if t.meta[metaFrames] == framesBinary {
+		t.frm = binaryFramer{checksum: checksum}
+	}
+
+	return nil
+}
+
+// withOptions takes a table's settings and returns them with the
+// datastore's checksums, compression, and encryption added, if the
+// table does not have them yet.
+func (dsk *Disk) withOptions(meta map[string]string) map[string]string {
+	withMeta := make(map[string]string)
+	for name, value := range meta {
+		withMeta[name] = value
+	}
+
+	if dsk.opts.Checksums && withMeta[metaChecksum] == "" {
+		withMeta[metaChecksum] = checksumCRC32
+	}
+
+	if dsk.opts.Compression == CompressFlate && withMeta[metaCompression] == "" {
+		withMeta[metaCompression] = compressionFlate
+		withMeta[metaFrames] = framesBinary
+	}
+
+	if dsk.opts.Encryption != nil && withMeta[metaEncryption] == "" {
+		withMeta[metaEncryption] = encryptionAESGCM
+		withMeta[metaFrames] = framesBinary
+	}
+
+	return withMeta
+}
@@ -30,6 +30,13 @@ func TestNewCloseTableFileTests(t *testing.T) {
 			if !reflect.DeepEqual(want, got) {
 				t.Errorf("want %v; got %v", want, got)
 			}
+
+			wantFree := map[int64]int{56: 44}
+			gotFree := tf.free
+
+			if !reflect.DeepEqual(wantFree, gotFree) {
+				t.Errorf("want %v; got %v", wantFree, gotFree)
+			}
 		},
 		func(t *testing.T) {
 			//close...
@@ -191,6 +198,63 @@ func TestOffsetsTableFileTests(t *testing.T) {
 				}
 			}
 		},
+		func(t *testing.T) {
+			//offsetToFitRec (fit policies)...
+
+			tf := newTestTableFile(t)
+			defer tf.close()
+
+			tf.free = map[int64]int{56: 60, 160: 46, 224: 50}
+
+			tests := []struct {
+				fit     FitPolicy
+				recLen  int
+				want    int
+				wanterr error
+			}{
+				{FirstFit, 45, 56, nil},
+				{BestFit, 45, 160, nil},
+				{BestFit, 47, 224, nil},
+				{BestFit, 61, 0, dummiesTooShortError{}},
+				{AlwaysAppend, 45, 0, dummiesTooShortError{}},
+			}
+
+			for _, tt := range tests {
+				tf.fit = tt.fit
+
+				want := int64(tt.want)
+				got, goterr := tf.offsetToFitRec(tt.recLen)
+				if !((want == got) && (errors.Is(goterr, tt.wanterr))) {
+					t.Errorf("fit %v: want %v; wanterr %v; got %v; goterr %v", tt.fit, want, tt.wanterr, got, goterr)
+				}
+			}
+		},
+		func(t *testing.T) {
+			//claimFree...
+
+			tf := newTestTableFile(t)
+			defer tf.close()
+
+			if err := tf.insertRec(5, []byte(`{"id":5,"first_name":"Rex","age":77}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			want := map[int64]int{93: 7}
+			got := tf.free
+
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			tf.close()
+
+			tf = newTestTableFile(t)
+			defer tf.close()
+
+			if !reflect.DeepEqual(want, tf.free) {
+				t.Errorf("want %v; got %v", want, tf.free)
+			}
+		},
 	}
 
 	runTestFns(t, tests)
@@ -279,6 +343,13 @@ func TestUpdateRecTableFileTests(t *testing.T) {
 				t.Errorf("want %v; got %v", wantOffset, gotOffset)
 			}
 
+			wantFree := map[int64]int{56: 44}
+			gotFree := tf.free
+
+			if !reflect.DeepEqual(wantFree, gotFree) {
+				t.Errorf("want %v; got %v", wantFree, gotFree)
+			}
+
 			rec, err := tf.readRec(3)
 			if err != nil {
 				t.Fatal(err)
@@ -309,6 +380,13 @@ func TestUpdateRecTableFileTests(t *testing.T) {
 				t.Errorf("want %v; got %v", wantOffset, gotOffset)
 			}
 
+			wantFree := map[int64]int{56: 44, 160: 63}
+			gotFree := tf.free
+
+			if !reflect.DeepEqual(wantFree, gotFree) {
+				t.Errorf("want %v; got %v", wantFree, gotFree)
+			}
+
 			rec, err := tf.readRec(3)
 			if err != nil {
 				t.Fatal(err)
@@ -24,6 +24,37 @@ func newTestDisk(t *testing.T) *Disk {
 	return dsk
 }
 
+func newTestDiskWithOptions(t *testing.T, opts Options) *Disk {
+	dsk, err := NewWithOptions("./testdata", ".json", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dsk
+}
+
+// killTestDisk closes a disk's files without checkpointing or removing
+// anything, as if the process had been killed.
+func killTestDisk(t *testing.T, dsk *Disk) {
+	if dsk.wal != nil {
+		if err := dsk.wal.ptr.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if dsk.batch != nil {
+		if err := dsk.batch.ptr.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tableFile := range dsk.tableFiles {
+		if err := tableFile.close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func newTestTableFile(t *testing.T) *tableFile {
 	filePtr, err := os.OpenFile("./testdata/contacts.json", os.O_RDWR, 0660)
 	if err != nil {
@@ -52,7 +83,7 @@ func testTeardown(t *testing.T) {
 }
 
 func testRemoveFiles(t *testing.T) {
-	filesToRemove := []string{"contacts.json", "newtable.json"}
+	filesToRemove := []string{"contacts.json", "newtable.json", "contacts.json.idx", "newtable.json.idx", "contacts.json" + seqExt, "newtable.json" + seqExt, "contacts.json" + quarantineExt, "newtable.json" + quarantineExt, "contacts.json" + fieldIndexExt, "newtable.json" + fieldIndexExt, journalFileName, walFileName, lockFileName}
 
 	for _, f := range filesToRemove {
 		err := os.Remove("./testdata/" + f)
@@ -0,0 +1,384 @@
+package disk
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+const quarantineExt = ".quarantine"
+
+var (
+	errBadID           = errors.New("hare: record id is not a whole number")
+	errBadKey          = errors.New("hare: record key is empty or not a string")
+	errBadJSON         = errors.New("hare: record is not valid json")
+	errNoID            = errors.New("hare: record has no id")
+	errUnknownChecksum = errors.New("hare: table uses an unknown checksum")
+)
+
+// Corruption describes a record in a table file that cannot be read.
+// It is also the error returned when a table file is opened, or a
+// record is read, and a corrupt record is found.
+type Corruption struct {
+	// Table is the name of the table.
+	Table string
+
+	// Offset is where the record starts in the table file.
+	Offset int64
+
+	// Length is the number of bytes the record takes up, or 0 if its
+	// length cannot be told and everything from Offset to the end of
+	// the file is unreadable.
+	Length int
+
+	// Reason says what is wrong with the record.
+	Reason string
+}
+
+func (c *Corruption) Error() string {
+	return fmt.Sprintf("hare: table %s has a corrupt record at offset %d: %s", c.Table, c.Offset, c.Reason)
+}
+
+// Unwrap returns dberr.ErrCorruptRecord, so a Corruption can be checked
+// for with errors.Is.
+func (c *Corruption) Unwrap() error {
+	return dberr.ErrCorruptRecord
+}
+
+// quarantinedRec is a line in a quarantine file.
+type quarantinedRec struct {
+	Offset int64  `json:"offset"`
+	Reason string `json:"reason"`
+	Data   []byte `json:"data"`
+}
+
+// Repair takes every corrupt record Verify would report and moves it
+// to a quarantine file next to its table file, named after the table
+// file with ".quarantine" added.  The record is turned into a dummy in
+// the table file, or cut off if it runs to the end of the file.  It
+// returns the records it moved.
+func (dsk *Disk) Repair() ([]Corruption, error) {
+	if dsk.readOnly() {
+		return nil, dberr.ErrReadOnly
+	}
+
+	dsk.lockWAL()
+	defer dsk.unlockWAL()
+
+	if dsk.batching("") {
+		return nil, dberr.ErrBatchInProgress
+	}
+
+	var repaired []Corruption
+
+	for _, tableName := range dsk.sortedTableNames() {
+		tableFile, err := dsk.getTableFile(tableName)
+		if err != nil {
+			continue
+		}
+
+		corruptions, err := tableFile.verify()
+		if err != nil {
+			return repaired, err
+		}
+
+		if len(corruptions) == 0 {
+			continue
+		}
+
+		if err := tableFile.quarantine(dsk.tablePath(tableName)+quarantineExt, corruptions); err != nil {
+			return repaired, err
+		}
+
+		if err := tableFile.repair(corruptions); err != nil {
+			return repaired, err
+		}
+
+		if err := tableFile.saveSeq(); err != nil {
+			return repaired, err
+		}
+
+		repaired = append(repaired, corruptions...)
+
+		if err := tableFile.scan(false); err != nil {
+			return repaired, err
+		}
+	}
+
+	return repaired, nil
+}
+
+// Verify reads every table file and returns every corrupt record in
+// it: lines that are not json or have no id, records whose checksum
+// does not match, records cut short, and records that cannot be
+// decrypted or decompressed.
+func (dsk *Disk) Verify() ([]Corruption, error) {
+	dsk.lockWAL()
+	defer dsk.unlockWAL()
+
+	var corruptions []Corruption
+
+	for _, tableName := range dsk.sortedTableNames() {
+		tableFile, err := dsk.getTableFile(tableName)
+		if err != nil {
+			continue
+		}
+
+		found, err := tableFile.verify()
+		if err != nil {
+			return nil, err
+		}
+
+		corruptions = append(corruptions, found...)
+	}
+
+	return corruptions, nil
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+func (dsk *Disk) sortedTableNames() []string {
+	tableNames := dsk.TableNames()
+	sort.Strings(tableNames)
+
+	return tableNames
+}
+
+// scan reads the table file to find every record and dummy.  Corrupt
+// records are skipped if lenient is true, otherwise the first one is
+// returned as a *Corruption.  A record cut short at the end of the file
+// is always skipped, since it is what a crash in the middle of an
+// append leaves behind, and is kept in torn so it can be cut off before
+// anything is appended to it.
+func (t *tableFile) scan(lenient bool) error {
+	t.offsets = make(map[int]int64)
+	t.dupOffsets = make(map[int][]int64)
+	t.free = make(map[int64]int)
+	t.corrupt = 0
+	t.torn = nil
+
+	if err := t.readHeader(); err != nil {
+		return err
+	}
+
+	return t.scanFrames(func(offset int64, f frame, bad *corruptFrameError) error {
+		switch {
+		case bad == nil:
+		case bad.truncated:
+			t.torn = &Corruption{Table: t.name, Offset: offset, Length: bad.size, Reason: bad.reason}
+			return nil
+		case lenient:
+			t.corrupt++
+			return nil
+		default:
+			return &Corruption{Table: t.name, Offset: offset, Length: bad.size, Reason: bad.reason}
+		}
+
+		// Skip dummy records, but remember where they are so their
+		// space can be reused.
+		if f.rec == nil {
+			t.addFree(offset, f.size-t.frm.overhead())
+			return nil
+		}
+
+		// An interrupted write can leave an older live copy of a
+		// record behind.  The last copy wins, but the others are
+		// remembered so recovery can get rid of them.
+		if dupOffset, ok := t.offsets[f.id]; ok {
+			t.dupOffsets[f.id] = append(t.dupOffsets[f.id], dupOffset)
+		}
+
+		t.offsets[f.id] = offset
+
+		return nil
+	})
+}
+
+// scanFrames reads every frame in the table file, in order, and calls
+// fn with the offset of each one and either the frame or what is wrong
+// with it.
+func (t *tableFile) scanFrames(fn func(offset int64, f frame, bad *corruptFrameError) error) error {
+	if _, err := t.ptr.Seek(t.dataStart, 0); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(t.ptr)
+	offset := t.dataStart
+
+	for {
+		f, err := t.frm.read(r, true)
+		if err == io.EOF {
+			return nil
+		}
+
+		var bad *corruptFrameError
+		if errors.As(err, &bad) {
+			if err := fn(offset, frame{}, bad); err != nil {
+				return err
+			}
+
+			// Nothing can be read after a frame of unknown length.
+			if bad.size == 0 || bad.truncated {
+				return nil
+			}
+
+			offset += int64(bad.size)
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := fn(offset, f, nil); err != nil {
+			return err
+		}
+
+		offset += int64(f.size)
+	}
+}
+
+// verify reads the table file and returns every corrupt record in it.
+func (t *tableFile) verify() ([]Corruption, error) {
+	var corruptions []Corruption
+
+	err := t.scanFrames(func(offset int64, f frame, bad *corruptFrameError) error {
+		if bad != nil {
+			corruptions = append(corruptions, Corruption{Table: t.name, Offset: offset, Length: bad.size, Reason: bad.reason})
+			return nil
+		}
+
+		if f.rec == nil {
+			return nil
+		}
+
+		_, err := t.decodeRec(f.id, f.rec)
+		if err == nil {
+			return nil
+		}
+
+		if errors.Is(err, errNoKeyProvider) {
+			return err
+		}
+
+		corruptions = append(corruptions, Corruption{Table: t.name, Offset: offset, Length: f.size, Reason: reasonFor(err)})
+
+		return nil
+	})
+
+	return corruptions, err
+}
+
+// quarantine takes the path of a quarantine file and corrupt records
+// in the table file and appends the records' bytes to the quarantine
+// file.
+func (t *tableFile) quarantine(path string, corruptions []Corruption) error {
+	info, err := t.ptr.Stat()
+	if err != nil {
+		return err
+	}
+
+	filePtr, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0660)
+	if err != nil {
+		return err
+	}
+	defer filePtr.Close()
+
+	w := bufio.NewWriter(filePtr)
+
+	for _, c := range corruptions {
+		length := int64(c.Length)
+		if length == 0 || c.Offset+length > info.Size() {
+			length = info.Size() - c.Offset
+		}
+
+		data := make([]byte, length)
+
+		if _, err := t.ptr.ReadAt(data, c.Offset); err != nil {
+			return err
+		}
+
+		line, err := json.Marshal(quarantinedRec{Offset: c.Offset, Reason: c.Reason, Data: data})
+		if err != nil {
+			return err
+		}
+
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return filePtr.Sync()
+}
+
+// repair takes corrupt records in the table file and turns them into
+// dummies, or cuts the file off at the first one that runs to its end.
+func (t *tableFile) repair(corruptions []Corruption) error {
+	info, err := t.ptr.Stat()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range corruptions {
+		if c.Length == 0 || c.Offset+int64(c.Length) >= info.Size() {
+			if err := t.invalidateIndex(); err != nil {
+				return err
+			}
+
+			if err := t.ptr.Truncate(c.Offset); err != nil {
+				return err
+			}
+
+			break
+		}
+
+		if err := t.writeRec(c.Offset, 0, t.frm.dummy(c.Length)); err != nil {
+			return err
+		}
+	}
+
+	return t.ptr.Sync()
+}
+
+// trimTorn takes the path of a quarantine file and, if the table file
+// ends in a record cut short, moves that record to the quarantine file
+// and cuts the table file off where it starts.  Otherwise the next
+// record appended would run on from the cut short one.
+func (t *tableFile) trimTorn(quarantinePath string) error {
+	if t.torn == nil {
+		return nil
+	}
+
+	corruptions := []Corruption{*t.torn}
+
+	if err := t.quarantine(quarantinePath, corruptions); err != nil {
+		return err
+	}
+
+	if err := t.repair(corruptions); err != nil {
+		return err
+	}
+
+	t.torn = nil
+
+	return nil
+}
+
+// reasonFor takes an error found reading a record and returns it as the
+// reason for a Corruption.
+func reasonFor(err error) string {
+	return strings.TrimPrefix(err.Error(), "hare: ")
+}
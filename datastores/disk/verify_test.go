@@ -0,0 +1,360 @@
+package disk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// corruptTestFile takes a table file name, a string found in it, and a
+// string to put in its place, and rewrites the file with the change.
+func corruptTestFile(t *testing.T, fileName string, old string, new string) {
+	data, err := os.ReadFile("./testdata/" + fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Contains(data, []byte(old)) {
+		t.Fatalf("%s does not hold %q", fileName, old)
+	}
+
+	data = bytes.Replace(data, []byte(old), []byte(new), 1)
+
+	if err := os.WriteFile("./testdata/"+fileName, data, 0660); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyRepairDiskTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//New with a corrupt line...
+
+			corruptTestFile(t, "contacts.json", `"Abe",`, `"Abe";`)
+
+			_, err := NewWithOptions("./testdata", ".json", Options{})
+
+			var c *Corruption
+			if !errors.As(err, &c) {
+				t.Fatalf("want a *Corruption; got %v", err)
+			}
+
+			if !errors.Is(err, dberr.ErrCorruptRecord) {
+				t.Errorf("want %v; got %v", dberr.ErrCorruptRecord, err)
+			}
+
+			want := Corruption{Table: "contacts", Offset: 101, Length: 59, Reason: "record is not valid json"}
+			if !reflect.DeepEqual(want, *c) {
+				t.Errorf("want %+v; got %+v", want, *c)
+			}
+		},
+		func(t *testing.T) {
+			//New with a line with no id or a bad id...
+
+			corruptTestFile(t, "contacts.json", `{"id":2,`, `{"ix":2,`)
+			corruptTestFile(t, "contacts.json", `{"id":3,"first_name":"Bill"`, `{"id":"a","first_name":"Bi"`)
+
+			dsk := newTestDiskWithOptions(t, Options{Lenient: true})
+			defer dsk.Close()
+
+			want := []Corruption{
+				{Table: "contacts", Offset: 101, Length: 59, Reason: "record has no id"},
+				{Table: "contacts", Offset: 160, Length: 64, Reason: "record id is not a whole number"},
+			}
+
+			got, err := dsk.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("want %+v; got %+v", want, got)
+			}
+		},
+		func(t *testing.T) {
+			//Lenient, Verify, and Repair...
+
+			corruptTestFile(t, "contacts.json", `"Abe",`, `"Abe";`)
+
+			f, err := os.OpenFile("./testdata/contacts.json", os.O_APPEND|os.O_WRONLY, 0660)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.WriteString(`{"id":5,"first_`); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			dsk := newTestDiskWithOptions(t, Options{Lenient: true})
+
+			wantIDs := []int{1, 3, 4}
+			gotIDs, err := dsk.IDs("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sort.Ints(gotIDs)
+
+			if !reflect.DeepEqual(wantIDs, gotIDs) {
+				t.Errorf("want %v; got %v", wantIDs, gotIDs)
+			}
+
+			// The record cut short at the end was quarantined and cut
+			// off when the table was opened.
+			want := []Corruption{
+				{Table: "contacts", Offset: 101, Length: 59, Reason: "record is not valid json"},
+			}
+
+			got, err := dsk.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("want %+v; got %+v", want, got)
+			}
+
+			got, err = dsk.Repair()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("want %+v; got %+v", want, got)
+			}
+
+			got, err = dsk.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != 0 {
+				t.Errorf("want no corruptions after repair; got %+v", got)
+			}
+
+			// The freed line can be reused.
+			if err := dsk.InsertRec("contacts", 5, []byte(`{"id":5,"first_name":"Bo"}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			wantRec := []byte(`{"id":5,"first_name":"Bo"}` + "\n")
+			gotRec, err := dsk.ReadRec("contacts", 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(wantRec, gotRec) {
+				t.Errorf("want %s; got %s", wantRec, gotRec)
+			}
+
+			// The quarantine file holds the bad lines.
+			f, err = os.Open("./testdata/contacts.json" + quarantineExt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			var quarantined []quarantinedRec
+
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				var q quarantinedRec
+				if err := json.Unmarshal(scanner.Bytes(), &q); err != nil {
+					t.Fatal(err)
+				}
+				quarantined = append(quarantined, q)
+			}
+
+			wantQuarantined := []quarantinedRec{
+				{Offset: 284, Reason: "record is cut short", Data: []byte(`{"id":5,"first_`)},
+				{Offset: 101, Reason: "record is not valid json", Data: []byte(`{"id":2,"first_name":"Abe";"last_name":"Lincoln","age":52}` + "\n")},
+			}
+
+			if !reflect.DeepEqual(wantQuarantined, quarantined) {
+				t.Errorf("want %+v; got %+v", wantQuarantined, quarantined)
+			}
+		},
+		func(t *testing.T) {
+			//New with a record cut short at the end...
+
+			f, err := os.OpenFile("./testdata/contacts.json", os.O_APPEND|os.O_WRONLY, 0660)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.WriteString(`{"id":5,"first_`); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			dsk := newTestDiskWithOptions(t, Options{FitPolicy: AlwaysAppend})
+
+			if err := dsk.InsertRec("contacts", 5, []byte(`{"id":5,"first_name":"Bo"}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Without the offset index the table file is scanned, and
+			// the new record must not have been appended to the one cut
+			// short.
+			if err := os.Remove("./testdata/contacts.json.idx"); err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			wantRec := []byte(`{"id":5,"first_name":"Bo"}` + "\n")
+			gotRec, err := dsk.ReadRec("contacts", 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(wantRec, gotRec) {
+				t.Errorf("want %s; got %s", wantRec, gotRec)
+			}
+
+			got, err := dsk.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != 0 {
+				t.Errorf("want no corruptions; got %+v", got)
+			}
+
+			data, err := os.ReadFile("./testdata/contacts.json" + quarantineExt)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Contains(data, []byte(`"reason":"record is cut short"`)) {
+				t.Errorf("want the record cut short quarantined; got %s", data)
+			}
+		},
+		func(t *testing.T) {
+			//Checksums (lines)...
+
+			dsk := newTestDiskWithOptions(t, Options{Checksums: true})
+
+			if err := dsk.CreateTable("newtable"); err != nil {
+				t.Fatal(err)
+			}
+
+			for id, rec := range map[int]string{1: `{"id":1,"name":"Ann"}`, 2: `{"id":2,"name":"Ben"}`} {
+				if err := dsk.InsertRec("newtable", id, []byte(rec)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := dsk.UpdateRec("newtable", 1, []byte(`{"id":1,"name":"Al"}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			wantRec := []byte(`{"id":1,"name":"Al"}` + "\n")
+			gotRec, err := dsk.ReadRec("newtable", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(wantRec, gotRec) {
+				t.Errorf("want %s; got %s", wantRec, gotRec)
+			}
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			corruptTestFile(t, "newtable.json", `"Ben"`, `"Bem"`)
+
+			if _, err := NewWithOptions("./testdata", ".json", Options{}); !errors.Is(err, dberr.ErrCorruptRecord) {
+				t.Fatalf("want %v; got %v", dberr.ErrCorruptRecord, err)
+			}
+
+			dsk = newTestDiskWithOptions(t, Options{Lenient: true})
+			defer dsk.Close()
+
+			got, err := dsk.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != 1 || got[0].Table != "newtable" || got[0].Reason != "checksum does not match" {
+				t.Errorf("want a checksum mismatch in newtable; got %+v", got)
+			}
+
+			if _, err := dsk.ReadRec("newtable", 1); err != nil {
+				t.Fatal(err)
+			}
+		},
+		func(t *testing.T) {
+			//Checksums (binary frames)...
+
+			dsk := newTestDiskWithOptions(t, Options{Checksums: true})
+
+			if err := dsk.CreateTableWithMeta("newtable", map[string]string{metaFrames: framesBinary}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.InsertRec("newtable", 1, []byte("first\nrecord")); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.InsertRec("newtable", 2, []byte("second record")); err != nil {
+				t.Fatal(err)
+			}
+
+			corruptTestFile(t, "newtable.json", "first", "fIrst")
+
+			// A record that is already open is checked when it is read.
+			if _, err := dsk.ReadRec("newtable", 1); !errors.Is(err, dberr.ErrCorruptRecord) {
+				t.Errorf("want %v; got %v", dberr.ErrCorruptRecord, err)
+			}
+
+			got, err := dsk.Repair()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != 1 || got[0].Reason != "checksum does not match" {
+				t.Errorf("want a checksum mismatch; got %+v", got)
+			}
+
+			if _, err := dsk.ReadRec("newtable", 1); !errors.Is(err, dberr.ErrNoRecord) {
+				t.Errorf("want %v; got %v", dberr.ErrNoRecord, err)
+			}
+
+			wantRec := []byte("second record")
+			gotRec, err := dsk.ReadRec("newtable", 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(wantRec, gotRec) {
+				t.Errorf("want %s; got %s", wantRec, gotRec)
+			}
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
@@ -0,0 +1,197 @@
+package disk
+
+import (
+	"os"
+	"sync"
+)
+
+const walFileName = "hare.wal"
+
+const defaultCheckpointEvery = 1000
+
+// wal is the write-ahead log.  Every write is appended to it and synced
+// before the table file is touched, so a write that has been
+// acknowledged can always be replayed.
+type wal struct {
+	sync.Mutex
+	ptr    *os.File
+	writes int
+	every  int
+}
+
+// Checkpoint syncs every table file and truncates the write-ahead log.
+// It is a no-op if the write-ahead log is not turned on.
+func (dsk *Disk) Checkpoint() error {
+	if dsk.wal == nil {
+		return nil
+	}
+
+	dsk.wal.Lock()
+	defer dsk.wal.Unlock()
+
+	return dsk.checkpoint()
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+// checkpoint expects the caller to hold the wal lock.
+func (dsk *Disk) checkpoint() error {
+	for _, tableFile := range dsk.allTableFiles() {
+		if err := tableFile.ptr.Sync(); err != nil {
+			return err
+		}
+	}
+
+	if err := dsk.wal.ptr.Truncate(0); err != nil {
+		return err
+	}
+
+	if _, err := dsk.wal.ptr.Seek(0, 0); err != nil {
+		return err
+	}
+
+	dsk.wal.writes = 0
+
+	return nil
+}
+
+func (dsk *Disk) closeWAL() error {
+	if dsk.wal == nil {
+		return nil
+	}
+
+	dsk.wal.Lock()
+	defer dsk.wal.Unlock()
+
+	if err := dsk.checkpoint(); err != nil {
+		return err
+	}
+
+	if err := dsk.wal.ptr.Close(); err != nil {
+		return err
+	}
+
+	dsk.wal = nil
+
+	return os.Remove(dsk.walPath())
+}
+
+// lockWAL keeps writes to different tables from interleaving in the
+// write-ahead log or with a checkpoint.
+func (dsk *Disk) lockWAL() {
+	if dsk.wal != nil {
+		dsk.wal.Lock()
+	}
+}
+
+// logWrite takes an operation, a table name, a record id, and the
+// record being written and appends them to the write-ahead log, with
+// the record compressed and encrypted the way the table stores it.  It
+// expects the caller to hold the wal lock.
+func (dsk *Disk) logWrite(op string, tableName string, id int, rec []byte) error {
+	if dsk.wal == nil {
+		return nil
+	}
+
+	if tableFile, err := dsk.getTableFile(tableName); err == nil && rec != nil {
+		var err error
+
+		if rec, err = tableFile.encodeRec(id, rec); err != nil {
+			return err
+		}
+	}
+
+	if err := writeLogEntry(dsk.wal.ptr, logEntry{Op: op, Table: tableName, ID: id, Rec: rec}); err != nil {
+		return err
+	}
+
+	dsk.wal.writes++
+
+	return nil
+}
+
+// maybeCheckpoint expects the caller to hold the wal lock.
+func (dsk *Disk) maybeCheckpoint() error {
+	if dsk.wal == nil || dsk.wal.writes < dsk.wal.every {
+		return nil
+	}
+
+	return dsk.checkpoint()
+}
+
+func (dsk *Disk) openWAL() error {
+	filePtr, err := os.OpenFile(dsk.walPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0660)
+	if err != nil {
+		return err
+	}
+
+	w := wal{ptr: filePtr, every: dsk.opts.CheckpointEvery}
+
+	if w.every <= 0 {
+		w.every = defaultCheckpointEvery
+	}
+
+	dsk.wal = &w
+
+	return nil
+}
+
+// replayWAL re-applies every write found in the write-ahead log, in
+// order, and then removes the log.  Applying a write removes every copy
+// of the record first, so writes that were made in full, in part, or not
+// at all before the log was closed all end up the same.  A record cut
+// short at the end of a table file has already been cut off when the
+// table was loaded, so the records replayed are not appended to it.
+func (dsk *Disk) replayWAL() error {
+	entries, err := readLog(dsk.walPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		tableFile, err := dsk.getTableFile(entry.Table)
+		if err != nil {
+			continue
+		}
+
+		if err := tableFile.purgeRec(entry.ID); err != nil {
+			return err
+		}
+
+		if entry.Op == opDelete {
+			continue
+		}
+
+		rec, err := tableFile.decodeRec(entry.ID, entry.Rec)
+		if err != nil {
+			return err
+		}
+
+		if err := tableFile.insertRec(entry.ID, rec); err != nil {
+			return err
+		}
+	}
+
+	for _, tableFile := range dsk.allTableFiles() {
+		if err := tableFile.ptr.Sync(); err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(dsk.walPath())
+}
+
+func (dsk *Disk) unlockWAL() {
+	if dsk.wal != nil {
+		dsk.wal.Unlock()
+	}
+}
+
+func (dsk *Disk) walPath() string {
+	return dsk.path + "/" + walFileName
+}
@@ -0,0 +1,188 @@
+package disk
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestWALDiskTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//replayWAL...
+
+			dsk := newTestDiskWithOptions(t, Options{WAL: true})
+
+			if err := dsk.InsertRec("contacts", 5, []byte(`{"id":5,"first_name":"Rex","last_name":"Stout","age":77}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.UpdateRec("contacts", 3, []byte(`{"id":3,"first_name":"William","last_name":"Shakespeare","age":18}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.DeleteRec("contacts", 1); err != nil {
+				t.Fatal(err)
+			}
+
+			killTestDisk(t, dsk)
+
+			// Throw away the table file changes, as if they never
+			// made it to disk.
+			cmd := exec.Command("cp", "./testdata/contacts.bak", "./testdata/contacts.json")
+			if err := cmd.Run(); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			for id, want := range map[int]string{
+				3: "{\"id\":3,\"first_name\":\"William\",\"last_name\":\"Shakespeare\",\"age\":18}\n",
+				5: "{\"id\":5,\"first_name\":\"Rex\",\"last_name\":\"Stout\",\"age\":77}\n",
+			} {
+				rec, err := dsk.ReadRec("contacts", id)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got := string(rec)
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+
+			wantErr := dberr.ErrNoRecord
+			_, gotErr := dsk.ReadRec("contacts", 1)
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+
+			if _, err := os.Stat(dsk.walPath()); !os.IsNotExist(err) {
+				t.Errorf("want wal removed; got %v", err)
+			}
+		},
+		func(t *testing.T) {
+			//replayWAL (torn update left two copies)...
+
+			f, err := os.OpenFile("./testdata/contacts.json", os.O_APPEND|os.O_WRONLY, 0660)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := f.WriteString("{\"id\":3,\"first_name\":\"William\",\"last_name\":\"Shakespeare\",\"age\":18}\n"); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			f, err = os.Create("./testdata/" + walFileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := writeLogEntry(f, logEntry{Op: opUpdate, Table: "contacts", ID: 3, Rec: []byte(`{"id":3,"first_name":"William","last_name":"Shakespeare","age":18}`)}); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			dsk := newTestDisk(t)
+			dsk.Close()
+
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			want := 0
+			got := len(dsk.tableFiles["contacts"].dupOffsets)
+
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+		func(t *testing.T) {
+			//replayWAL (table file ends in a record cut short)...
+
+			f, err := os.OpenFile("./testdata/contacts.json", os.O_APPEND|os.O_WRONLY, 0660)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := f.WriteString(`{"id":5,"first_na`); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			f, err = os.Create("./testdata/" + walFileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := writeLogEntry(f, logEntry{Op: opInsert, Table: "contacts", ID: 5, Rec: []byte(`{"id":5,"first_name":"Rex"}`)}); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			dsk := newTestDiskWithOptions(t, Options{FitPolicy: AlwaysAppend})
+			dsk.Close()
+
+			// Scan the table file rather than trust the offset index.
+			if err := os.Remove("./testdata/contacts.json.idx"); err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			want := "{\"id\":5,\"first_name\":\"Rex\"}\n"
+			rec, err := dsk.ReadRec("contacts", 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := string(rec); want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+		func(t *testing.T) {
+			//Checkpoint...
+
+			dsk := newTestDiskWithOptions(t, Options{WAL: true, CheckpointEvery: 2})
+			defer dsk.Close()
+
+			if err := dsk.DeleteRec("contacts", 1); err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := os.Stat(dsk.walPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if info.Size() == 0 {
+				t.Errorf("want wal to hold a write; got size %v", info.Size())
+			}
+
+			if err := dsk.DeleteRec("contacts", 2); err != nil {
+				t.Fatal(err)
+			}
+
+			info, err = os.Stat(dsk.walPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := int64(0)
+			got := info.Size()
+
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
@@ -0,0 +1,120 @@
+package ram
+
+import "github.com/jameycribbs/hare/dberr"
+
+// undoEntry records the state of a record before a write made during a
+// batch.  A nil rec means the record did not exist.
+type undoEntry struct {
+	tableName string
+	id        int
+	rec       []byte
+}
+
+// batch holds the undo entries for the writes made between BeginBatch
+// and CommitBatch or RollbackBatch.
+type batch struct {
+	tables  map[string]struct{}
+	entries []undoEntry
+}
+
+// BeginBatch takes the names of the tables that are about to be
+// changed together and starts remembering their writes so they can be
+// undone by RollbackBatch.
+func (ram *Ram) BeginBatch(tableNames []string) error {
+	ram.batchLock.Lock()
+	defer ram.batchLock.Unlock()
+
+	if ram.batch != nil {
+		return dberr.ErrBatchInProgress
+	}
+
+	b := batch{tables: make(map[string]struct{})}
+
+	for _, tableName := range tableNames {
+		if !ram.TableExists(tableName) {
+			return dberr.ErrNoTable
+		}
+
+		b.tables[tableName] = struct{}{}
+	}
+
+	ram.batch = &b
+
+	return nil
+}
+
+// CommitBatch keeps every write made during the batch.
+func (ram *Ram) CommitBatch() error {
+	ram.batchLock.Lock()
+	defer ram.batchLock.Unlock()
+
+	if ram.batch == nil {
+		return dberr.ErrNoBatch
+	}
+
+	ram.batch = nil
+
+	return nil
+}
+
+// RollbackBatch undoes every write made during the batch.
+func (ram *Ram) RollbackBatch() error {
+	ram.batchLock.Lock()
+	defer ram.batchLock.Unlock()
+
+	if ram.batch == nil {
+		return dberr.ErrNoBatch
+	}
+
+	entries := ram.batch.entries
+	ram.batch = nil
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+
+		table, err := ram.getTable(entry.tableName)
+		if err != nil {
+			continue
+		}
+
+		if entry.rec == nil {
+			delete(table.records, entry.id)
+		} else {
+			table.writeRec(entry.id, entry.rec)
+		}
+	}
+
+	return nil
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+// remember takes a table name and a record id and, if the table is part
+// of a batch, saves the record's current state before it is written.
+func (ram *Ram) remember(tableName string, id int) {
+	ram.batchLock.Lock()
+	defer ram.batchLock.Unlock()
+
+	if ram.batch == nil {
+		return
+	}
+
+	if _, ok := ram.batch.tables[tableName]; !ok {
+		return
+	}
+
+	entry := undoEntry{tableName: tableName, id: id}
+
+	table, err := ram.getTable(tableName)
+	if err != nil {
+		return
+	}
+
+	if rec, ok := table.records[id]; ok {
+		entry.rec = rec
+	}
+
+	ram.batch.entries = append(ram.batch.entries, entry)
+}
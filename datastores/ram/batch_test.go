@@ -0,0 +1,99 @@
+package ram
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestBatchRamTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//CommitBatch...
+
+			ram := newTestRam(t)
+			defer ram.Close()
+
+			if err := ram.BeginBatch([]string{"contacts"}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ram.DeleteRec("contacts", 3); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ram.CommitBatch(); err != nil {
+				t.Fatal(err)
+			}
+
+			wantErr := dberr.ErrNoRecord
+			_, gotErr := ram.ReadRec("contacts", 3)
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+		},
+		func(t *testing.T) {
+			//RollbackBatch...
+
+			ram := newTestRam(t)
+			defer ram.Close()
+
+			if err := ram.BeginBatch([]string{"contacts"}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ram.UpdateRec("contacts", 3, []byte(`{"id":3,"first_name":"William","last_name":"Shakespeare","age":18}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ram.DeleteRec("contacts", 1); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ram.InsertRec("contacts", 5, []byte(`{"id":5,"first_name":"Rex","last_name":"Stout","age":77}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ram.RollbackBatch(); err != nil {
+				t.Fatal(err)
+			}
+
+			for id, want := range seedData() {
+				rec, err := ram.ReadRec("contacts", id)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got := string(rec)
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+
+			wantErr := dberr.ErrNoRecord
+			_, gotErr := ram.ReadRec("contacts", 5)
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+		},
+		func(t *testing.T) {
+			//RollbackBatch (ErrNoBatch error)...
+
+			ram := newTestRam(t)
+			defer ram.Close()
+
+			wantErr := dberr.ErrNoBatch
+			gotErr := ram.RollbackBatch()
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
@@ -1,11 +1,19 @@
 package ram
 
-import "github.com/jameycribbs/hare/dberr"
+import (
+	"sync"
+
+	"github.com/jameycribbs/hare/dberr"
+)
 
 // Ram is a struct that holds a map of all the
-// tables in the datastore.
+// tables in the datastore.  The map has a lock of its own, so tables can
+// be created and removed while other tables are in use.
 type Ram struct {
-	tables map[string]*table
+	tablesLock sync.RWMutex
+	tables     map[string]*table
+	batchLock  sync.Mutex
+	batch      *batch
 }
 
 // New takes a map of maps with seed data
@@ -22,19 +30,42 @@ func New(seedData map[string]map[int]string) (*Ram, error) {
 
 // Close closes the datastore.
 func (ram *Ram) Close() error {
+	ram.tablesLock.Lock()
+	defer ram.tablesLock.Unlock()
+
 	ram.tables = nil
 
+	ram.batchLock.Lock()
+	ram.batch = nil
+	ram.batchLock.Unlock()
+
 	return nil
 }
 
 // CreateTable takes a table name, creates a new table
 // and adds it to the map of tables in the datastore.
 func (ram *Ram) CreateTable(tableName string) error {
-	if ram.TableExists(tableName) {
+	return ram.CreateTableWithMeta(tableName, nil)
+}
+
+// CreateTableWithMeta takes a table name and the table's settings,
+// creates a new table, and adds it to the map of tables in the
+// datastore.
+func (ram *Ram) CreateTableWithMeta(tableName string, meta map[string]string) error {
+	ram.tablesLock.Lock()
+	defer ram.tablesLock.Unlock()
+
+	if _, ok := ram.tables[tableName]; ok {
 		return dberr.ErrTableExists
 	}
 
-	ram.tables[tableName] = newTable()
+	table := newTable()
+
+	for name, value := range meta {
+		table.meta[name] = value
+	}
+
+	ram.tables[tableName] = table
 
 	return nil
 }
@@ -47,6 +78,10 @@ func (ram *Ram) DeleteRec(tableName string, id int) error {
 		return err
 	}
 
+	if table.recExists(id) {
+		ram.remember(tableName, id)
+	}
+
 	if err = table.deleteRec(id); err != nil {
 		return err
 	}
@@ -88,6 +123,8 @@ func (ram *Ram) InsertRec(tableName string, id int, rec []byte) error {
 		return dberr.ErrIDExists
 	}
 
+	ram.remember(tableName, id)
+
 	table.writeRec(id, rec)
 
 	return nil
@@ -112,7 +149,10 @@ func (ram *Ram) ReadRec(tableName string, id int) ([]byte, error) {
 // RemoveTable takes a table name and deletes that table from the
 // datastore.
 func (ram *Ram) RemoveTable(tableName string) error {
-	if !ram.TableExists(tableName) {
+	ram.tablesLock.Lock()
+	defer ram.tablesLock.Unlock()
+
+	if _, ok := ram.tables[tableName]; !ok {
 		return dberr.ErrNoTable
 	}
 
@@ -121,16 +161,66 @@ func (ram *Ram) RemoveTable(tableName string) error {
 	return nil
 }
 
+// Sequence takes a table name and returns the greatest record id ever
+// written to the table, even if that record has since been deleted.
+func (ram *Ram) Sequence(tableName string) (int, error) {
+	table, err := ram.getTable(tableName)
+	if err != nil {
+		return 0, err
+	}
+
+	return table.seq, nil
+}
+
+// SetSequence takes a table name and a record id and moves the table's
+// sequence forward to that id.
+func (ram *Ram) SetSequence(tableName string, seq int) error {
+	table, err := ram.getTable(tableName)
+	if err != nil {
+		return err
+	}
+
+	if seq < table.seq {
+		return dberr.ErrSequenceTooLow
+	}
+
+	table.seq = seq
+
+	return nil
+}
+
 // TableExists takes a table name and returns a bool indicating
 // whether or not the table exists in the datastore.
 func (ram *Ram) TableExists(tableName string) bool {
+	ram.tablesLock.RLock()
+	defer ram.tablesLock.RUnlock()
+
 	_, ok := ram.tables[tableName]
 
 	return ok
 }
 
+// TableMeta takes a table name and returns the settings the table was
+// created with.
+func (ram *Ram) TableMeta(tableName string) (map[string]string, error) {
+	table, err := ram.getTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := make(map[string]string)
+	for name, value := range table.meta {
+		meta[name] = value
+	}
+
+	return meta, nil
+}
+
 // TableNames returns an array of table names.
 func (ram *Ram) TableNames() []string {
+	ram.tablesLock.RLock()
+	defer ram.tablesLock.RUnlock()
+
 	var names []string
 
 	for k := range ram.tables {
@@ -152,6 +242,8 @@ func (ram *Ram) UpdateRec(tableName string, id int, rec []byte) error {
 		return dberr.ErrNoRecord
 	}
 
+	ram.remember(tableName, id)
+
 	table.writeRec(id, rec)
 
 	return nil
@@ -162,6 +254,9 @@ func (ram *Ram) UpdateRec(tableName string, id int, rec []byte) error {
 //******************************************************************************
 
 func (ram *Ram) getTable(tableName string) (*table, error) {
+	ram.tablesLock.RLock()
+	defer ram.tablesLock.RUnlock()
+
 	table, ok := ram.tables[tableName]
 	if !ok {
 		return nil, dberr.ErrNoTable
@@ -171,6 +266,9 @@ func (ram *Ram) getTable(tableName string) (*table, error) {
 }
 
 func (ram *Ram) getTables() ([]string, error) {
+	ram.tablesLock.RLock()
+	defer ram.tablesLock.RUnlock()
+
 	var tableNames []string
 
 	for name := range ram.tables {
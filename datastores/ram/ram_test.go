@@ -86,6 +86,36 @@ func TestCreateTableRamTests(t *testing.T) {
 				t.Errorf("want %v; got %v", wantErr, gotErr)
 			}
 		},
+		func(t *testing.T) {
+			//CreateTableWithMeta and TableMeta...
+
+			ram := newTestRam(t)
+			defer ram.Close()
+
+			want := map[string]string{"key": "uuid7"}
+
+			if err := ram.CreateTableWithMeta("newtable", want); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ram.TableMeta("newtable")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			got, err = ram.TableMeta("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != 0 {
+				t.Errorf("want no settings; got %v", got)
+			}
+		},
 	}
 
 	runTestFns(t, tests)
@@ -353,6 +383,66 @@ func TestRemoveTableRamTests(t *testing.T) {
 	runTestFns(t, tests)
 }
 
+func TestSequenceRamTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//Sequence (after deleting the last record)...
+
+			ram := newTestRam(t)
+			defer ram.Close()
+
+			if err := ram.DeleteRec("contacts", 4); err != nil {
+				t.Fatal(err)
+			}
+
+			want := 4
+			got, err := ram.Sequence("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+		func(t *testing.T) {
+			//SetSequence...
+
+			ram := newTestRam(t)
+			defer ram.Close()
+
+			if err := ram.SetSequence("contacts", 100); err != nil {
+				t.Fatal(err)
+			}
+
+			want := 100
+			got, err := ram.Sequence("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+		func(t *testing.T) {
+			//SetSequence (SequenceTooLow error)...
+
+			ram := newTestRam(t)
+			defer ram.Close()
+
+			wantErr := dberr.ErrSequenceTooLow
+			gotErr := ram.SetSequence("contacts", 3)
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
+
 func TestTableExistsRamTests(t *testing.T) {
 	var tests = []func(t *testing.T){
 		func(t *testing.T) {
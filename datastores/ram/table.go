@@ -4,12 +4,15 @@ import "github.com/jameycribbs/hare/dberr"
 
 type table struct {
 	records map[int][]byte
+	meta    map[string]string
+	seq     int
 }
 
 func newTable() *table {
 	var t table
 
 	t.records = make(map[int][]byte)
+	t.meta = make(map[string]string)
 
 	return &t
 }
@@ -65,4 +68,8 @@ func (t *table) recExists(id int) bool {
 
 func (t *table) writeRec(id int, rec []byte) {
 	t.records[id] = rec
+
+	if id > t.seq {
+		t.seq = id
+	}
 }
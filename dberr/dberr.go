@@ -3,15 +3,96 @@ package dberr
 import "errors"
 
 var (
+	// ErrBatchInProgress error means the datastore is already in the middle of a batch of writes.
+	ErrBatchInProgress = errors.New("hare: a batch is already in progress")
+
+	// ErrCanceled error means an operation gave up because its context was canceled or its deadline passed.
+	ErrCanceled = errors.New("hare: operation canceled")
+
+	// ErrClosed error means the database has been closed.
+	ErrClosed = errors.New("hare: database is closed")
+
+	// ErrConflict error means a record was changed by someone else after the version that was given.
+	ErrConflict = errors.New("hare: record has changed since that version")
+
+	// ErrCorruptRecord error means a record in a table file could not be read because it was damaged or badly edited.
+	ErrCorruptRecord = errors.New("hare: table file holds a corrupt record")
+
+	// ErrIDChanged error means a patch tried to change the id of the record it was applied to.
+	ErrIDChanged = errors.New("hare: patch cannot change a record's id")
+
 	// ErrIDExists error means a record with the specified id already exists in the table.
 	ErrIDExists = errors.New("hare: record with that id already exists")
 
+	// ErrIndexExists error means an index on the specified field already exists for the table.
+	ErrIndexExists = errors.New("hare: index on that field already exists")
+
+	// ErrInvalidID error means a record's id is not a valid id to store the record under.
+	ErrInvalidID = errors.New("hare: record id must be greater than zero")
+
+	// ErrInvalidKey error means a record's key is not a valid key for the table's key type.
+	ErrInvalidKey = errors.New("hare: key is not valid for the table's key type")
+
+	// ErrInvalidPatch error means a patch is not a valid json merge patch or json patch, or names a field the record does not have.
+	ErrInvalidPatch = errors.New("hare: patch is not valid for the record")
+
+	// ErrKeyType error means a method was used on a table with a different key type than it works with.
+	ErrKeyType = errors.New("hare: table has a different key type")
+
+	// ErrLocked error means another process holds a conflicting lock on the database.
+	ErrLocked = errors.New("hare: database is locked by another process")
+
+	// ErrLockNotSupported error means file locking is not available on this platform.
+	ErrLockNotSupported = errors.New("hare: file locking is not supported on this platform")
+
+	// ErrNoBatch error means there is no batch of writes in progress to commit or roll back.
+	ErrNoBatch = errors.New("hare: no batch in progress")
+
+	// ErrNoIDField error means a record is not a pointer to a struct with an id field and does not implement hare.Record.
+	ErrNoIDField = errors.New("hare: record has no id field")
+
+	// ErrNoIndex error means no index on the specified field exists for the table.
+	ErrNoIndex = errors.New("hare: no index on that field exists")
+
 	// ErrNoRecord error means no record with the specified id was not found.
 	ErrNoRecord = errors.New("hare: no record with that id found")
 
 	// ErrNoTable error means a table that the specified name does not exist.
 	ErrNoTable = errors.New("hare: table with that name does not exist")
 
+	// ErrNoVersionField error means a record does not implement hare.VersionedRecord and has no version field.
+	ErrNoVersionField = errors.New("hare: record has no version field")
+
+	// ErrPatchTestFailed error means a test operation in a json patch found a different value than it expected.
+	ErrPatchTestFailed = errors.New("hare: json patch test failed")
+
+	// ErrReadOnly error means the database was opened read-only and cannot be written to.
+	ErrReadOnly = errors.New("hare: database is read-only")
+
+	// ErrSequenceTooLow error means a table's sequence was set lower than an id it has already handed out.
+	ErrSequenceTooLow = errors.New("hare: sequence is lower than an id already handed out")
+
 	// ErrTableExists error means a table with the specified name already exists in the database.
 	ErrTableExists = errors.New("hare: table with that name already exists")
+
+	// ErrTampered error means an encrypted record failed authentication, because it was changed or corrupted on disk.
+	ErrTampered = errors.New("hare: record failed authentication")
+
+	// ErrTxDone error means the transaction has already been committed or rolled back.
+	ErrTxDone = errors.New("hare: transaction has already been committed or rolled back")
+
+	// ErrTxNotSupported error means the datastore cannot apply a batch of writes atomically.
+	ErrTxNotSupported = errors.New("hare: datastore does not support transactions")
+
+	// ErrUnknownCodec error means a table was written with a codec that was not given to the database.
+	ErrUnknownCodec = errors.New("hare: table uses an unknown codec")
+
+	// ErrUnknownKeyType error means a table was created with a key type hare does not know.
+	ErrUnknownKeyType = errors.New("hare: table uses an unknown key type")
+
+	// ErrUnknownOperator error means a query used a comparison operator hare does not know.
+	ErrUnknownOperator = errors.New("hare: unknown query operator")
+
+	// ErrWatcherTooSlow error means a watcher fell so far behind the writes to its table that it was closed.
+	ErrWatcherTooSlow = errors.New("hare: watcher fell too far behind and was closed")
 )
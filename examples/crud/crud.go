@@ -92,6 +92,21 @@ func main() {
 			fmt.Printf("\t-- Comment for episode %v: %v\n", r.Episode, c.Text)
 		}
 	}
+
+	//----- TYPED TABLES -----
+
+	// A typed table handle does away with the table name strings and
+	// the hand-written QueryEpisodes function.
+	episodes := hare.TableOf[models.Episode](db, "episodes")
+
+	ep, err := episodes.First(func(e *models.Episode) bool {
+		return e.Film == "The Skydivers - The Final Cut"
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Season %v episode %v is '%v'\n", ep.Season, ep.Episode, ep.Film)
 }
 
 func init() {
@@ -23,32 +23,25 @@ type Episode struct {
 
 // GetID returns the record id.
 // This method is used internally by Hare.
-// You need to add this method to each one of
-// your models.
+// It is optional; without it, Hare finds the
+// field tagged "id" on its own.
 func (e *Episode) GetID() int {
 	return e.ID
 }
 
 // SetID takes an id. This method is used
 // internally by Hare.
-// You need to add this method to each one of
-// your models.
+// It is optional, like GetID.
 func (e *Episode) SetID(id int) {
 	e.ID = id
 }
 
 // AfterFind is a callback that is run by Hare after
 // a record is found.
-// You need to add this method to each one of your
-// models, but the only required lines are the first one
-// and the last one.
+// It is optional; add it only to the models that
+// need to do something when they are read.
 func (e *Episode) AfterFind(db *hare.Database) error {
-	// IMPORTANT!!!  This line of code is necessary in your AfterFind
-	//               in order for the Find method to work correctly!
-	*e = Episode(*e)
-
-	// Except for the last line, none of the lines below are
-	// required, but they are a good example of extra
+	// The lines below are a good example of extra
 	// functionality you can implement in your callbacks.
 
 	// This is an example of how you can do a Rails-like
@@ -74,8 +67,6 @@ func (e *Episode) AfterFind(db *hare.Database) error {
 		return err
 	}
 
-	// IMPORTANT!!!  This line of code is necessary in your AfterFind
-	//               in order for the Find method to work correctly!
 	return nil
 }
 
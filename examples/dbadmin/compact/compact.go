@@ -1,85 +1,38 @@
 package main
 
 import (
-	"bufio"
-	"io/ioutil"
-	"os"
-	"strings"
+	"fmt"
+
+	"github.com/jameycribbs/hare"
+	"github.com/jameycribbs/hare/datastores/disk"
 )
 
 // This is an example of a script you could
 // write to periodically compact your database.
-
-// IMPORTANT!!!  Before running this script or
-// one like it that you write, make sure no
-// processes are using the database!!!
-
-const dirPath = "./data/"
-const tblExt = ".json"
+//
+// Compaction holds the table lock and swaps the
+// new table file in with a rename, so it is safe
+// to run while this process is using the
+// database.  If other processes have the same
+// database open, they need to be stopped first.
 
 func main() {
-	files, err := ioutil.ReadDir(dirPath)
+	ds, err := disk.New("./data", ".json")
 	if err != nil {
 		panic(err)
 	}
 
-	for _, file := range files {
-		filename := file.Name()
-
-		// If entry is sub dir, current dir, or parent dir, skip it.
-		if file.IsDir() || filename == "." || filename == ".." {
-			continue
-		}
-
-		if !strings.HasSuffix(filename, tblExt) {
-			continue
-		}
-
-		compactFile(filename)
-		if err != nil {
-			panic(err)
-		}
-	}
-}
-
-func compactFile(filename string) error {
-	filepath := dirPath + filename
-	backupFilepath := dirPath + strings.TrimSuffix(filename, tblExt) + ".old"
-
-	// Move the table to a backup file.
-	if err := os.Rename(filepath, backupFilepath); err != nil {
-		return err
-	}
-
-	oldfile, err := os.Open(backupFilepath)
-	if err != nil {
-		return err
-	}
-	defer oldfile.Close()
-
-	newfile, err := os.Create(filepath)
+	db, err := hare.New(ds)
 	if err != nil {
-		return err
+		panic(err)
 	}
-	defer newfile.Close()
-
-	oldfileScanner := bufio.NewScanner(oldfile)
-	for oldfileScanner.Scan() {
-		str := strings.TrimRight(oldfileScanner.Text(), "X")
+	defer db.Close()
 
-		if len(str) > 0 {
-			_, err := newfile.WriteString(str + "\n")
-			if err != nil {
-				return err
-			}
+	for _, tableName := range ds.TableNames() {
+		if err := db.Compact(tableName); err != nil {
+			panic(err)
 		}
-	}
 
-	if err := oldfileScanner.Err(); err != nil {
-		return err
+		fmt.Println("Compacted table:", tableName)
 	}
-
-	newfile.Sync()
-
-	return nil
 }
@@ -0,0 +1,131 @@
+package hare
+
+// Records can implement any of the hook interfaces below to have the
+// Database call them around writes.  Hooks run while the Database holds
+// the table's write lock, so they must not read or write the same table
+// through the Database, though they can use other tables.  An error
+// from a before hook, or from Validate, aborts the write; an error from
+// an after hook is returned, but the write has already been made.
+
+// AfterFinder is implemented by records that need to run code after they
+// are read, like looking up associated records.
+type AfterFinder interface {
+	AfterFind(*Database) error
+}
+
+// BeforeInserter is implemented by records that need to run code before
+// they are inserted.  The record's id has already been set.
+type BeforeInserter interface {
+	BeforeInsert(*Database) error
+}
+
+// AfterInserter is implemented by records that need to run code after
+// they are inserted.
+type AfterInserter interface {
+	AfterInsert(*Database) error
+}
+
+// BeforeUpdater is implemented by records that need to run code before
+// they are updated.
+type BeforeUpdater interface {
+	BeforeUpdate(*Database) error
+}
+
+// AfterUpdater is implemented by records that need to run code after
+// they are updated.
+type AfterUpdater interface {
+	AfterUpdate(*Database) error
+}
+
+// BeforeDeleter is implemented by records that need to run code before
+// they are deleted by DeleteRecord.  The record holds what is stored.
+type BeforeDeleter interface {
+	BeforeDelete(*Database) error
+}
+
+// AfterDeleter is implemented by records that need to run code after
+// they are deleted by DeleteRecord.
+type AfterDeleter interface {
+	AfterDelete(*Database) error
+}
+
+// Validator is implemented by records that can check themselves before
+// they are inserted or updated.  Validate runs after BeforeInsert or
+// BeforeUpdate, so it sees any changes they made.
+type Validator interface {
+	Validate() error
+}
+
+// unexported methods
+
+func (db *Database) afterDelete(rec interface{}) error {
+	if hook, ok := rec.(AfterDeleter); ok {
+		return hook.AfterDelete(db)
+	}
+
+	return nil
+}
+
+func (db *Database) afterInsert(rec interface{}) error {
+	if hook, ok := rec.(AfterInserter); ok {
+		return hook.AfterInsert(db)
+	}
+
+	return nil
+}
+
+func (db *Database) afterUpdate(rec interface{}) error {
+	if hook, ok := rec.(AfterUpdater); ok {
+		return hook.AfterUpdate(db)
+	}
+
+	return nil
+}
+
+func (db *Database) beforeDelete(rec interface{}) error {
+	if hook, ok := rec.(BeforeDeleter); ok {
+		return hook.BeforeDelete(db)
+	}
+
+	return nil
+}
+
+// beforeInsert runs the record's BeforeInsert hook and then validates
+// it.
+func (db *Database) beforeInsert(rec interface{}) error {
+	if hook, ok := rec.(BeforeInserter); ok {
+		if err := hook.BeforeInsert(db); err != nil {
+			return err
+		}
+	}
+
+	return validate(rec)
+}
+
+// beforeUpdate runs the record's BeforeUpdate hook and then validates
+// it.
+func (db *Database) beforeUpdate(rec interface{}) error {
+	if hook, ok := rec.(BeforeUpdater); ok {
+		if err := hook.BeforeUpdate(db); err != nil {
+			return err
+		}
+	}
+
+	return validate(rec)
+}
+
+// hasDeleteHooks takes a record and returns true if it has a delete hook.
+func hasDeleteHooks(rec interface{}) bool {
+	_, before := rec.(BeforeDeleter)
+	_, after := rec.(AfterDeleter)
+
+	return before || after
+}
+
+func validate(rec interface{}) error {
+	if v, ok := rec.(Validator); ok {
+		return v.Validate()
+	}
+
+	return nil
+}
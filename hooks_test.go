@@ -0,0 +1,204 @@
+package hare
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+var errTestHook = errors.New("hook said no")
+
+// hookedContact is a contact that records the hooks run on it.
+type hookedContact struct {
+	Contact
+	calls []string
+}
+
+func (c *hookedContact) AfterDelete(db *Database) error {
+	c.calls = append(c.calls, "AfterDelete "+c.FirstName)
+	return nil
+}
+
+func (c *hookedContact) AfterInsert(db *Database) error {
+	c.calls = append(c.calls, "AfterInsert")
+	return nil
+}
+
+func (c *hookedContact) AfterUpdate(db *Database) error {
+	c.calls = append(c.calls, "AfterUpdate")
+	return nil
+}
+
+func (c *hookedContact) BeforeDelete(db *Database) error {
+	c.calls = append(c.calls, "BeforeDelete "+c.FirstName)
+
+	if c.Age > 50 {
+		return errTestHook
+	}
+
+	return nil
+}
+
+func (c *hookedContact) BeforeInsert(db *Database) error {
+	c.calls = append(c.calls, "BeforeInsert")
+
+	if c.LastName == "" {
+		c.LastName = "Unknown"
+	}
+
+	return nil
+}
+
+func (c *hookedContact) BeforeUpdate(db *Database) error {
+	c.calls = append(c.calls, "BeforeUpdate")
+
+	if c.Age < 0 {
+		return errTestHook
+	}
+
+	return nil
+}
+
+func (c *hookedContact) Validate() error {
+	c.calls = append(c.calls, "Validate")
+
+	if c.FirstName == "" {
+		return errTestHook
+	}
+
+	return nil
+}
+
+func TestHookTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//Insert hooks...
+
+			return func(t *testing.T) {
+				c := hookedContact{Contact: Contact{FirstName: "Robin"}}
+
+				id, err := db.Insert("contacts", &c)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := []string{"BeforeInsert", "Validate", "AfterInsert"}
+				if !reflect.DeepEqual(want, c.calls) {
+					t.Errorf("want %v; got %v", want, c.calls)
+				}
+
+				found := Contact{}
+				if err := db.Find("contacts", id, &found); err != nil {
+					t.Fatal(err)
+				}
+
+				if found.LastName != "Unknown" {
+					t.Errorf("want %v; got %v", "Unknown", found.LastName)
+				}
+
+				// A record that fails validation is not written, and
+				// its id is handed out again.
+				_, gotErr := db.Insert("contacts", &hookedContact{})
+				checkErr(t, errTestHook, gotErr)
+
+				nextID, err := db.Insert("contacts", &hookedContact{Contact: Contact{FirstName: "Ann"}})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if nextID != id+1 {
+					t.Errorf("want %v; got %v", id+1, nextID)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Update hooks...
+
+			return func(t *testing.T) {
+				c := hookedContact{Contact: Contact{ID: 1, FirstName: "Jack", Age: 38}}
+
+				if err := db.Update("contacts", &c); err != nil {
+					t.Fatal(err)
+				}
+
+				want := []string{"BeforeUpdate", "Validate", "AfterUpdate"}
+				if !reflect.DeepEqual(want, c.calls) {
+					t.Errorf("want %v; got %v", want, c.calls)
+				}
+
+				checkErr(t, errTestHook, db.Update("contacts", &hookedContact{Contact: Contact{ID: 1, FirstName: "Jill", Age: -1}}))
+
+				found := Contact{}
+				if err := db.Find("contacts", 1, &found); err != nil {
+					t.Fatal(err)
+				}
+
+				if found.FirstName != "Jack" {
+					t.Errorf("want %v; got %v", "Jack", found.FirstName)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Delete hooks...
+
+			return func(t *testing.T) {
+				c := hookedContact{Contact: Contact{ID: 3}}
+
+				if err := db.DeleteRecord("contacts", &c); err != nil {
+					t.Fatal(err)
+				}
+
+				want := []string{"BeforeDelete Bill", "AfterDelete Bill"}
+				if !reflect.DeepEqual(want, c.calls) {
+					t.Errorf("want %v; got %v", want, c.calls)
+				}
+
+				checkErr(t, dberr.ErrNoRecord, db.Find("contacts", 3, &Contact{}))
+
+				// Abe is too old to be deleted.
+				checkErr(t, errTestHook, TableOf[hookedContact](db, "contacts").Delete(2))
+
+				if err := db.Find("contacts", 2, &Contact{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Transaction hooks...
+
+			return func(t *testing.T) {
+				tx, err := db.Begin()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				_, gotErr := tx.Insert("contacts", &hookedContact{})
+				checkErr(t, errTestHook, gotErr)
+
+				c := hookedContact{Contact: Contact{FirstName: "Robin"}}
+
+				if _, err := tx.Insert("contacts", &c); err != nil {
+					t.Fatal(err)
+				}
+
+				want := []string{"BeforeInsert", "Validate"}
+				if !reflect.DeepEqual(want, c.calls) {
+					t.Errorf("want %v; got %v", want, c.calls)
+				}
+
+				if err := tx.Commit(); err != nil {
+					t.Fatal(err)
+				}
+
+				want = append(want, "AfterInsert")
+				if !reflect.DeepEqual(want, c.calls) {
+					t.Errorf("want %v; got %v", want, c.calls)
+				}
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
@@ -0,0 +1,501 @@
+package hare
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// index maps the values found at a json field path to the ids of the
+// records holding those values.
+type index struct {
+	path    []string
+	entries map[string]map[int]struct{}
+	keys    map[int]string
+}
+
+func newIndex(fieldPath string) *index {
+	var idx index
+
+	idx.path = strings.Split(fieldPath, ".")
+	idx.entries = make(map[string]map[int]struct{})
+	idx.keys = make(map[int]string)
+
+	return &idx
+}
+
+func (idx *index) add(id int, doc interface{}) error {
+	value, ok := docValue(doc, idx.path)
+	if !ok {
+		return nil
+	}
+
+	key, err := indexKey(value)
+	if err != nil {
+		return err
+	}
+
+	ids, ok := idx.entries[key]
+	if !ok {
+		ids = make(map[int]struct{})
+		idx.entries[key] = ids
+	}
+
+	ids[id] = struct{}{}
+	idx.keys[id] = key
+
+	return nil
+}
+
+func (idx *index) ids(key string) []int {
+	ids := make([]int, 0, len(idx.entries[key]))
+
+	for id := range idx.entries[key] {
+		ids = append(ids, id)
+	}
+
+	sort.Ints(ids)
+
+	return ids
+}
+
+func (idx *index) remove(id int) {
+	key, ok := idx.keys[id]
+	if !ok {
+		return
+	}
+
+	delete(idx.entries[key], id)
+
+	if len(idx.entries[key]) == 0 {
+		delete(idx.entries, key)
+	}
+
+	delete(idx.keys, id)
+}
+
+// WithPersistedIndexes returns an option that saves each table's
+// indexes next to the table when the database is closed, if the
+// datastore supports it.  Indexes still have to be created each time
+// the database is opened, but CreateIndex then loads the saved index
+// instead of reading every record, unless the table has been written to
+// without it since.
+func WithPersistedIndexes() Option {
+	return func(db *Database) {
+		db.persistIndexes = true
+	}
+}
+
+// CreateIndex takes a table name and a json field path, like "host_id"
+// or "host.name", and builds an in-memory index of that field's values.
+// The index is kept up to date by Insert, Update, and Delete.  Indexes
+// are only saved with the WithPersistedIndexes option, and have to be
+// created again each time the database is opened.
+func (db *Database) CreateIndex(tableName string, fieldPath string) error {
+	return db.CreateIndexCtx(context.Background(), tableName, fieldPath)
+}
+
+// CreateIndexCtx is CreateIndex with a context for waiting on the table
+// lock and for stopping the scan of the table.
+func (db *Database) CreateIndexCtx(ctx context.Context, tableName string, fieldPath string) error {
+	if !db.TableExists(tableName) {
+		return dberr.ErrNoTable
+	}
+
+	unlock, err := db.lockTable(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, ok := db.tableIndexes(tableName)[fieldPath]; ok {
+		return dberr.ErrIndexExists
+	}
+
+	idx, err := db.loadIndex(tableName, fieldPath)
+	if err != nil {
+		return err
+	}
+
+	if idx == nil {
+		if idx, err = db.buildIndex(ctx, tableName, fieldPath); err != nil {
+			return err
+		}
+	}
+
+	db.tableIndexes(tableName)[fieldPath] = idx
+
+	return nil
+}
+
+// DropIndex takes a table name and a json field path and removes the
+// index on that field.
+func (db *Database) DropIndex(tableName string, fieldPath string) error {
+	return db.DropIndexCtx(context.Background(), tableName, fieldPath)
+}
+
+// DropIndexCtx is DropIndex with a context for waiting on the table
+// lock.
+func (db *Database) DropIndexCtx(ctx context.Context, tableName string, fieldPath string) error {
+	if !db.TableExists(tableName) {
+		return dberr.ErrNoTable
+	}
+
+	unlock, err := db.lockTable(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, ok := db.tableIndexes(tableName)[fieldPath]; !ok {
+		return dberr.ErrNoIndex
+	}
+
+	delete(db.tableIndexes(tableName), fieldPath)
+
+	return nil
+}
+
+// FindBy takes a table name, a json field path, a value, and a pointer
+// to a slice of structs (or of pointers to structs) and populates the
+// slice with every record whose field equals the value, in id order.
+// If the field is indexed the index is used, otherwise the table is
+// scanned.
+func (db *Database) FindBy(tableName string, fieldPath string, value interface{}, recs interface{}) error {
+	return db.FindByCtx(context.Background(), tableName, fieldPath, value, recs)
+}
+
+// FindByCtx is FindBy with a context for waiting on the table lock and
+// for stopping the scan of the table.
+func (db *Database) FindByCtx(ctx context.Context, tableName string, fieldPath string, value interface{}, recs interface{}) error {
+	sliceVal := reflect.ValueOf(recs)
+	if sliceVal.Kind() != reflect.Ptr || sliceVal.Elem().Kind() != reflect.Slice {
+		return errors.New("hare: FindBy needs a pointer to a slice")
+	}
+
+	rawRecs, err := db.findRawBy(ctx, tableName, fieldPath, value)
+	if err != nil {
+		return err
+	}
+
+	sliceVal = sliceVal.Elem()
+	sliceVal.Set(sliceVal.Slice(0, 0))
+
+	for _, rawRec := range rawRecs {
+		if err := db.appendRec(sliceVal, db.codecFor(tableName), rawRec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindIDsBy takes a table name, a json field path, and a value, and
+// returns the ids of every record whose field equals the value, in
+// ascending order.
+func (db *Database) FindIDsBy(tableName string, fieldPath string, value interface{}) ([]int, error) {
+	return db.FindIDsByCtx(context.Background(), tableName, fieldPath, value)
+}
+
+// FindIDsByCtx is FindIDsBy with a context for waiting on the table
+// lock and for stopping the scan of the table.
+func (db *Database) FindIDsByCtx(ctx context.Context, tableName string, fieldPath string, value interface{}) ([]int, error) {
+	if !db.TableExists(tableName) {
+		return nil, dberr.ErrNoTable
+	}
+
+	unlock, err := db.rlockTable(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return db.idsBy(ctx, tableName, fieldPath, value)
+}
+
+// unexported methods
+
+func (db *Database) appendRec(sliceVal reflect.Value, codec Codec, rawRec []byte) error {
+	elemType := sliceVal.Type().Elem()
+
+	var recPtr reflect.Value
+	if elemType.Kind() == reflect.Ptr {
+		recPtr = reflect.New(elemType.Elem())
+	} else {
+		recPtr = reflect.New(elemType)
+	}
+
+	if err := codec.Unmarshal(rawRec, recPtr.Interface()); err != nil {
+		return err
+	}
+
+	if err := db.afterFind(recPtr.Interface()); err != nil {
+		return err
+	}
+
+	if elemType.Kind() == reflect.Ptr {
+		sliceVal.Set(reflect.Append(sliceVal, recPtr))
+	} else {
+		sliceVal.Set(reflect.Append(sliceVal, recPtr.Elem()))
+	}
+
+	return nil
+}
+
+// buildIndex takes a context, a table name, and a json field path and
+// reads the whole table to build an index of that field's values.  It
+// expects the caller to hold the table lock.
+func (db *Database) buildIndex(ctx context.Context, tableName string, fieldPath string) (*index, error) {
+	idx := newIndex(fieldPath)
+
+	ids, err := db.store.IDs(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if err := ctxErr(ctx); err != nil {
+			return nil, err
+		}
+
+		rawRec, err := db.store.ReadRec(tableName, id)
+		if err != nil {
+			return nil, err
+		}
+
+		doc, err := db.decodeDoc(tableName, rawRec)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := idx.add(id, doc); err != nil {
+			return nil, err
+		}
+	}
+
+	return idx, nil
+}
+
+// loadIndex takes a table name and a json field path and returns the
+// index on that field saved when the database was last closed, or nil
+// if there is none or the table has been written to since.  It expects
+// the caller to hold the table lock.
+func (db *Database) loadIndex(tableName string, fieldPath string) (*index, error) {
+	store, ok := db.store.(indexStorer)
+	if !db.persistIndexes || !ok {
+		return nil, nil
+	}
+
+	data, err := store.LoadFieldIndexes(tableName)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var saved map[string]map[string][]int
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+
+	entries, ok := saved[fieldPath]
+	if !ok {
+		return nil, nil
+	}
+
+	idx := newIndex(fieldPath)
+
+	for key, ids := range entries {
+		idx.entries[key] = make(map[int]struct{}, len(ids))
+
+		for _, id := range ids {
+			idx.entries[key][id] = struct{}{}
+			idx.keys[id] = key
+		}
+	}
+
+	return idx, nil
+}
+
+// saveIndexes takes the names of every table and saves the indexes of
+// each table that has any.  It expects the caller to hold every table
+// lock.
+func (db *Database) saveIndexes(tableNames []string) error {
+	store, ok := db.store.(indexStorer)
+	if !db.persistIndexes || db.readOnly || !ok {
+		return nil
+	}
+
+	for _, tableName := range tableNames {
+		indexes := db.tableIndexes(tableName)
+		if len(indexes) == 0 {
+			continue
+		}
+
+		saved := make(map[string]map[string][]int, len(indexes))
+		for fieldPath, idx := range indexes {
+			entries := make(map[string][]int, len(idx.entries))
+
+			for key := range idx.entries {
+				entries[key] = idx.ids(key)
+			}
+
+			saved[fieldPath] = entries
+		}
+
+		data, err := json.Marshal(saved)
+		if err != nil {
+			return err
+		}
+
+		if err := store.SaveFieldIndexes(tableName, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *Database) findRawBy(ctx context.Context, tableName string, fieldPath string, value interface{}) ([][]byte, error) {
+	if !db.TableExists(tableName) {
+		return nil, dberr.ErrNoTable
+	}
+
+	unlock, err := db.rlockTable(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	ids, err := db.idsBy(ctx, tableName, fieldPath, value)
+	if err != nil {
+		return nil, err
+	}
+
+	rawRecs := make([][]byte, 0, len(ids))
+
+	for _, id := range ids {
+		rawRec, err := db.store.ReadRec(tableName, id)
+		if err != nil {
+			return nil, err
+		}
+
+		rawRecs = append(rawRecs, rawRec)
+	}
+
+	return rawRecs, nil
+}
+
+// idsBy expects the caller to hold the table lock.
+func (db *Database) idsBy(ctx context.Context, tableName string, fieldPath string, value interface{}) ([]int, error) {
+	key, err := indexKey(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if idx, ok := db.tableIndexes(tableName)[fieldPath]; ok {
+		return idx.ids(key), nil
+	}
+
+	idx, err := db.buildIndex(ctx, tableName, fieldPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return idx.ids(key), nil
+}
+
+// tableIndexes takes a table name and returns the table's indexes, by
+// field path.  It expects the caller to hold the table lock.
+func (db *Database) tableIndexes(tableName string) map[string]*index {
+	if tbl, ok := db.table(tableName); ok {
+		return tbl.indexes
+	}
+
+	return nil
+}
+
+// indexRec expects the caller to hold the table lock.
+func (db *Database) indexRec(tableName string, id int, rawRec []byte) error {
+	if len(db.tableIndexes(tableName)) == 0 {
+		return nil
+	}
+
+	doc, err := db.decodeDoc(tableName, rawRec)
+	if err != nil {
+		return err
+	}
+
+	for _, idx := range db.tableIndexes(tableName) {
+		idx.remove(id)
+
+		if err := idx.add(id, doc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unindexRec expects the caller to hold the table lock.
+func (db *Database) unindexRec(tableName string, id int) {
+	for _, idx := range db.tableIndexes(tableName) {
+		idx.remove(id)
+	}
+}
+
+// docValue takes a record decoded into generic json values and a field
+// path and returns the value found at that path.
+func docValue(doc interface{}, path []string) (interface{}, bool) {
+	value := doc
+
+	for _, name := range path {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		value, ok = obj[name]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// indexKey takes a value and returns its canonical json encoding, so
+// that, for example, the int 3 and the float64 3 produce the same key.
+func indexKey(value interface{}) (string, error) {
+	generic, err := normalizeValue(value)
+	if err != nil {
+		return "", err
+	}
+
+	rawValue, err := json.Marshal(generic)
+	if err != nil {
+		return "", err
+	}
+
+	return string(rawValue), nil
+}
+
+// normalizeValue takes a value and returns it the way it would look
+// after a round trip through json, so it can be compared with values
+// read from records.
+func normalizeValue(value interface{}) (interface{}, error) {
+	rawValue, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(rawValue, &generic); err != nil {
+		return nil, err
+	}
+
+	return generic, nil
+}
@@ -0,0 +1,265 @@
+package hare
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/jameycribbs/hare/datastores/disk"
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestIndexTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//CreateIndex...
+
+			return func(t *testing.T) {
+				if err := db.CreateIndex("contacts", "last_name"); err != nil {
+					t.Fatal(err)
+				}
+
+				want := []int{2}
+				got := db.tableIndexes("contacts")["last_name"].ids(`"Lincoln"`)
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//CreateIndex (ErrIndexExists error)...
+
+			return func(t *testing.T) {
+				if err := db.CreateIndex("contacts", "last_name"); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrIndexExists, db.CreateIndex("contacts", "last_name"))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//CreateIndex (ErrNoTable error)...
+
+			return func(t *testing.T) {
+				checkErr(t, dberr.ErrNoTable, db.CreateIndex("nonexistent", "last_name"))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//DropIndex...
+
+			return func(t *testing.T) {
+				if err := db.CreateIndex("contacts", "last_name"); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.DropIndex("contacts", "last_name"); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrNoIndex, db.DropIndex("contacts", "last_name"))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//FindBy...
+
+			return func(t *testing.T) {
+				if err := db.CreateIndex("contacts", "age"); err != nil {
+					t.Fatal(err)
+				}
+
+				var got []Contact
+				if err := db.FindBy("contacts", "age", 52, &got); err != nil {
+					t.Fatal(err)
+				}
+
+				want := []Contact{{ID: 2, FirstName: "Abe", LastName: "Lincoln", Age: 52}}
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//FindBy (no index)...
+
+			return func(t *testing.T) {
+				var got []*Contact
+				if err := db.FindBy("contacts", "first_name", "Helen", &got); err != nil {
+					t.Fatal(err)
+				}
+
+				want := []*Contact{{ID: 4, FirstName: "Helen", LastName: "Keller", Age: 25}}
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//FindIDsBy after Insert, Update, and Delete...
+
+			return func(t *testing.T) {
+				if err := db.CreateIndex("contacts", "last_name"); err != nil {
+					t.Fatal(err)
+				}
+
+				id, err := db.Insert("contacts", &Contact{FirstName: "Mary", LastName: "Lincoln", Age: 43})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.Update("contacts", &Contact{ID: 4, FirstName: "Helen", LastName: "Lincoln", Age: 25}); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.Delete("contacts", 2); err != nil {
+					t.Fatal(err)
+				}
+
+				want := []int{4, id}
+				got, err := db.FindIDsBy("contacts", "last_name", "Lincoln")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				got, err = db.FindIDsBy("contacts", "last_name", "Keller")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(got) != 0 {
+					t.Errorf("want %v; got %v", []int{}, got)
+				}
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
+
+func TestPersistedIndexDiskTests(t *testing.T) {
+	testSetup(t)
+	defer testTeardown(t)
+
+	open := func(opts ...Option) *Database {
+		ds, err := disk.New("./testdata", ".json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err := New(ds, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return db
+	}
+
+	// Without the option, no index is saved.
+	db := open()
+
+	if err := db.CreateIndex("contacts", "last_name"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat("./testdata/contacts.json.fdx"); !os.IsNotExist(err) {
+		t.Errorf("want no saved index; got %v", err)
+	}
+
+	db = open(WithPersistedIndexes())
+
+	if err := db.CreateIndex("contacts", "last_name"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Insert("contacts", &Contact{FirstName: "Rex", LastName: "Doe", Age: 77}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = open(WithPersistedIndexes())
+	defer db.Close()
+
+	loaded, err := db.loadIndex("contacts", "last_name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	built, err := db.buildIndex(context.Background(), "contacts", "last_name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded == nil || !reflect.DeepEqual(built, loaded) {
+		t.Errorf("want %v; got %v", built, loaded)
+	}
+
+	if err := db.CreateIndex("contacts", "last_name"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.FindIDsBy("contacts", "last_name", "Doe")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int{1, 5}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v; got %v", want, got)
+	}
+
+	// Once the table is written to, the saved index is no longer used.
+	if err := db.Delete("contacts", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err = db.loadIndex("contacts", "last_name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded != nil {
+		t.Errorf("want %v; got %v", nil, loaded)
+	}
+}
+
+func TestDocValueTests(t *testing.T) {
+	tests := []struct {
+		path   []string
+		want   interface{}
+		wantOk bool
+	}{
+		{[]string{"name"}, "Joel", true},
+		{[]string{"host", "id"}, float64(2), true},
+		{[]string{"host", "name"}, nil, false},
+		{[]string{"name", "first"}, nil, false},
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal([]byte(`{"id":1,"name":"Joel","host":{"id":2}}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		got, gotOk := docValue(doc, tt.path)
+
+		if tt.want != got || tt.wantOk != gotOk {
+			t.Errorf("want %v, %v; got %v, %v", tt.want, tt.wantOk, got, gotOk)
+		}
+	}
+}
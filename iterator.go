@@ -0,0 +1,207 @@
+package hare
+
+import (
+	"context"
+	"encoding/json"
+	"iter"
+	"sort"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// IterOrder is the order an Iterator returns records in.
+type IterOrder int
+
+const (
+	// IDOrder returns records from the lowest id to the highest.
+	IDOrder IterOrder = iota
+
+	// FileOrder returns records in the order they are stored, which
+	// avoids seeking back and forth through a disk table.  Datastores
+	// that have no such order, like Ram, fall back to IDOrder.
+	FileOrder
+)
+
+// Iterator streams the records of a table one at a time.  It holds the
+// table's read lock from the time it is created until it is exhausted
+// or closed, so it sees the table as it was when iteration started.
+// Writing to the same table before the iterator is closed will
+// deadlock.
+//
+//	it, err := db.Iterate("contacts")
+//	if err != nil {
+//		return err
+//	}
+//	defer it.Close()
+//
+//	for it.Next() {
+//		var c Contact
+//		if err := it.Scan(&c); err != nil {
+//			return err
+//		}
+//	}
+//
+//	return it.Err()
+//
+// All returns the same records as a sequence for a range loop:
+//
+//	for id, rawRec := range it.All() {
+//		...
+//	}
+type Iterator struct {
+	ctx       context.Context
+	db        *Database
+	tableName string
+	ids       []int
+	pos       int
+	id        int
+	rawRec    []byte
+	err       error
+	closed    bool
+	unlock    func()
+}
+
+// Iterate takes a table name and returns an Iterator over the table's
+// records in id order.
+func (db *Database) Iterate(tableName string) (*Iterator, error) {
+	return db.IterateOrderCtx(context.Background(), tableName, IDOrder)
+}
+
+// IterateCtx is Iterate with a context for waiting on the table lock.
+// The iterator stops, with the context's error, once the context is
+// done.
+func (db *Database) IterateCtx(ctx context.Context, tableName string) (*Iterator, error) {
+	return db.IterateOrderCtx(ctx, tableName, IDOrder)
+}
+
+// IterateOrder takes a table name and an order and returns an Iterator
+// over the table's records in that order.
+func (db *Database) IterateOrder(tableName string, order IterOrder) (*Iterator, error) {
+	return db.IterateOrderCtx(context.Background(), tableName, order)
+}
+
+// IterateOrderCtx is IterateOrder with a context for waiting on the
+// table lock.  The iterator stops, with the context's error, once the
+// context is done.
+func (db *Database) IterateOrderCtx(ctx context.Context, tableName string, order IterOrder) (*Iterator, error) {
+	if !db.TableExists(tableName) {
+		return nil, dberr.ErrNoTable
+	}
+
+	unlock, err := db.rlockTable(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+
+	store, ok := db.store.(fileOrderer)
+	if order == FileOrder && ok {
+		ids, err = store.IDsInFileOrder(tableName)
+	} else {
+		ids, err = db.store.IDs(tableName)
+		sort.Ints(ids)
+	}
+
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+
+	return &Iterator{ctx: ctx, db: db, tableName: tableName, ids: ids, unlock: unlock}, nil
+}
+
+// All returns a sequence of the iterator's remaining ids and raw json
+// records, for use with a range loop.  The iterator is closed when the
+// loop ends, and any error is available from Err.
+func (it *Iterator) All() iter.Seq2[int, json.RawMessage] {
+	return func(yield func(int, json.RawMessage) bool) {
+		defer it.Close()
+
+		for it.Next() {
+			rawRec, err := it.db.toJSON(it.tableName, it.rawRec)
+			if err != nil {
+				it.err = err
+				return
+			}
+
+			if !yield(it.id, rawRec) {
+				return
+			}
+		}
+	}
+}
+
+// Close releases the table's read lock.  It is safe to call more than
+// once.
+func (it *Iterator) Close() error {
+	if it.closed {
+		return nil
+	}
+
+	it.closed = true
+	it.rawRec = nil
+	it.unlock()
+
+	return nil
+}
+
+// Err returns the error, if any, that stopped the iterator.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// ID returns the id of the current record.
+func (it *Iterator) ID() int {
+	return it.id
+}
+
+// Next moves the iterator to the next record and returns true, or
+// closes the iterator and returns false if there are no more records, a
+// record could not be read, or the iterator's context is done.
+func (it *Iterator) Next() bool {
+	if it.closed {
+		return false
+	}
+
+	if it.pos >= len(it.ids) {
+		it.Close()
+		return false
+	}
+
+	if err := ctxErr(it.ctx); err != nil {
+		it.err = err
+		it.Close()
+		return false
+	}
+
+	it.id = it.ids[it.pos]
+	it.pos++
+
+	rawRec, err := it.db.store.ReadRec(it.tableName, it.id)
+	if err != nil {
+		it.err = err
+		it.Close()
+		return false
+	}
+
+	it.rawRec = rawRec
+
+	return true
+}
+
+// Rec returns the raw json of the current record.  Records stored with
+// another codec are converted to json.
+func (it *Iterator) Rec() (json.RawMessage, error) {
+	return it.db.toJSON(it.tableName, it.rawRec)
+}
+
+// Scan takes a pointer to a struct and populates it with the current
+// record.
+func (it *Iterator) Scan(rec interface{}) error {
+	if err := it.db.codecFor(it.tableName).Unmarshal(it.rawRec, rec); err != nil {
+		return err
+	}
+
+	return it.db.afterFind(rec)
+}
@@ -0,0 +1,119 @@
+package hare
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestIteratorTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//Next and Scan...
+
+			return func(t *testing.T) {
+				it, err := db.Iterate("contacts")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer it.Close()
+
+				var got []string
+
+				for it.Next() {
+					c := Contact{}
+
+					if err := it.Scan(&c); err != nil {
+						t.Fatal(err)
+					}
+
+					got = append(got, c.FirstName)
+				}
+
+				if err := it.Err(); err != nil {
+					t.Fatal(err)
+				}
+
+				want := []string{"John", "Abe", "Bill", "Helen"}
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//All (early termination releases the lock)...
+
+			return func(t *testing.T) {
+				it, err := db.IterateOrder("contacts", FileOrder)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var got []int
+
+				for id := range it.All() {
+					got = append(got, id)
+					if len(got) == 2 {
+						break
+					}
+				}
+
+				want := []int{1, 2}
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				// This would deadlock if the iterator still held the lock.
+				if err := db.Delete("contacts", 3); err != nil {
+					t.Fatal(err)
+				}
+
+				if it.Next() {
+					t.Error("want Next to return false after the iterator is closed")
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//FileOrder (records moved by an update come last)...
+
+			return func(t *testing.T) {
+				if err := db.Update("contacts", &Contact{ID: 1, FirstName: "Jonathan", LastName: "Doestoevsky", Age: 37}); err != nil {
+					t.Fatal(err)
+				}
+
+				it, err := db.IterateOrder("contacts", FileOrder)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var got []int
+
+				for id := range it.All() {
+					got = append(got, id)
+				}
+
+				if err := it.Err(); err != nil {
+					t.Fatal(err)
+				}
+
+				if len(got) != 4 {
+					t.Fatalf("want 4 records; got %v", got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Iterate (ErrNoTable error)...
+
+			return func(t *testing.T) {
+				_, err := db.Iterate("nonexistent")
+
+				checkErr(t, dberr.ErrNoTable, err)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
@@ -0,0 +1,319 @@
+package hare
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jameycribbs/hare/dberr"
+	"github.com/jameycribbs/hare/keys"
+)
+
+// KeyRecord interface defines the methods a struct representing a record
+// in a table with string keys can implement to get and set its key.
+// Structs that do not implement it need a string field tagged
+// `json:"id"`, or named ID, which is found by reflection.
+type KeyRecord interface {
+	SetKey(string)
+	GetKey() string
+}
+
+// CreateTableWithKey takes a table name and a key type and creates and
+// initializes a new table whose records are identified by keys of that
+// type.  The key type is kept in the table's settings, so it only has to
+// be given once.
+func (db *Database) CreateTableWithKey(tableName string, keyType keys.Type) error {
+	if err := db.checkWritable(); err != nil {
+		return err
+	}
+
+	if !keyType.Known() {
+		return dberr.ErrUnknownKeyType
+	}
+
+	if err := db.checkOpen(); err != nil {
+		return err
+	}
+
+	db.createLock.Lock()
+	defer db.createLock.Unlock()
+
+	if db.TableExists(tableName) {
+		return dberr.ErrTableExists
+	}
+
+	if err := db.createTable(tableName, keyType); err != nil {
+		return err
+	}
+
+	return db.registerTable(tableName, keyType)
+}
+
+// DeleteKey takes the name of a table with string keys and a key and
+// removes that record from the table.
+func (db *Database) DeleteKey(tableName string, key string) error {
+	return db.DeleteKeyCtx(context.Background(), tableName, key)
+}
+
+// DeleteKeyCtx is DeleteKey with a context for waiting on the table
+// lock.
+func (db *Database) DeleteKeyCtx(ctx context.Context, tableName string, key string) error {
+	if err := db.checkKeyed(tableName); err != nil {
+		return err
+	}
+
+	return db.deleteID(ctx, tableName, keys.ID(key), key)
+}
+
+// FindKey takes the name of a table with string keys, a key, and a
+// pointer to a struct, finds the record with that key, and populates the
+// struct.
+func (db *Database) FindKey(tableName string, key string, rec interface{}) error {
+	return db.FindKeyCtx(context.Background(), tableName, key, rec)
+}
+
+// FindKeyCtx is FindKey with a context for waiting on the table lock.
+func (db *Database) FindKeyCtx(ctx context.Context, tableName string, key string, rec interface{}) error {
+	if err := db.checkKeyed(tableName); err != nil {
+		return err
+	}
+
+	return db.find(ctx, tableName, keys.ID(key), key, rec)
+}
+
+// InsertKey takes the name of a table with string keys and a pointer to
+// a record struct and adds a new record to the table.  If the record has
+// no key and the table's key type is generated, like keys.UUIDv7, a new
+// key is made and set on the record.  It returns the record's key.
+func (db *Database) InsertKey(tableName string, rec interface{}) (string, error) {
+	return db.InsertKeyCtx(context.Background(), tableName, rec)
+}
+
+// InsertKeyCtx is InsertKey with a context for waiting on the table
+// lock.
+func (db *Database) InsertKeyCtx(ctx context.Context, tableName string, rec interface{}) (string, error) {
+	if err := db.checkKeyed(tableName); err != nil {
+		return "", err
+	}
+
+	if _, err := db.InsertCtx(ctx, tableName, rec); err != nil {
+		return "", err
+	}
+
+	return recKey(rec)
+}
+
+// KeyType takes a table name and returns the type of its keys.
+func (db *Database) KeyType(tableName string) (keys.Type, error) {
+	if !db.TableExists(tableName) {
+		return "", dberr.ErrNoTable
+	}
+
+	return db.keyType(tableName), nil
+}
+
+// Keys takes the name of a table with string keys and returns the keys
+// of all of its records, sorted.
+func (db *Database) Keys(tableName string) ([]string, error) {
+	return db.KeysCtx(context.Background(), tableName)
+}
+
+// KeysCtx is Keys with a context for waiting on the table lock and for
+// stopping the scan of the table.
+func (db *Database) KeysCtx(ctx context.Context, tableName string) ([]string, error) {
+	if err := db.checkKeyed(tableName); err != nil {
+		return nil, err
+	}
+
+	unlock, err := db.rlockTable(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	ids, err := db.store.IDs(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	recKeys := make([]string, 0, len(ids))
+
+	for _, id := range ids {
+		if err := ctxErr(ctx); err != nil {
+			return nil, err
+		}
+
+		rawRec, err := db.store.ReadRec(tableName, id)
+		if err != nil {
+			return nil, err
+		}
+
+		doc, err := db.decodeDoc(tableName, rawRec)
+		if err != nil {
+			return nil, err
+		}
+
+		key, _ := docValue(doc, []string{"id"})
+		if s, ok := key.(string); ok {
+			recKeys = append(recKeys, s)
+		}
+	}
+
+	sort.Strings(recKeys)
+
+	return recKeys, nil
+}
+
+// unexported methods
+
+// assignID takes a table name and a record about to be inserted and
+// returns the id to store it under.  In a table with int keys, the next
+// id is handed out and set on the record.  In a table with string keys,
+// the record's key is checked, or generated if it is empty and the key
+// type calls for it.  It expects the caller to hold the table lock.
+func (db *Database) assignID(tableName string, rec interface{}) (int, error) {
+	keyType := db.keyType(tableName)
+
+	if keyType == keys.Int {
+		id := db.incrementLastID(tableName)
+
+		if err := setRecID(rec, id); err != nil {
+			db.releaseID(tableName, id)
+			return 0, err
+		}
+
+		return id, nil
+	}
+
+	key, err := recKey(rec)
+	if err != nil {
+		return 0, err
+	}
+
+	if key == "" && keyType.Generated() {
+		if key, err = keyType.New(); err != nil {
+			return 0, err
+		}
+
+		if err := setRecKey(rec, key); err != nil {
+			return 0, err
+		}
+	}
+
+	if !keyType.Valid(key) {
+		return 0, dberr.ErrInvalidKey
+	}
+
+	return keys.ID(key), nil
+}
+
+// checkKey takes a table name, a record id, and the key the id was made
+// from, or an empty key, and returns dberr.ErrNoRecord unless the record
+// stored under the id has that key.  It expects the caller to hold the
+// table lock.
+func (db *Database) checkKey(tableName string, id int, key string) error {
+	if key == "" {
+		return nil
+	}
+
+	rawRec, err := db.store.ReadRec(tableName, id)
+	if err != nil {
+		return err
+	}
+
+	return db.matchKey(tableName, rawRec, key)
+}
+
+// checkKeyed takes a table name and returns an error unless the table
+// exists and has string keys.
+func (db *Database) checkKeyed(tableName string) error {
+	if !db.TableExists(tableName) {
+		return dberr.ErrNoTable
+	}
+
+	if db.keyType(tableName) == keys.Int {
+		return dberr.ErrKeyType
+	}
+
+	return nil
+}
+
+func (db *Database) keyType(tableName string) keys.Type {
+	if _, keyType, ok := db.tableInfo(tableName); ok {
+		return keyType
+	}
+
+	return keys.Int
+}
+
+// loadKeyType takes a table name and returns the key type named in the
+// table's settings.
+func (db *Database) loadKeyType(tableName string) (keys.Type, error) {
+	store, ok := db.store.(metaStorer)
+	if !ok {
+		return keys.Int, nil
+	}
+
+	meta, err := store.TableMeta(tableName)
+	if err != nil {
+		return "", err
+	}
+
+	keyType := keys.Type(meta["key"])
+	if keyType == "" {
+		keyType = keys.Int
+	}
+
+	if !keyType.Known() {
+		return "", dberr.ErrUnknownKeyType
+	}
+
+	return keyType, nil
+}
+
+// matchKey takes a table name, a raw record, and the key the record was
+// looked up by, or an empty key, and returns dberr.ErrNoRecord if the
+// record has a different key.  Records are stored under a hash of their
+// key, so the record found under a key's id can belong to another key.
+func (db *Database) matchKey(tableName string, rawRec []byte, key string) error {
+	if key == "" {
+		return nil
+	}
+
+	doc, err := db.decodeDoc(tableName, rawRec)
+	if err != nil {
+		return err
+	}
+
+	if storedKey, _ := docValue(doc, []string{"id"}); storedKey != key {
+		return dberr.ErrNoRecord
+	}
+
+	return nil
+}
+
+// recID takes a table name and a record and returns the id the record is
+// stored under, and, in a table with string keys, the record's key.
+func (db *Database) recID(tableName string, rec interface{}) (int, string, error) {
+	if db.keyType(tableName) == keys.Int {
+		id, err := recID(rec)
+		return id, "", err
+	}
+
+	key, err := recKey(rec)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return keys.ID(key), key, nil
+}
+
+// releaseID takes a table name and an id handed out by assignID for a
+// record that was not written, and hands it out again if no later one
+// has been.  It expects the caller to hold the table lock.
+func (db *Database) releaseID(tableName string, id int) {
+	tbl, ok := db.table(tableName)
+
+	if ok && tbl.keyType == keys.Int && tbl.lastID == id {
+		tbl.lastID = id - 1
+	}
+}
@@ -0,0 +1,325 @@
+package hare
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/jameycribbs/hare/datastores/disk"
+	"github.com/jameycribbs/hare/dberr"
+	"github.com/jameycribbs/hare/keys"
+)
+
+// keyedContact is a record in a table with string keys.
+type keyedContact struct {
+	Key       string `json:"id"`
+	FirstName string `json:"first_name"`
+	Age       int    `json:"age"`
+}
+
+// methodContact is a record in a table with string keys that gets and
+// sets its own key.
+type methodContact struct {
+	Handle    string `json:"id"`
+	FirstName string `json:"first_name"`
+}
+
+func (c *methodContact) GetKey() string {
+	return c.Handle
+}
+
+func (c *methodContact) SetKey(key string) {
+	c.Handle = key
+}
+
+func TestKeyTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//InsertKey, FindKey, Update, Keys, and DeleteKey (generated keys)...
+
+			return func(t *testing.T) {
+				if err := db.CreateTableWithKey("newtable", keys.UUIDv7); err != nil {
+					t.Fatal(err)
+				}
+
+				c := keyedContact{FirstName: "Robin", Age: 88}
+
+				key, err := db.InsertKey("newtable", &c)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !keys.UUIDv7.Valid(key) || c.Key != key {
+					t.Errorf("want a new uuid set on the record; got %q and %q", key, c.Key)
+				}
+
+				c.Age = 63
+				if err := db.Update("newtable", &c); err != nil {
+					t.Fatal(err)
+				}
+
+				found := keyedContact{}
+				if err := db.FindKey("newtable", key, &found); err != nil {
+					t.Fatal(err)
+				}
+
+				if !reflect.DeepEqual(c, found) {
+					t.Errorf("want %+v; got %+v", c, found)
+				}
+
+				other, err := db.InsertKey("newtable", &keyedContact{FirstName: "Ann"})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				gotKeys, err := db.Keys("newtable")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := []string{key, other}
+				sort.Strings(want)
+
+				if !reflect.DeepEqual(want, gotKeys) {
+					t.Errorf("want %v; got %v", want, gotKeys)
+				}
+
+				if err := db.DeleteKey("newtable", key); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrNoRecord, db.FindKey("newtable", key, &found))
+
+				_, gotErr := db.InsertKey("newtable", &keyedContact{Key: "not-a-uuid"})
+				checkErr(t, dberr.ErrInvalidKey, gotErr)
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//String keys and KeyRecord...
+
+			return func(t *testing.T) {
+				if err := db.CreateTableWithKey("newtable", keys.String); err != nil {
+					t.Fatal(err)
+				}
+
+				key, err := db.InsertKey("newtable", &methodContact{Handle: "robin", FirstName: "Robin"})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if key != "robin" {
+					t.Errorf("want %v; got %v", "robin", key)
+				}
+
+				_, gotErr := db.InsertKey("newtable", &methodContact{Handle: "robin"})
+				checkErr(t, dberr.ErrIDExists, gotErr)
+
+				_, gotErr = db.InsertKey("newtable", &methodContact{})
+				checkErr(t, dberr.ErrInvalidKey, gotErr)
+
+				found, err := TableOf[methodContact](db, "newtable").FindKey("robin")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if found.FirstName != "Robin" {
+					t.Errorf("want %v; got %v", "Robin", found.FirstName)
+				}
+
+				keyType, err := db.KeyType("newtable")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if keyType != keys.String {
+					t.Errorf("want %v; got %v", keys.String, keyType)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Upsert (string keys)...
+
+			return func(t *testing.T) {
+				if err := db.CreateTableWithKey("newtable", keys.String); err != nil {
+					t.Fatal(err)
+				}
+
+				for _, age := range []int{30, 31} {
+					if _, err := db.Upsert("newtable", &keyedContact{Key: "robin", FirstName: "Robin", Age: age}); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				found := keyedContact{}
+				if err := db.FindKey("newtable", "robin", &found); err != nil {
+					t.Fatal(err)
+				}
+
+				if found.Age != 31 {
+					t.Errorf("want %v; got %v", 31, found.Age)
+				}
+
+				gotKeys, err := db.Keys("newtable")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !reflect.DeepEqual([]string{"robin"}, gotKeys) {
+					t.Errorf("want %v; got %v", []string{"robin"}, gotKeys)
+				}
+
+				_, gotErr := db.Upsert("newtable", &keyedContact{FirstName: "Ann"})
+				checkErr(t, dberr.ErrInvalidKey, gotErr)
+
+				checkErr(t, dberr.ErrKeyType, db.InsertWithID("newtable", &keyedContact{Key: "ann"}))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Keys that share an id...
+
+			return func(t *testing.T) {
+				if err := db.CreateTableWithKey("newtable", keys.String); err != nil {
+					t.Fatal(err)
+				}
+
+				// Store ann's record under bob's id, the way it would be
+				// if the two keys hashed to the same id.
+				ann := keyedContact{Key: "ann", FirstName: "Ann", Age: 40}
+
+				rawRec, err := db.codecFor("newtable").Marshal(&ann)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.store.InsertRec("newtable", keys.ID("bob"), rawRec); err != nil {
+					t.Fatal(err)
+				}
+
+				bob := keyedContact{Key: "bob", FirstName: "Bob", Age: 50}
+
+				checkErr(t, dberr.ErrNoRecord, db.FindKey("newtable", "bob", &keyedContact{}))
+				checkErr(t, dberr.ErrNoRecord, db.Update("newtable", &bob))
+				checkErr(t, dberr.ErrNoRecord, db.DeleteRecord("newtable", &keyedContact{Key: "bob"}))
+				checkErr(t, dberr.ErrNoRecord, db.DeleteKey("newtable", "bob"))
+
+				_, gotErr := db.Upsert("newtable", &bob)
+				checkErr(t, dberr.ErrIDExists, gotErr)
+
+				contacts := TableOf[keyedContact](db, "newtable")
+
+				_, gotErr = contacts.FindKey("bob")
+				checkErr(t, dberr.ErrNoRecord, gotErr)
+
+				checkErr(t, dberr.ErrNoRecord, contacts.DeleteKey("bob"))
+
+				tx, err := db.Begin()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer tx.Rollback()
+
+				checkErr(t, dberr.ErrNoRecord, tx.Update("newtable", &bob))
+
+				found := keyedContact{}
+				if err := db.Find("newtable", keys.ID("bob"), &found); err != nil {
+					t.Fatal(err)
+				}
+
+				if found != ann {
+					t.Errorf("want %v; got %v", ann, found)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//ErrKeyType and ErrUnknownKeyType errors...
+
+			return func(t *testing.T) {
+				_, gotErr := db.InsertKey("contacts", &keyedContact{Key: "robin"})
+				checkErr(t, dberr.ErrKeyType, gotErr)
+
+				checkErr(t, dberr.ErrKeyType, db.FindKey("contacts", "1", &Contact{}))
+
+				_, gotErr = db.Keys("contacts")
+				checkErr(t, dberr.ErrKeyType, gotErr)
+
+				checkErr(t, dberr.ErrUnknownKeyType, db.CreateTableWithKey("newtable", keys.Type("serial")))
+
+				keyType, err := db.KeyType("contacts")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if keyType != keys.Int {
+					t.Errorf("want %v; got %v", keys.Int, keyType)
+				}
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
+
+func TestKeyDiskTests(t *testing.T) {
+	for _, codec := range []Codec{JSON, MessagePack} {
+		testSetup(t)
+
+		ds, err := disk.New("./testdata", ".json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err := New(ds, WithCodec(codec))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.CreateTableWithKey("newtable", keys.ULID); err != nil {
+			t.Fatal(err)
+		}
+
+		key, err := db.InsertKey("newtable", &keyedContact{FirstName: "Robin"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// The key type is kept in the table file, and the table file is
+		// read back by key.
+		ds, err = disk.New("./testdata", ".json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err = New(ds, WithCodec(codec))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keyType, err := db.KeyType("newtable")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if keyType != keys.ULID {
+			t.Errorf("want %v; got %v", keys.ULID, keyType)
+		}
+
+		found := keyedContact{}
+		if err := db.FindKey("newtable", key, &found); err != nil {
+			t.Fatal(err)
+		}
+
+		if found.FirstName != "Robin" {
+			t.Errorf("want %v; got %v", "Robin", found.FirstName)
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		testTeardown(t)
+	}
+}
@@ -0,0 +1,198 @@
+// Package keys holds the kinds of primary key a hare table can have.
+// It generates new keys, and maps string keys to the integer ids that
+// datastores store records under.
+package keys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// Type is the kind of primary key a table has.
+type Type string
+
+const (
+	// Int keys are integers handed out in order.  It is the default.
+	Int Type = "int"
+
+	// String keys are any non-empty string, chosen by the caller.
+	String Type = "string"
+
+	// UUIDv4 keys are random UUIDs (RFC 9562, version 4).
+	UUIDv4 Type = "uuid4"
+
+	// UUIDv7 keys are UUIDs that start with the time they were made
+	// (RFC 9562, version 7), so they sort by the millisecond they were
+	// made in.
+	UUIDv7 Type = "uuid7"
+
+	// ULID keys are ULIDs, which also start with the time they were
+	// made.
+	ULID Type = "ulid"
+)
+
+// crockford is the alphabet ULIDs are written in.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Generated returns true if new keys of the type are made by New rather
+// than chosen by the caller.
+func (t Type) Generated() bool {
+	return t == UUIDv4 || t == UUIDv7 || t == ULID
+}
+
+// Known returns true if t is one of the key types in this package.
+func (t Type) Known() bool {
+	switch t {
+	case Int, String, UUIDv4, UUIDv7, ULID:
+		return true
+	default:
+		return false
+	}
+}
+
+// New returns a new key of the type, or an empty string for types whose
+// keys are not generated.
+func (t Type) New() (string, error) {
+	var b [16]byte
+
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	switch t {
+	case UUIDv4:
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+
+		return formatUUID(b), nil
+	case UUIDv7:
+		putMillis(b[:6])
+		b[6] = b[6]&0x0f | 0x70
+		b[8] = b[8]&0x3f | 0x80
+
+		return formatUUID(b), nil
+	case ULID:
+		putMillis(b[:6])
+
+		return formatULID(b), nil
+	default:
+		return "", nil
+	}
+}
+
+// Valid takes a key and returns true if it is a well-formed key of the
+// type.
+func (t Type) Valid(key string) bool {
+	switch t {
+	case String:
+		return key != ""
+	case UUIDv4:
+		return validUUID(key, '4')
+	case UUIDv7:
+		return validUUID(key, '7')
+	case ULID:
+		return validULID(key)
+	default:
+		return false
+	}
+}
+
+// ID takes a string key and returns the integer id its record is stored
+// under: the first 62 bits of the key's SHA-256 hash.  Two keys can
+// still share an id.  By chance, that takes around two billion keys in
+// one table, and choosing two keys that collide on purpose takes about
+// as many hashes.  When it happens, inserting the second key fails with
+// dberr.ErrIDExists, and since hare checks the key of the record it
+// finds under an id, one key's record is never read, updated, or
+// deleted in place of the other's.
+func ID(key string) int {
+	sum := sha256.Sum256([]byte(key))
+
+	id := int(binary.BigEndian.Uint64(sum[:8]) & (1<<62 - 1))
+	if id == 0 {
+		id = 1
+	}
+
+	return id
+}
+
+func formatUUID(b [16]byte) string {
+	var buf [36]byte
+
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+
+	return string(buf[:])
+}
+
+// formatULID writes 128 bits as 26 characters of 5 bits each, the first
+// of which only holds 3.
+func formatULID(b [16]byte) string {
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+
+	var buf [26]byte
+
+	for i := 25; i >= 0; i-- {
+		buf[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(buf[:])
+}
+
+func putMillis(b []byte) {
+	ms := uint64(time.Now().UnixMilli())
+
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
+
+func validULID(key string) bool {
+	if len(key) != 26 || key[0] > '7' {
+		return false
+	}
+
+	for i := 0; i < len(key); i++ {
+		if !strings.ContainsRune(crockford, rune(key[i])) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func validUUID(key string, version byte) bool {
+	if len(key) != 36 || key[14] != version {
+		return false
+	}
+
+	for i := 0; i < len(key); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if key[i] != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", rune(key[i])) {
+				return false
+			}
+		}
+	}
+
+	return strings.ContainsRune("89abAB", rune(key[19]))
+}
@@ -0,0 +1,124 @@
+package keys
+
+import (
+	"testing"
+)
+
+func TestNewTests(t *testing.T) {
+	tests := []struct {
+		keyType Type
+		wantLen int
+	}{
+		{UUIDv4, 36},
+		{UUIDv7, 36},
+		{ULID, 26},
+	}
+
+	for _, tt := range tests {
+		key, err := tt.keyType.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(key) != tt.wantLen {
+			t.Errorf("want %v; got %v", tt.wantLen, len(key))
+		}
+
+		if !tt.keyType.Valid(key) {
+			t.Errorf("want %s to be a valid %s", key, tt.keyType)
+		}
+
+		other, err := tt.keyType.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if key == other {
+			t.Errorf("want two different keys; got %s twice", key)
+		}
+	}
+
+	key, err := String.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key != "" {
+		t.Errorf("want no key; got %v", key)
+	}
+}
+
+func TestValidTests(t *testing.T) {
+	tests := []struct {
+		keyType Type
+		key     string
+		want    bool
+	}{
+		{String, "abc", true},
+		{String, "", false},
+		{UUIDv4, "9b2b5f0e-3c1a-4d7e-8f00-0123456789ab", true},
+		{UUIDv4, "9B2B5F0E-3C1A-4D7E-8F00-0123456789AB", true},
+		{UUIDv4, "9b2b5f0e-3c1a-7d7e-8f00-0123456789ab", false},
+		{UUIDv4, "9b2b5f0e-3c1a-4d7e-cf00-0123456789ab", false},
+		{UUIDv4, "9b2b5f0e3c1a4d7e8f000123456789ab", false},
+		{UUIDv7, "01890a5d-ac96-774b-bcce-b302099a8057", true},
+		{UUIDv7, "01890a5d-ac96-474b-bcce-b302099a8057", false},
+		{ULID, "01ARZ3NDEKTSV4RRFFQ69G5FAV", true},
+		{ULID, "81ARZ3NDEKTSV4RRFFQ69G5FAV", false},
+		{ULID, "01ARZ3NDEKTSV4RRFFQ69G5FAU", false},
+		{Int, "1", false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.keyType.Valid(tt.key); got != tt.want {
+			t.Errorf("%s %q: want %v; got %v", tt.keyType, tt.key, tt.want, got)
+		}
+	}
+}
+
+func TestTimeOrderedTests(t *testing.T) {
+	for _, keyType := range []Type{UUIDv7, ULID} {
+		first, err := keyType.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		prefixLen := 8
+		if keyType == ULID {
+			prefixLen = 10
+		}
+
+		for i := 0; i < 100; i++ {
+			key, err := keyType.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if key[:prefixLen] < first[:prefixLen] {
+				t.Errorf("want %s to sort after %s", key, first)
+			}
+		}
+	}
+}
+
+func TestIDTests(t *testing.T) {
+	want := ID("01ARZ3NDEKTSV4RRFFQ69G5FAV")
+	got := ID("01ARZ3NDEKTSV4RRFFQ69G5FAV")
+
+	if want != got {
+		t.Errorf("want %v; got %v", want, got)
+	}
+
+	if want <= 0 {
+		t.Errorf("want a positive id; got %v", want)
+	}
+
+	// Ids are stored, so the hash must not change.
+	if got := ID("bill"); got != 2464049634768819100 {
+		t.Errorf("want %v; got %v", 2464049634768819100, got)
+	}
+
+	if ID("a") == ID("b") {
+		t.Error("want different ids for different keys")
+	}
+}
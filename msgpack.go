@@ -0,0 +1,275 @@
+package hare
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var errMsgpack = errors.New("hare: invalid or unsupported MessagePack data")
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return marshalBinary(msgpackCodec{}, v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	d := msgpackDecoder{data: data}
+
+	if err := unmarshalBinary(&d, v); err != nil {
+		return err
+	}
+
+	if d.pos != len(data) {
+		return errMsgpack
+	}
+
+	return nil
+}
+
+// unexported methods
+
+func (msgpackCodec) appendArrayLen(b []byte, n int) []byte {
+	return appendMsgpackLen(b, n, 0x90, 0xdc, 0xdd)
+}
+
+func (msgpackCodec) appendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xc3)
+	}
+
+	return append(b, 0xc2)
+}
+
+func (msgpackCodec) appendFloat(b []byte, f float64) []byte {
+	return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(f))
+}
+
+func (msgpackCodec) appendInt(b []byte, i int64) []byte {
+	return appendMsgpackInt(b, i)
+}
+
+func (msgpackCodec) appendMapLen(b []byte, n int) []byte {
+	return appendMsgpackLen(b, n, 0x80, 0xde, 0xdf)
+}
+
+func (msgpackCodec) appendNil(b []byte) []byte {
+	return append(b, 0xc0)
+}
+
+func (msgpackCodec) appendString(b []byte, s string) []byte {
+	n := len(s)
+
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+
+	return append(b, s...)
+}
+
+func (msgpackCodec) appendUint(b []byte, u uint64) []byte {
+	if u <= math.MaxInt64 {
+		return appendMsgpackInt(b, int64(u))
+	}
+
+	return binary.BigEndian.AppendUint64(append(b, 0xcf), u)
+}
+
+func appendMsgpackInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= math.MaxInt8:
+		return append(b, byte(i))
+	case i < 0 && i >= -32:
+		return append(b, byte(i))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return append(b, 0xd0, byte(i))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(i))
+	}
+
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+}
+
+// appendMsgpackLen appends the header of an array or map, which has a
+// fixed form for up to 15 elements and 16 and 32 bit forms after that.
+func appendMsgpackLen(b []byte, n int, fix byte, len16 byte, len32 byte) []byte {
+	switch {
+	case n < 16:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, len16), uint16(n))
+	}
+
+	return binary.BigEndian.AppendUint32(append(b, len32), uint32(n))
+}
+
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *msgpackDecoder) array(n int) (token, error) {
+	if n > len(d.data)-d.pos {
+		return token{}, errMsgpack
+	}
+
+	return token{kind: tokArray, n: n}, nil
+}
+
+// atBreak reports false, since MessagePack arrays and maps always give
+// their length.
+func (d *msgpackDecoder) atBreak() (bool, error) {
+	return false, nil
+}
+
+func (d *msgpackDecoder) byte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, errMsgpack
+	}
+
+	d.pos++
+
+	return d.data[d.pos-1], nil
+}
+
+func (d *msgpackDecoder) invalid() error {
+	return errMsgpack
+}
+
+// lenThen reads a big-endian length of size bytes and passes it to fn.
+func (d *msgpackDecoder) lenThen(size int, fn func(int) (token, error)) (token, error) {
+	n, err := d.uint(size)
+	if err != nil {
+		return token{}, err
+	}
+
+	if n > uint64(len(d.data)) {
+		return token{}, errMsgpack
+	}
+
+	return fn(int(n))
+}
+
+func (d *msgpackDecoder) next() (token, error) {
+	c, err := d.byte()
+	if err != nil {
+		return token{}, err
+	}
+
+	switch {
+	case c <= 0x7f:
+		return token{kind: tokInt, i: int64(c)}, nil
+	case c >= 0xe0:
+		return token{kind: tokInt, i: int64(int8(c))}, nil
+	case c >= 0xa0 && c <= 0xbf:
+		return d.str(int(c & 0x1f))
+	case c >= 0x90 && c <= 0x9f:
+		return d.array(int(c & 0x0f))
+	case c >= 0x80 && c <= 0x8f:
+		return d.object(int(c & 0x0f))
+	}
+
+	switch c {
+	case 0xc0:
+		return token{kind: tokNil}, nil
+	case 0xc2:
+		return token{kind: tokBool, b: false}, nil
+	case 0xc3:
+		return token{kind: tokBool, b: true}, nil
+	case 0xc4, 0xd9:
+		return d.lenThen(1, d.str)
+	case 0xc5, 0xda:
+		return d.lenThen(2, d.str)
+	case 0xc6, 0xdb:
+		return d.lenThen(4, d.str)
+	case 0xca:
+		u, err := d.uint(4)
+		return token{kind: tokFloat, f: float64(math.Float32frombits(uint32(u)))}, err
+	case 0xcb:
+		u, err := d.uint(8)
+		return token{kind: tokFloat, f: math.Float64frombits(u)}, err
+	case 0xcc:
+		return d.uintToken(1)
+	case 0xcd:
+		return d.uintToken(2)
+	case 0xce:
+		return d.uintToken(4)
+	case 0xcf:
+		return d.uintToken(8)
+	case 0xd0:
+		u, err := d.uint(1)
+		return token{kind: tokInt, i: int64(int8(u))}, err
+	case 0xd1:
+		u, err := d.uint(2)
+		return token{kind: tokInt, i: int64(int16(u))}, err
+	case 0xd2:
+		u, err := d.uint(4)
+		return token{kind: tokInt, i: int64(int32(u))}, err
+	case 0xd3:
+		u, err := d.uint(8)
+		return token{kind: tokInt, i: int64(u)}, err
+	case 0xdc:
+		return d.lenThen(2, d.array)
+	case 0xdd:
+		return d.lenThen(4, d.array)
+	case 0xde:
+		return d.lenThen(2, d.object)
+	case 0xdf:
+		return d.lenThen(4, d.object)
+	}
+
+	return token{}, errMsgpack
+}
+
+func (d *msgpackDecoder) object(n int) (token, error) {
+	if n > len(d.data)-d.pos {
+		return token{}, errMsgpack
+	}
+
+	return token{kind: tokMap, n: n}, nil
+}
+
+func (d *msgpackDecoder) str(n int) (token, error) {
+	if n > len(d.data)-d.pos {
+		return token{}, errMsgpack
+	}
+
+	s := d.data[d.pos : d.pos+n]
+	d.pos += n
+
+	return token{kind: tokString, s: s}, nil
+}
+
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	if size > len(d.data)-d.pos {
+		return 0, errMsgpack
+	}
+
+	var u uint64
+	for _, c := range d.data[d.pos : d.pos+size] {
+		u = u<<8 | uint64(c)
+	}
+	d.pos += size
+
+	return u, nil
+}
+
+func (d *msgpackDecoder) uintToken(size int) (token, error) {
+	u, err := d.uint(size)
+
+	return token{kind: tokUint, u: u}, err
+}
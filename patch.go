@@ -0,0 +1,533 @@
+package hare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// patchOp is one operation of a json patch (RFC 6902).  Value is left
+// raw so that a missing value can be told apart from a null one.
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Patch takes a table name, a record id, and a patch, and, while holding
+// the table lock, applies the patch to the stored record and writes the
+// result back.  The patch is either a json merge patch (RFC 7386), which
+// is a json object, or a json patch (RFC 6902), which is a json array of
+// operations.  Only the fields the patch names are changed, so two
+// patches to different fields of the same record never undo each other.
+//
+// The patch cannot change the record's id, and if the record has a
+// version, it goes up by one as with Update.  Since there is no struct
+// to run them on, record hooks and Validate do not run.
+func (db *Database) Patch(tableName string, id int, patch []byte) error {
+	return db.PatchCtx(context.Background(), tableName, id, patch)
+}
+
+// PatchCtx is Patch with a context for waiting on the table lock.
+func (db *Database) PatchCtx(ctx context.Context, tableName string, id int, patch []byte) error {
+	patch = bytes.TrimSpace(patch)
+
+	if len(patch) == 0 {
+		return dberr.ErrInvalidPatch
+	}
+
+	switch patch[0] {
+	case '{':
+		mergeDoc, err := decodeJSON(patch)
+		if err != nil {
+			return dberr.ErrInvalidPatch
+		}
+
+		return db.patch(ctx, tableName, id, func(doc interface{}) (interface{}, error) {
+			return mergePatch(doc, mergeDoc), nil
+		})
+	case '[':
+		var ops []patchOp
+
+		if err := json.Unmarshal(patch, &ops); err != nil {
+			return dberr.ErrInvalidPatch
+		}
+
+		return db.patch(ctx, tableName, id, func(doc interface{}) (interface{}, error) {
+			return applyPatchOps(doc, ops)
+		})
+	}
+
+	return dberr.ErrInvalidPatch
+}
+
+// Set takes a table name, a record id, a json field path, like "age" or
+// "address.city", and a value, and, while holding the table lock, sets
+// that field of the stored record to the value.  Objects along the path
+// that the record does not have yet are added.  Like Patch, it cannot
+// change the record's id and does not run record hooks.
+func (db *Database) Set(tableName string, id int, fieldPath string, value interface{}) error {
+	return db.SetCtx(context.Background(), tableName, id, fieldPath, value)
+}
+
+// SetCtx is Set with a context for waiting on the table lock.
+func (db *Database) SetCtx(ctx context.Context, tableName string, id int, fieldPath string, value interface{}) error {
+	generic, err := toGeneric(value)
+	if err != nil {
+		return err
+	}
+
+	path := strings.Split(fieldPath, ".")
+
+	return db.patch(ctx, tableName, id, func(doc interface{}) (interface{}, error) {
+		obj := doc.(map[string]interface{})
+
+		for _, name := range path[:len(path)-1] {
+			if _, ok := obj[name]; !ok {
+				obj[name] = make(map[string]interface{})
+			}
+
+			child, ok := obj[name].(map[string]interface{})
+			if !ok {
+				return nil, dberr.ErrInvalidPatch
+			}
+
+			obj = child
+		}
+
+		obj[path[len(path)-1]] = generic
+
+		return doc, nil
+	})
+}
+
+// unexported methods
+
+// patch takes a context, a table name, a record id, and a function that
+// changes a record decoded into generic json values, and, while holding
+// the table lock, runs the function on the stored record and writes the
+// result back.
+func (db *Database) patch(ctx context.Context, tableName string, id int, apply func(interface{}) (interface{}, error)) error {
+	if err := db.checkWritable(); err != nil {
+		return err
+	}
+
+	if !db.TableExists(tableName) {
+		return dberr.ErrNoTable
+	}
+
+	unlock, err := db.lockTable(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	rawRec, err := db.store.ReadRec(tableName, id)
+	if err != nil {
+		return err
+	}
+
+	jsonRec, err := db.toJSON(tableName, rawRec)
+	if err != nil {
+		return err
+	}
+
+	doc, err := decodeJSON(jsonRec)
+	if err != nil {
+		return err
+	}
+
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return dberr.ErrInvalidPatch
+	}
+
+	oldID := obj["id"]
+	oldVersion := obj[versionKey]
+
+	doc, err = apply(doc)
+	if err != nil {
+		return err
+	}
+
+	if obj, ok = doc.(map[string]interface{}); !ok {
+		return dberr.ErrInvalidPatch
+	}
+
+	if !reflect.DeepEqual(oldID, obj["id"]) {
+		return dberr.ErrIDChanged
+	}
+
+	// A patched record is a new version of it, whatever the patch says.
+	nextDocVersion(oldVersion, obj)
+
+	newRaw, err := db.codecFor(tableName).Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	if err := db.store.UpdateRec(tableName, id, newRaw); err != nil {
+		return err
+	}
+
+	if err := db.indexRec(tableName, id, newRaw); err != nil {
+		return err
+	}
+
+	db.publish(EventUpdate, tableName, id, rawRec, newRaw)
+
+	return nil
+}
+
+// applyPatchOps takes a document and the operations of a json patch and
+// returns the document with every operation applied.
+func applyPatchOps(doc interface{}, ops []patchOp) (interface{}, error) {
+	for _, op := range ops {
+		if op.Path == nil {
+			return nil, dberr.ErrInvalidPatch
+		}
+
+		path, err := parsePointer(*op.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		var value interface{}
+
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, dberr.ErrInvalidPatch
+			}
+
+			if value, err = decodeJSON(op.Value); err != nil {
+				return nil, dberr.ErrInvalidPatch
+			}
+		case "move", "copy":
+			if op.From == nil {
+				return nil, dberr.ErrInvalidPatch
+			}
+
+			from, err := parsePointer(*op.From)
+			if err != nil {
+				return nil, err
+			}
+
+			if value, err = pointerGet(doc, from); err != nil {
+				return nil, err
+			}
+
+			if op.Op == "copy" {
+				value = copyValue(value)
+				break
+			}
+
+			// A value cannot be moved into one of its own children.
+			if len(from) < len(path) && reflect.DeepEqual(from, path[:len(from)]) {
+				return nil, dberr.ErrInvalidPatch
+			}
+
+			if doc, _, err = pointerRemove(doc, from); err != nil {
+				return nil, err
+			}
+		case "remove":
+		default:
+			return nil, dberr.ErrInvalidPatch
+		}
+
+		switch op.Op {
+		case "add", "move", "copy":
+			doc, err = pointerAdd(doc, path, value, false)
+		case "replace":
+			doc, err = pointerAdd(doc, path, value, true)
+		case "remove":
+			doc, _, err = pointerRemove(doc, path)
+		case "test":
+			var found interface{}
+
+			if found, err = pointerGet(doc, path); err == nil && !jsonEqual(found, value) {
+				err = dberr.ErrPatchTestFailed
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+// arrayIndex takes a json pointer token and the length of the array it
+// indexes, and returns the index.  If end is true, the token can also
+// be "-" or the length of the array, both of which mean the end.
+func arrayIndex(token string, length int, end bool) (int, error) {
+	if end && token == "-" {
+		return length, nil
+	}
+
+	// Leading zeros are not allowed.
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, dberr.ErrInvalidPatch
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > length || (i == length && !end) {
+		return 0, dberr.ErrInvalidPatch
+	}
+
+	return i, nil
+}
+
+// copyValue takes a generic json value and returns a copy of it that
+// shares no objects or arrays with it.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for name, child := range v {
+			obj[name] = copyValue(child)
+		}
+
+		return obj
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, child := range v {
+			arr[i] = copyValue(child)
+		}
+
+		return arr
+	}
+
+	return value
+}
+
+// decodeJSON takes json and returns it decoded into generic json values,
+// with numbers left as json.Number so integers keep their precision.
+func decodeJSON(data []byte) (interface{}, error) {
+	var doc interface{}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	if err := d.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// jsonEqual takes two generic json values and returns true if they are
+// equal, comparing numbers by value.
+func jsonEqual(a interface{}, b interface{}) bool {
+	aNorm, err := normalizeValue(a)
+	if err != nil {
+		return false
+	}
+
+	bNorm, err := normalizeValue(b)
+	if err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(aNorm, bNorm)
+}
+
+// mergePatch takes a document and a json merge patch and returns the
+// document with the patch applied.
+func mergePatch(doc interface{}, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		obj = make(map[string]interface{})
+	}
+
+	for name, value := range patchObj {
+		if value == nil {
+			delete(obj, name)
+			continue
+		}
+
+		obj[name] = mergePatch(obj[name], value)
+	}
+
+	return obj
+}
+
+// parsePointer takes a json pointer (RFC 6901) and returns its tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if pointer[0] != '/' {
+		return nil, dberr.ErrInvalidPatch
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+	for i, token := range tokens {
+		tokens[i] = unescape.Replace(token)
+	}
+
+	return tokens, nil
+}
+
+// pointerAdd takes a document, the tokens of a json pointer, a value,
+// and whether the value has to replace one that is already there, and
+// returns the document with the value added at the pointer.
+func pointerAdd(doc interface{}, path []string, value interface{}, replace bool) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		child, ok := v[path[0]]
+
+		if len(path) == 1 {
+			if replace && !ok {
+				return nil, dberr.ErrInvalidPatch
+			}
+
+			v[path[0]] = value
+
+			return v, nil
+		}
+
+		if !ok {
+			return nil, dberr.ErrInvalidPatch
+		}
+
+		child, err := pointerAdd(child, path[1:], value, replace)
+		if err != nil {
+			return nil, err
+		}
+
+		v[path[0]] = child
+
+		return v, nil
+	case []interface{}:
+		end := len(path) == 1 && !replace
+
+		i, err := arrayIndex(path[0], len(v), end)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(path) == 1 {
+			if replace {
+				v[i] = value
+				return v, nil
+			}
+
+			v = append(v, nil)
+			copy(v[i+1:], v[i:])
+			v[i] = value
+
+			return v, nil
+		}
+
+		child, err := pointerAdd(v[i], path[1:], value, replace)
+		if err != nil {
+			return nil, err
+		}
+
+		v[i] = child
+
+		return v, nil
+	}
+
+	return nil, dberr.ErrInvalidPatch
+}
+
+// pointerGet takes a document and the tokens of a json pointer and
+// returns the value at the pointer.
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	value := doc
+
+	for _, token := range path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			child, ok := v[token]
+			if !ok {
+				return nil, dberr.ErrInvalidPatch
+			}
+
+			value = child
+		case []interface{}:
+			i, err := arrayIndex(token, len(v), false)
+			if err != nil {
+				return nil, err
+			}
+
+			value = v[i]
+		default:
+			return nil, dberr.ErrInvalidPatch
+		}
+	}
+
+	return value, nil
+}
+
+// pointerRemove takes a document and the tokens of a json pointer and
+// returns the document without the value at the pointer, and the value.
+func pointerRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	// The whole document cannot be removed.
+	if len(path) == 0 {
+		return nil, nil, dberr.ErrInvalidPatch
+	}
+
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		child, ok := v[path[0]]
+		if !ok {
+			return nil, nil, dberr.ErrInvalidPatch
+		}
+
+		if len(path) == 1 {
+			delete(v, path[0])
+			return v, child, nil
+		}
+
+		child, removed, err := pointerRemove(child, path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		v[path[0]] = child
+
+		return v, removed, nil
+	case []interface{}:
+		i, err := arrayIndex(path[0], len(v), false)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(path) == 1 {
+			removed := v[i]
+			return append(v[:i], v[i+1:]...), removed, nil
+		}
+
+		child, removed, err := pointerRemove(v[i], path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		v[i] = child
+
+		return v, removed, nil
+	}
+
+	return nil, nil, dberr.ErrInvalidPatch
+}
@@ -0,0 +1,203 @@
+package hare
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/jameycribbs/hare/datastores/ram"
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestPatchTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//Patch (merge patch)...
+
+			return func(t *testing.T) {
+				if err := db.Patch("contacts", 3, []byte(`{"age":19,"last_name":null,"nickname":"Will"}`)); err != nil {
+					t.Fatal(err)
+				}
+
+				want := `{"age":19,"first_name":"Bill","id":3,"nickname":"Will"}`
+
+				got, err := db.FindRaw("contacts", 3)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if want != string(got) {
+					t.Errorf("want %v; got %v", want, string(got))
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Patch (json patch)...
+
+			return func(t *testing.T) {
+				patch := `[
+					{"op":"test","path":"/first_name","value":"Bill"},
+					{"op":"replace","path":"/age","value":19},
+					{"op":"add","path":"/plays","value":["Hamlet"]},
+					{"op":"add","path":"/plays/-","value":"Macbeth"},
+					{"op":"add","path":"/plays/0","value":"Othello"},
+					{"op":"copy","from":"/first_name","path":"/nickname"},
+					{"op":"move","from":"/last_name","path":"/surname"},
+					{"op":"remove","path":"/plays/1"}
+				]`
+
+				if err := db.Patch("contacts", 3, []byte(patch)); err != nil {
+					t.Fatal(err)
+				}
+
+				want := `{"age":19,"first_name":"Bill","id":3,"nickname":"Bill","plays":["Othello","Macbeth"],"surname":"Shakespeare"}`
+
+				got, err := db.FindRaw("contacts", 3)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if want != string(got) {
+					t.Errorf("want %v; got %v", want, string(got))
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Patch (failed test leaves the record alone)...
+
+			return func(t *testing.T) {
+				patch := `[{"op":"replace","path":"/age","value":19},{"op":"test","path":"/age","value":18}]`
+
+				checkErr(t, dberr.ErrPatchTestFailed, db.Patch("contacts", 3, []byte(patch)))
+
+				c := Contact{}
+				if err := db.Find("contacts", 3, &c); err != nil {
+					t.Fatal(err)
+				}
+
+				if c.Age != 18 {
+					t.Errorf("want %v; got %v", 18, c.Age)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Patch (errors)...
+
+			return func(t *testing.T) {
+				checkErr(t, dberr.ErrIDChanged, db.Patch("contacts", 3, []byte(`{"id":7}`)))
+				checkErr(t, dberr.ErrIDChanged, db.Patch("contacts", 3, []byte(`[{"op":"remove","path":"/id"}]`)))
+				checkErr(t, dberr.ErrInvalidPatch, db.Patch("contacts", 3, []byte(`"age"`)))
+				checkErr(t, dberr.ErrInvalidPatch, db.Patch("contacts", 3, []byte(`[{"op":"replace","path":"/height","value":6}]`)))
+				checkErr(t, dberr.ErrInvalidPatch, db.Patch("contacts", 3, []byte(`[{"op":"jump","path":"/age"}]`)))
+				checkErr(t, dberr.ErrInvalidPatch, db.Patch("contacts", 3, []byte(`[{"op":"move","from":"/first_name","path":"/first_name/x"}]`)))
+				checkErr(t, dberr.ErrNoRecord, db.Patch("contacts", 99, []byte(`{"age":1}`)))
+				checkErr(t, dberr.ErrNoTable, db.Patch("nonexistent", 3, []byte(`{"age":1}`)))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Set...
+
+			return func(t *testing.T) {
+				if err := db.Set("contacts", 3, "age", 19); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.Set("contacts", 3, "address.city", "Stratford"); err != nil {
+					t.Fatal(err)
+				}
+
+				want := `{"address":{"city":"Stratford"},"age":19,"first_name":"Bill","id":3,"last_name":"Shakespeare"}`
+
+				got, err := db.FindRaw("contacts", 3)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if want != string(got) {
+					t.Errorf("want %v; got %v", want, string(got))
+				}
+
+				checkErr(t, dberr.ErrInvalidPatch, db.Set("contacts", 3, "age.years", 19))
+				checkErr(t, dberr.ErrIDChanged, db.Set("contacts", 3, "id", 4))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Set (different fields at the same time)...
+
+			return func(t *testing.T) {
+				var wg sync.WaitGroup
+
+				for i := 0; i < 20; i++ {
+					wg.Add(1)
+
+					go func(i int) {
+						defer wg.Done()
+
+						if err := db.Set("contacts", 3, "field"+strconv.Itoa(i), i); err != nil {
+							t.Error(err)
+						}
+					}(i)
+				}
+
+				wg.Wait()
+
+				rawRec, err := db.FindRaw("contacts", 3)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var doc map[string]interface{}
+				if err := json.Unmarshal(rawRec, &doc); err != nil {
+					t.Fatal(err)
+				}
+
+				for i := 0; i < 20; i++ {
+					if doc["field"+strconv.Itoa(i)] != float64(i) {
+						t.Errorf("want field%d to be %v; got %v", i, i, doc["field"+strconv.Itoa(i)])
+					}
+				}
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
+
+func TestPatchCodecTests(t *testing.T) {
+	ds, err := ram.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := New(ds, WithCodec(MessagePack))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.CreateTable("contacts"); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := db.Insert("contacts", &Contact{FirstName: "Bill", LastName: "Shakespeare", Age: 18})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Patch("contacts", id, []byte(`{"age":19}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := Contact{ID: id, FirstName: "Bill", LastName: "Shakespeare", Age: 19}
+	got := Contact{}
+
+	if err := db.Find("contacts", id, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v; got %v", want, got)
+	}
+}
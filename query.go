@@ -0,0 +1,556 @@
+package hare
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+var errNegativeOffset = errors.New("hare: query offset cannot be negative")
+
+// Direction is the direction a query's results are sorted in.
+type Direction int
+
+const (
+	// Asc sorts from the lowest value to the highest.
+	Asc Direction = iota
+
+	// Desc sorts from the highest value to the lowest.
+	Desc
+)
+
+// Query builds a query against one table.  Conditions are checked
+// against the raw json of each record, so only the records that match
+// are unmarshaled into structs and have their AfterFind run.
+//
+//	err := db.Query("episodes").Where("season", ">=", 3).OrderBy("date_episode_aired", hare.Desc).Limit(20).All(&episodes)
+type Query struct {
+	ctx       context.Context
+	db        *Database
+	tableName string
+	conds     []condition
+	orders    []ordering
+	fields    [][]string
+	limit     int
+	offset    int
+	err       error
+}
+
+type condition struct {
+	fieldPath string
+	path      []string
+	op        string
+	value     interface{}
+}
+
+type ordering struct {
+	path      []string
+	direction Direction
+}
+
+type queryRow struct {
+	id     int
+	rawRec []byte
+	doc    interface{}
+}
+
+// Query takes a table name and returns a new query against that table.
+func (db *Database) Query(tableName string) *Query {
+	return db.QueryCtx(context.Background(), tableName)
+}
+
+// QueryCtx is Query with a context for waiting on the table lock and for
+// stopping the scan of the table when the query is run.
+func (db *Database) QueryCtx(ctx context.Context, tableName string) *Query {
+	return &Query{ctx: ctx, db: db, tableName: tableName}
+}
+
+// All takes a pointer to a slice of structs (or of pointers to structs)
+// and populates it with the records that match the query.
+func (q *Query) All(recs interface{}) error {
+	sliceVal := reflect.ValueOf(recs)
+	if sliceVal.Kind() != reflect.Ptr || sliceVal.Elem().Kind() != reflect.Slice {
+		return errors.New("hare: All needs a pointer to a slice")
+	}
+
+	rows, err := q.run()
+	if err != nil {
+		return err
+	}
+
+	sliceVal = sliceVal.Elem()
+	sliceVal.Set(sliceVal.Slice(0, 0))
+
+	for _, row := range rows {
+		if err := q.db.appendRec(sliceVal, JSON, row.rawRec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Count returns the number of records that match the query.
+func (q *Query) Count() (int, error) {
+	rows, err := q.run()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(rows), nil
+}
+
+// First takes a pointer to a struct and populates it with the first
+// record that matches the query, or returns dberr.ErrNoRecord.
+func (q *Query) First(rec interface{}) error {
+	limited := *q
+	limited.limit = 1
+
+	rows, err := limited.run()
+	if err != nil {
+		return err
+	}
+
+	if len(rows) == 0 {
+		return dberr.ErrNoRecord
+	}
+
+	if err := json.Unmarshal(rows[0].rawRec, rec); err != nil {
+		return err
+	}
+
+	return q.db.afterFind(rec)
+}
+
+// IDs returns the ids of the records that match the query.
+func (q *Query) IDs() ([]int, error) {
+	rows, err := q.run()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, len(rows))
+	for i, row := range rows {
+		ids[i] = row.id
+	}
+
+	return ids, nil
+}
+
+// Limit takes the maximum number of records the query returns.  Zero
+// means no limit.
+func (q *Query) Limit(limit int) *Query {
+	q.limit = limit
+
+	return q
+}
+
+// Offset takes the number of matching records to skip before the
+// query starts returning them.  It cannot be negative.
+func (q *Query) Offset(offset int) *Query {
+	if offset < 0 {
+		q.err = errNegativeOffset
+		return q
+	}
+
+	q.offset = offset
+
+	return q
+}
+
+// OrderBy takes a json field path and a direction and sorts the
+// results by that field.  It can be called more than once to break
+// ties.  Records that are otherwise equal are returned in id order.
+// Records missing the field sort first, and values of different types
+// sort as null, bools, numbers, strings, then arrays and objects.
+func (q *Query) OrderBy(fieldPath string, direction Direction) *Query {
+	q.orders = append(q.orders, ordering{path: strings.Split(fieldPath, "."), direction: direction})
+
+	return q
+}
+
+// Select takes json field paths and limits the fields that are copied
+// into the results to those fields.
+func (q *Query) Select(fieldPaths ...string) *Query {
+	for _, fieldPath := range fieldPaths {
+		q.fields = append(q.fields, strings.Split(fieldPath, "."))
+	}
+
+	return q
+}
+
+// Where takes a json field path, an operator, and a value and adds a
+// condition to the query.  The operators are "=", "==", "!=", "<",
+// "<=", ">", ">=", and "in", which takes a slice of values.  A record
+// that does not have the field never matches.
+func (q *Query) Where(fieldPath string, op string, value interface{}) *Query {
+	switch op {
+	case "=", "==", "!=", "<", "<=", ">", ">=", "in":
+	default:
+		q.err = dberr.ErrUnknownOperator
+		return q
+	}
+
+	generic, err := normalizeValue(value)
+	if err != nil {
+		q.err = err
+		return q
+	}
+
+	if op == "in" {
+		if _, ok := generic.([]interface{}); !ok {
+			q.err = errors.New("hare: the in operator needs a slice of values")
+			return q
+		}
+	}
+
+	if op == "==" {
+		op = "="
+	}
+
+	q.conds = append(q.conds, condition{fieldPath: fieldPath, path: strings.Split(fieldPath, "."), op: op, value: generic})
+
+	return q
+}
+
+// unexported methods
+
+// candidateIDs expects the caller to hold the table lock.  If one of the
+// conditions is an equality on an indexed field, only the ids in that
+// index entry need to be checked.
+func (q *Query) candidateIDs() ([]int, error) {
+	var ids []int
+	var found bool
+
+	for _, cond := range q.conds {
+		if cond.op != "=" {
+			continue
+		}
+
+		idx, ok := q.db.tableIndexes(q.tableName)[cond.fieldPath]
+		if !ok {
+			continue
+		}
+
+		key, err := indexKey(cond.value)
+		if err != nil {
+			return nil, err
+		}
+
+		if idxIDs := idx.ids(key); !found || len(idxIDs) < len(ids) {
+			ids = idxIDs
+			found = true
+		}
+	}
+
+	if found {
+		return ids, nil
+	}
+
+	ids, err := q.db.store.IDs(q.tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Ints(ids)
+
+	return ids, nil
+}
+
+func (q *Query) matches(doc interface{}) bool {
+	for _, cond := range q.conds {
+		value, ok := docValue(doc, cond.path)
+		if !ok {
+			return false
+		}
+
+		if !cond.matches(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (q *Query) project(row queryRow) (queryRow, error) {
+	projected := make(map[string]interface{})
+
+	for _, path := range q.fields {
+		value, ok := docValue(row.doc, path)
+		if !ok {
+			continue
+		}
+
+		obj := projected
+		for _, name := range path[:len(path)-1] {
+			child, ok := obj[name].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				obj[name] = child
+			}
+			obj = child
+		}
+		obj[path[len(path)-1]] = value
+	}
+
+	// The id always comes along, so records can still be updated.
+	if id, ok := docValue(row.doc, []string{"id"}); ok {
+		projected["id"] = id
+	}
+
+	rawRec, err := json.Marshal(projected)
+	if err != nil {
+		return row, err
+	}
+
+	row.rawRec = rawRec
+
+	return row, nil
+}
+
+func (q *Query) run() ([]queryRow, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+
+	rows, err := q.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(q.orders) > 0 {
+		sort.SliceStable(rows, func(i, j int) bool {
+			for _, o := range q.orders {
+				a, aOk := docValue(rows[i].doc, o.path)
+				b, bOk := docValue(rows[j].doc, o.path)
+
+				c := compareMissing(a, aOk, b, bOk)
+				if c == 0 {
+					continue
+				}
+
+				if o.direction == Desc {
+					return c > 0
+				}
+
+				return c < 0
+			}
+
+			return false
+		})
+	}
+
+	if q.offset >= len(rows) {
+		return nil, nil
+	}
+	rows = rows[q.offset:]
+
+	if q.limit > 0 && q.limit < len(rows) {
+		rows = rows[:q.limit]
+	}
+
+	if len(q.fields) > 0 {
+		for i := range rows {
+			if rows[i], err = q.project(rows[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return rows, nil
+}
+
+// scan reads the candidate records under the table's read lock and
+// returns the ones that match, in id order.
+func (q *Query) scan() ([]queryRow, error) {
+	var rows []queryRow
+
+	db := q.db
+
+	if !db.TableExists(q.tableName) {
+		return nil, dberr.ErrNoTable
+	}
+
+	unlock, err := db.rlockTable(q.ctx, q.tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	ids, err := q.candidateIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	// Without sorting, there is no need to read past the last record
+	// that will be returned.
+	needed := 0
+	if q.limit > 0 && len(q.orders) == 0 {
+		needed = q.offset + q.limit
+	}
+
+	for _, id := range ids {
+		if err := ctxErr(q.ctx); err != nil {
+			return nil, err
+		}
+
+		rawRec, err := db.store.ReadRec(q.tableName, id)
+		if err != nil {
+			return nil, err
+		}
+
+		doc, err := db.decodeDoc(q.tableName, rawRec)
+		if err != nil {
+			return nil, err
+		}
+
+		if !q.matches(doc) {
+			continue
+		}
+
+		// Rows are handed back as json, whatever the table's codec.
+		if db.codecFor(q.tableName) != JSON {
+			if rawRec, err = json.Marshal(doc); err != nil {
+				return nil, err
+			}
+		}
+
+		rows = append(rows, queryRow{id: id, rawRec: rawRec, doc: doc})
+
+		if needed > 0 && len(rows) == needed {
+			break
+		}
+	}
+
+	return rows, nil
+}
+
+func (cond condition) matches(value interface{}) bool {
+	if cond.op == "in" {
+		for _, v := range cond.value.([]interface{}) {
+			if c, ok := compareValues(value, v); ok && c == 0 {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	c, ok := compareValues(value, cond.value)
+	if !ok {
+		return cond.op == "!="
+	}
+
+	switch cond.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+// compareMissing compares two values for sorting.  Missing values sort
+// before everything else, and values of different types sort by
+// typeRank.
+func compareMissing(a interface{}, aOk bool, b interface{}, bOk bool) int {
+	switch {
+	case !aOk && !bOk:
+		return 0
+	case !aOk:
+		return -1
+	case !bOk:
+		return 1
+	}
+
+	if c, ok := compareValues(a, b); ok {
+		return c
+	}
+
+	return typeRank(a) - typeRank(b)
+}
+
+// typeRank takes a value that came out of json and returns its place in
+// the sort order of types: null, bool, number, string, then arrays and
+// objects, which rank the same.
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case float64:
+		return 2
+	case string:
+		return 3
+	}
+
+	return 4
+}
+
+// compareValues compares two values that came out of json.  It returns
+// false if they are not of the same comparable type.
+func compareValues(a interface{}, b interface{}) (int, bool) {
+	switch av := a.(type) {
+	case float64:
+		bv, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+
+		switch {
+		case av < bv:
+			return -1, true
+		case av > bv:
+			return 1, true
+		}
+
+		return 0, true
+	case string:
+		bv, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+
+		return strings.Compare(av, bv), true
+	case bool:
+		bv, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+
+		switch {
+		case av == bv:
+			return 0, true
+		case !av:
+			return -1, true
+		}
+
+		return 1, true
+	case nil:
+		if b == nil {
+			return 0, true
+		}
+
+		return 0, false
+	}
+
+	// Objects and arrays can only be tested for equality.
+	if reflect.DeepEqual(a, b) {
+		return 0, true
+	}
+
+	return 0, false
+}
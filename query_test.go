@@ -0,0 +1,210 @@
+package hare
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+type mixedRec struct {
+	ID  int             `json:"id"`
+	Val json.RawMessage `json:"val,omitempty"`
+}
+
+func (r *mixedRec) GetID() int {
+	return r.ID
+}
+
+func (r *mixedRec) SetID(id int) {
+	r.ID = id
+}
+
+func TestQueryTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//All...
+
+			return func(t *testing.T) {
+				var results []Contact
+
+				if err := db.Query("contacts").Where("age", ">", 20).Where("age", "<", 50).All(&results); err != nil {
+					t.Fatal(err)
+				}
+
+				want := []Contact{
+					{ID: 1, FirstName: "John", LastName: "Doe", Age: 37},
+					{ID: 4, FirstName: "Helen", LastName: "Keller", Age: 25},
+				}
+				got := results
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//All (OrderBy, Offset, and Limit)...
+
+			return func(t *testing.T) {
+				var results []*Contact
+
+				if err := db.Query("contacts").OrderBy("age", Desc).Offset(1).Limit(2).All(&results); err != nil {
+					t.Fatal(err)
+				}
+
+				want := []int{1, 4}
+				got := []int{results[0].ID, results[1].ID}
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//All (Select)...
+
+			return func(t *testing.T) {
+				var results []Contact
+
+				if err := db.Query("contacts").Where("last_name", "=", "Doe").Select("first_name").All(&results); err != nil {
+					t.Fatal(err)
+				}
+
+				want := []Contact{{ID: 1, FirstName: "John"}}
+				got := results
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Count...
+
+			return func(t *testing.T) {
+				got, err := db.Query("contacts").Where("first_name", "!=", "John").Count()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := 3
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//First...
+
+			return func(t *testing.T) {
+				c := Contact{}
+
+				if err := db.Query("contacts").OrderBy("age", Asc).First(&c); err != nil {
+					t.Fatal(err)
+				}
+
+				want := 3
+				got := c.ID
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				checkErr(t, dberr.ErrNoRecord, db.Query("contacts").Where("age", ">", 100).First(&c))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//IDs (in, with an index)...
+
+			return func(t *testing.T) {
+				if err := db.CreateIndex("contacts", "last_name"); err != nil {
+					t.Fatal(err)
+				}
+
+				got, err := db.Query("contacts").Where("last_name", "in", []string{"Keller", "Lincoln"}).IDs()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := []int{2, 4}
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				got, err = db.Query("contacts").Where("last_name", "=", "Keller").Where("age", "=", 25).IDs()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want = []int{4}
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Where (ErrUnknownOperator and ErrNoTable errors)...
+
+			return func(t *testing.T) {
+				var results []Contact
+
+				checkErr(t, dberr.ErrUnknownOperator, db.Query("contacts").Where("age", "~", 1).All(&results))
+				checkErr(t, dberr.ErrNoTable, db.Query("nonexistent").All(&results))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//IDs (OrderBy with values of mixed types)...
+
+			return func(t *testing.T) {
+				if err := db.CreateTable("newtable"); err != nil {
+					t.Fatal(err)
+				}
+
+				for _, val := range []string{`[1]`, `"b"`, `2`, `true`, ``, `null`, `"a"`, `1`, `false`, `{"a":1}`} {
+					if _, err := db.Insert("newtable", &mixedRec{Val: json.RawMessage(val)}); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				got, err := db.Query("newtable").OrderBy("val", Asc).IDs()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := []int{5, 6, 9, 4, 8, 3, 7, 2, 1, 10}
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				got, err = db.Query("newtable").OrderBy("val", Desc).IDs()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want = []int{1, 10, 2, 7, 3, 8, 4, 9, 6, 5}
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Offset (negative offset error)...
+
+			return func(t *testing.T) {
+				var results []Contact
+
+				checkErr(t, errNegativeOffset, db.Query("contacts").Offset(-1).All(&results))
+				checkErr(t, errNegativeOffset, db.Query("contacts").Offset(-1).Limit(2).All(&results))
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
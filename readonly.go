@@ -0,0 +1,161 @@
+package hare
+
+import (
+	"context"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// readOnlyStore is implemented by datastores that can be opened
+// read-only, like Disk.
+type readOnlyStore interface {
+	ReadOnly() bool
+}
+
+// reloader is implemented by datastores that can pick up the changes
+// other processes make to their files.  Reload returns the names of the
+// tables that changed.
+type reloader interface {
+	Reload() ([]string, error)
+}
+
+// ReadOnly returns an option that makes the database read-only: every
+// method that would change it returns dberr.ErrReadOnly.  A database
+// on a read-only datastore, like a Disk opened with
+// disk.Options{ReadOnly: true}, is read-only without it.
+func ReadOnly() Option {
+	return func(db *Database) {
+		db.readOnly = true
+	}
+}
+
+// ReadOnly returns true if the database is read-only.
+func (db *Database) ReadOnly() bool {
+	return db.readOnly
+}
+
+// Reload brings the database up to date with the changes other
+// processes have made to its files since they were opened.  Changed
+// tables are read again and their indexes rebuilt, new tables are added,
+// and tables whose files are gone are dropped.  It waits for the methods
+// using the tables to finish first.  It does nothing for datastores,
+// like Ram, that have no files, and only a read-only Disk can be
+// reloaded.
+func (db *Database) Reload() error {
+	return db.ReloadCtx(context.Background())
+}
+
+// ReloadCtx is Reload with a context for waiting on the table locks.
+func (db *Database) ReloadCtx(ctx context.Context) error {
+	store, ok := db.store.(reloader)
+	if !ok {
+		return nil
+	}
+
+	if err := db.checkOpen(); err != nil {
+		return err
+	}
+
+	tableNames := db.tableNames()
+	unlocks := make([]func(), 0, len(tableNames))
+
+	defer func() {
+		for _, unlock := range unlocks {
+			unlock()
+		}
+	}()
+
+	for _, tableName := range tableNames {
+		unlock, err := db.lockTable(ctx, tableName)
+		if err != nil {
+			return err
+		}
+
+		unlocks = append(unlocks, unlock)
+	}
+
+	// Whatever was reloaded before an error still has to be brought up
+	// to date.
+	changed, reloadErr := store.Reload()
+
+	for _, tableName := range changed {
+		if err := db.reloadTable(ctx, tableName); err != nil {
+			return err
+		}
+	}
+
+	return reloadErr
+}
+
+// unexported methods
+
+// checkWritable returns dberr.ErrReadOnly if the database is read-only.
+func (db *Database) checkWritable() error {
+	if db.readOnly {
+		return dberr.ErrReadOnly
+	}
+
+	return nil
+}
+
+// reloadTable takes a context and the name of a table the datastore
+// reloaded and brings the table's state up to date.  A new table is
+// added and a table that is gone is removed.  A table that changed has
+// its settings and last id read again and its indexes rebuilt.  It
+// expects the caller to hold the table lock if the table was already
+// registered.
+func (db *Database) reloadTable(ctx context.Context, tableName string) error {
+	tbl, registered := db.table(tableName)
+
+	if !db.store.TableExists(tableName) {
+		if registered {
+			db.removeTable(tableName, tbl, dberr.ErrNoTable)
+			db.publish(EventDropTable, tableName, 0, nil, nil)
+		}
+
+		return nil
+	}
+
+	codec, err := db.loadCodec(tableName)
+	if err != nil {
+		return err
+	}
+
+	keyType, err := db.loadKeyType(tableName)
+	if err != nil {
+		return err
+	}
+
+	if !registered {
+		if err := db.addTable(tableName, codec, keyType); err != nil {
+			return err
+		}
+
+		db.publish(EventCreateTable, tableName, 0, nil, nil)
+
+		return nil
+	}
+
+	lastID, err := db.loadLastID(tableName)
+	if err != nil {
+		return err
+	}
+
+	db.tablesLock.Lock()
+	tbl.codec = codec
+	tbl.keyType = keyType
+	db.tablesLock.Unlock()
+
+	tbl.lastID = lastID
+
+	for fieldPath := range tbl.indexes {
+		idx, err := db.buildIndex(ctx, tableName, fieldPath)
+		if err != nil {
+			return err
+		}
+
+		tbl.indexes[fieldPath] = idx
+	}
+
+	return nil
+}
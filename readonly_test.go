@@ -0,0 +1,72 @@
+package hare
+
+import (
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+	"github.com/jameycribbs/hare/keys"
+)
+
+func TestReadOnlyTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//ReadOnly...
+
+			return func(t *testing.T) {
+				// A second database on the same datastore, which is left
+				// open since closing it would close the datastore too.
+				rodb, err := New(db.store, ReadOnly())
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !rodb.ReadOnly() || db.ReadOnly() {
+					t.Errorf("want %v and %v; got %v and %v", true, false, rodb.ReadOnly(), db.ReadOnly())
+				}
+
+				c := Contact{}
+				if err := rodb.Find("contacts", 2, &c); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := rodb.CreateIndex("contacts", "last_name"); err != nil {
+					t.Fatal(err)
+				}
+
+				_, err = rodb.Insert("contacts", &Contact{FirstName: "Robin"})
+				checkErr(t, dberr.ErrReadOnly, err)
+
+				_, err = rodb.Upsert("contacts", &c)
+				checkErr(t, dberr.ErrReadOnly, err)
+
+				_, err = rodb.Begin()
+				checkErr(t, dberr.ErrReadOnly, err)
+
+				checkErr(t, dberr.ErrReadOnly, rodb.InsertWithID("contacts", &Contact{ID: 10}))
+				checkErr(t, dberr.ErrReadOnly, rodb.Update("contacts", &c))
+				checkErr(t, dberr.ErrReadOnly, rodb.UpdateIfVersion("contacts", &versionedContact{ID: 2}, 0))
+				checkErr(t, dberr.ErrReadOnly, rodb.Patch("contacts", 2, []byte(`{"age":50}`)))
+				checkErr(t, dberr.ErrReadOnly, rodb.Set("contacts", 2, "age", 50))
+				checkErr(t, dberr.ErrReadOnly, rodb.Delete("contacts", 2))
+				checkErr(t, dberr.ErrReadOnly, rodb.DeleteRecord("contacts", &c))
+				checkErr(t, dberr.ErrReadOnly, TableOf[Contact](rodb, "contacts").Delete(2))
+				checkErr(t, dberr.ErrReadOnly, rodb.SetSequence("contacts", 100))
+				checkErr(t, dberr.ErrReadOnly, rodb.Compact("contacts"))
+				checkErr(t, dberr.ErrReadOnly, rodb.CreateTable("newtable"))
+				checkErr(t, dberr.ErrReadOnly, rodb.CreateTableWithKey("newtable", keys.String))
+				checkErr(t, dberr.ErrReadOnly, rodb.DropTable("contacts"))
+
+				found := Contact{}
+				if err := db.Find("contacts", 2, &found); err != nil {
+					t.Fatal(err)
+				}
+
+				if found != c {
+					t.Errorf("want %v; got %v", c, found)
+				}
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
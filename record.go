@@ -0,0 +1,166 @@
+package hare
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// Records do not have to implement the Record interface.  A pointer to
+// any struct with an integer id field, tagged `json:"id"` or named ID,
+// can be passed to the Database instead, and the id is read and set by
+// reflection.  The same goes for the KeyRecord interface and a string id
+// field in tables with string keys.
+
+// idFields caches the index of the id field of each struct type, or nil
+// if the type has none.
+var idFields sync.Map
+
+// idFieldType is the key of idFields.
+type idFieldType struct {
+	structType reflect.Type
+	keyed      bool
+}
+
+// unexported methods
+
+// afterFind runs the record's AfterFind hook, if it has one.
+func (db *Database) afterFind(rec interface{}) error {
+	if hook, ok := rec.(AfterFinder); ok {
+		return hook.AfterFind(db)
+	}
+
+	return nil
+}
+
+// idField takes a record and whether to look for a string key rather
+// than an integer id and returns its id field, or dberr.ErrNoIDField if
+// it has none.
+func idField(rec interface{}, keyed bool) (reflect.Value, error) {
+	recVal := reflect.ValueOf(rec)
+
+	if recVal.Kind() != reflect.Ptr || recVal.IsNil() || recVal.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, dberr.ErrNoIDField
+	}
+
+	structVal := recVal.Elem()
+	structType := structVal.Type()
+
+	cacheKey := idFieldType{structType: structType, keyed: keyed}
+
+	index, ok := idFields.Load(cacheKey)
+	if !ok {
+		index = idFieldIndex(structType, keyed)
+		idFields.Store(cacheKey, index)
+	}
+
+	if index.([]int) == nil {
+		return reflect.Value{}, dberr.ErrNoIDField
+	}
+
+	return structVal.FieldByIndex(index.([]int)), nil
+}
+
+// idFieldIndex takes a struct type and whether to look for a string key
+// and returns the index of its id field, preferring a field tagged
+// `json:"id"` to one named ID.
+func idFieldIndex(structType reflect.Type, keyed bool) []int {
+	var named []int
+
+	for _, field := range reflect.VisibleFields(structType) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+
+		switch field.Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if keyed {
+				continue
+			}
+		case reflect.String:
+			if !keyed {
+				continue
+			}
+		default:
+			continue
+		}
+
+		tagName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+		if tagName == "id" {
+			return field.Index
+		}
+
+		if field.Name == "ID" && tagName == "" && named == nil {
+			named = field.Index
+		}
+	}
+
+	return named
+}
+
+// recID takes a record and returns its id.
+func recID(rec interface{}) (int, error) {
+	if r, ok := rec.(Record); ok {
+		return r.GetID(), nil
+	}
+
+	field, err := idField(rec, false)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(field.Int()), nil
+}
+
+// setRecID takes a record and an id and sets the record's id.
+func setRecID(rec interface{}, id int) error {
+	if r, ok := rec.(Record); ok {
+		r.SetID(id)
+		return nil
+	}
+
+	field, err := idField(rec, false)
+	if err != nil {
+		return err
+	}
+
+	field.SetInt(int64(id))
+
+	return nil
+}
+
+// recKey takes a record from a table with string keys and returns its
+// key.
+func recKey(rec interface{}) (string, error) {
+	if r, ok := rec.(KeyRecord); ok {
+		return r.GetKey(), nil
+	}
+
+	field, err := idField(rec, true)
+	if err != nil {
+		return "", err
+	}
+
+	return field.String(), nil
+}
+
+// setRecKey takes a record from a table with string keys and a key and
+// sets the record's key.
+func setRecKey(rec interface{}, key string) error {
+	if r, ok := rec.(KeyRecord); ok {
+		r.SetKey(key)
+		return nil
+	}
+
+	field, err := idField(rec, true)
+	if err != nil {
+		return err
+	}
+
+	field.SetString(key)
+
+	return nil
+}
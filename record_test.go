@@ -0,0 +1,169 @@
+package hare
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// plainContact is a record with no methods at all.
+type plainContact struct {
+	Key       int    `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Age       int    `json:"age"`
+}
+
+// namedContact is a record whose id field is found by its name.
+type namedContact struct {
+	ID        int
+	FirstName string `json:"first_name"`
+}
+
+func TestIDFieldTests(t *testing.T) {
+	tests := []struct {
+		rec     interface{}
+		wantID  int
+		wantErr error
+	}{
+		{&plainContact{Key: 3}, 3, nil},
+		{&namedContact{ID: 4}, 4, nil},
+		{&Contact{ID: 5}, 5, nil},
+		{&struct{ Name string }{}, 0, dberr.ErrNoIDField},
+		{plainContact{Key: 3}, 0, dberr.ErrNoIDField},
+		{&struct {
+			ID string `json:"id"`
+		}{}, 0, dberr.ErrNoIDField},
+	}
+
+	for _, tt := range tests {
+		gotID, gotErr := recID(tt.rec)
+		checkErr(t, tt.wantErr, gotErr)
+
+		if gotID != tt.wantID {
+			t.Errorf("want %v; got %v", tt.wantID, gotID)
+		}
+
+		if tt.wantErr != nil {
+			continue
+		}
+
+		if err := setRecID(tt.rec, 9); err != nil {
+			t.Fatal(err)
+		}
+
+		if gotID, _ := recID(tt.rec); gotID != 9 {
+			t.Errorf("want %v; got %v", 9, gotID)
+		}
+	}
+}
+
+func TestPlainRecordTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//Insert, Find, Update, and DeleteRecord...
+
+			return func(t *testing.T) {
+				c := plainContact{FirstName: "Robin", LastName: "Williams", Age: 88}
+
+				id, err := db.Insert("contacts", &c)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if c.Key != id {
+					t.Errorf("want %v; got %v", id, c.Key)
+				}
+
+				c.Age = 63
+
+				if err := db.Update("contacts", &c); err != nil {
+					t.Fatal(err)
+				}
+
+				found := plainContact{}
+
+				if err := db.Find("contacts", id, &found); err != nil {
+					t.Fatal(err)
+				}
+
+				if !reflect.DeepEqual(c, found) {
+					t.Errorf("want %+v; got %+v", c, found)
+				}
+
+				if err := db.DeleteRecord("contacts", &plainContact{Key: id}); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrNoRecord, db.Find("contacts", id, &found))
+
+				_, gotErr := db.Insert("contacts", &struct{ Name string }{"Robin"})
+				checkErr(t, dberr.ErrNoIDField, gotErr)
+
+				// The id was not used up.
+				nextID, err := db.Insert("contacts", &namedContact{FirstName: "Ann"})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if nextID != id+1 {
+					t.Errorf("want %v; got %v", id+1, nextID)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Typed tables of plain records...
+
+			return func(t *testing.T) {
+				contacts := TableOf[plainContact](db, "contacts")
+
+				c, err := contacts.Find(2)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if c.FirstName != "Abe" {
+					t.Errorf("want %v; got %v", "Abe", c.FirstName)
+				}
+
+				if err := contacts.Delete(2); err != nil {
+					t.Fatal(err)
+				}
+
+				_, gotErr := contacts.Find(2)
+				checkErr(t, dberr.ErrNoRecord, gotErr)
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//FindRaw...
+
+			return func(t *testing.T) {
+				rawRec, err := db.FindRaw("contacts", 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := `{"id":1,"first_name":"John","last_name":"Doe","age":37}`
+				got := string(rawRec)
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				if !json.Valid(rawRec) {
+					t.Errorf("want valid json; got %s", rawRec)
+				}
+
+				_, gotErr := db.FindRaw("contacts", 99)
+				checkErr(t, dberr.ErrNoRecord, gotErr)
+
+				_, gotErr = db.FindRaw("nonexistent", 1)
+				checkErr(t, dberr.ErrNoTable, gotErr)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
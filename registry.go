@@ -0,0 +1,129 @@
+package hare
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/jameycribbs/hare/dberr"
+	"github.com/jameycribbs/hare/keys"
+)
+
+// tableState is what the database keeps in memory for one table.  The
+// registry that maps table names to tableStates has a lock of its own,
+// so tables can be created and dropped while other tables are in use.
+//
+// codec and keyType only change while both the registry lock and the
+// table's write lock are held, when the table is reloaded, so they can
+// be read with either one held.  The other fields are guarded by lock.
+// A goroutine that waits for lock while the table is dropped, or the
+// database closed, finds removed set once it gets the lock, and gives up
+// with that error instead.
+type tableState struct {
+	lock    sync.RWMutex
+	codec   Codec
+	keyType keys.Type
+	lastID  int
+	indexes map[string]*index
+	removed error
+}
+
+// unexported methods
+
+// addTable takes the name of a table in the datastore, its codec, and
+// its key type, and adds it to the registry, with the last id handed out
+// read from the datastore.
+func (db *Database) addTable(tableName string, codec Codec, keyType keys.Type) error {
+	lastID, err := db.loadLastID(tableName)
+	if err != nil {
+		return err
+	}
+
+	tbl := &tableState{codec: codec, keyType: keyType, lastID: lastID, indexes: make(map[string]*index)}
+
+	db.tablesLock.Lock()
+	defer db.tablesLock.Unlock()
+
+	if db.closed {
+		return dberr.ErrClosed
+	}
+
+	db.tables[tableName] = tbl
+
+	return nil
+}
+
+// checkOpen returns dberr.ErrClosed if the database has been closed, or
+// is being closed.
+func (db *Database) checkOpen() error {
+	db.tablesLock.RLock()
+	defer db.tablesLock.RUnlock()
+
+	if db.closed {
+		return dberr.ErrClosed
+	}
+
+	return nil
+}
+
+// removeTable takes a table name and the table's state and takes the
+// table out of the registry.  It expects the caller to hold the table
+// lock, and goroutines waiting for the lock get err once the caller
+// releases it.
+func (db *Database) removeTable(tableName string, tbl *tableState, err error) {
+	tbl.removed = err
+
+	db.tablesLock.Lock()
+	defer db.tablesLock.Unlock()
+
+	if db.tables[tableName] == tbl {
+		delete(db.tables, tableName)
+	}
+}
+
+// table takes a table name and returns the table's state, and false if
+// there is no such table.
+func (db *Database) table(tableName string) (*tableState, bool) {
+	db.tablesLock.RLock()
+	defer db.tablesLock.RUnlock()
+
+	tbl, ok := db.tables[tableName]
+
+	return tbl, ok
+}
+
+// tableInfo takes a table name and returns the table's codec and key
+// type, and false if there is no such table.
+func (db *Database) tableInfo(tableName string) (Codec, keys.Type, bool) {
+	db.tablesLock.RLock()
+	defer db.tablesLock.RUnlock()
+
+	tbl, ok := db.tables[tableName]
+	if !ok {
+		return nil, "", false
+	}
+
+	return tbl.codec, tbl.keyType, true
+}
+
+// tableNames returns the names of the registered tables, sorted, so
+// that tables are always locked in the same order.
+func (db *Database) tableNames() []string {
+	db.tablesLock.RLock()
+	defer db.tablesLock.RUnlock()
+
+	tableNames := make([]string, 0, len(db.tables))
+
+	for tableName := range db.tables {
+		tableNames = append(tableNames, tableName)
+	}
+
+	sort.Strings(tableNames)
+
+	return tableNames
+}
+
+func (db *Database) tableExists(tableName string) bool {
+	_, ok := db.table(tableName)
+
+	return ok
+}
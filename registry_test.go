@@ -0,0 +1,169 @@
+package hare
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// These tests are meant to be run with -race.
+
+// checkRaceErr fails the test unless err is nil or one of the errors a
+// goroutine racing with table creation, DropTable, or Close can expect.
+func checkRaceErr(t *testing.T, err error, okErrs ...error) {
+	t.Helper()
+
+	if err == nil {
+		return
+	}
+
+	for _, okErr := range okErrs {
+		if errors.Is(err, okErr) {
+			return
+		}
+	}
+
+	t.Error(err)
+}
+
+func TestRegistryTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//CreateTable and DropTable while the tables are in use...
+
+			return func(t *testing.T) {
+				var wg sync.WaitGroup
+
+				for i := 0; i < 2; i++ {
+					wg.Add(1)
+
+					go func() {
+						defer wg.Done()
+
+						for j := 0; j < 25; j++ {
+							checkRaceErr(t, db.CreateTable("newtable"), dberr.ErrTableExists)
+							checkRaceErr(t, db.DropTable("newtable"), dberr.ErrNoTable)
+						}
+					}()
+				}
+
+				for _, tableName := range []string{"contacts", "newtable"} {
+					wg.Add(1)
+
+					go func() {
+						defer wg.Done()
+
+						for j := 0; j < 50; j++ {
+							id, err := db.Insert(tableName, &Contact{FirstName: "Robin"})
+							checkRaceErr(t, err, dberr.ErrNoTable)
+
+							checkRaceErr(t, db.Find(tableName, id, &Contact{}), dberr.ErrNoTable, dberr.ErrNoRecord)
+
+							_, err = db.IDs(tableName)
+							checkRaceErr(t, err, dberr.ErrNoTable)
+
+							_, err = db.Query(tableName).Where("first_name", "=", "Robin").IDs()
+							checkRaceErr(t, err, dberr.ErrNoTable)
+
+							checkRaceErr(t, db.Set(tableName, id, "age", j), dberr.ErrNoTable, dberr.ErrNoRecord)
+						}
+					}()
+				}
+
+				wg.Wait()
+
+				ids, err := db.IDs("contacts")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(ids) != 54 {
+					t.Errorf("want %v; got %v", 54, len(ids))
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Close while the tables are in use...
+
+			return func(t *testing.T) {
+				var wg sync.WaitGroup
+
+				for i := 0; i < 4; i++ {
+					wg.Add(1)
+
+					go func() {
+						defer wg.Done()
+
+						for {
+							_, err := db.Insert("contacts", &Contact{FirstName: "Robin"})
+							checkRaceErr(t, err, dberr.ErrNoTable, dberr.ErrClosed)
+
+							if err != nil {
+								return
+							}
+
+							err = db.Find("contacts", 1, &Contact{})
+							checkRaceErr(t, err, dberr.ErrNoTable, dberr.ErrClosed)
+
+							if err != nil {
+								return
+							}
+						}
+					}()
+				}
+
+				checkRaceErr(t, db.CreateTable("newtable"), dberr.ErrClosed)
+				checkRaceErr(t, db.Close())
+
+				wg.Wait()
+
+				checkErr(t, dberr.ErrNoTable, db.Find("contacts", 1, &Contact{}))
+				checkErr(t, dberr.ErrNoTable, db.DropTable("contacts"))
+				checkErr(t, dberr.ErrClosed, db.CreateTable("newtable"))
+				checkErr(t, dberr.ErrClosed, db.Close())
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Waiting for a table that is dropped...
+
+			return func(t *testing.T) {
+				if err := db.CreateTable("newtable"); err != nil {
+					t.Fatal(err)
+				}
+
+				tbl, _ := db.table("newtable")
+				tbl.lock.RLock()
+
+				dropped := make(chan error)
+
+				go func() {
+					dropped <- db.DropTable("newtable")
+				}()
+
+				// Wait for DropTable to be waiting on the lock, so the
+				// Find below queues up behind it.
+				for tbl.lock.TryRLock() {
+					tbl.lock.RUnlock()
+				}
+
+				found := make(chan error)
+
+				go func() {
+					found <- db.Find("newtable", 1, &Contact{})
+				}()
+
+				tbl.lock.RUnlock()
+
+				if err := <-dropped; err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrNoTable, <-found)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
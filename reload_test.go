@@ -0,0 +1,108 @@
+//go:build !windows
+// +build !windows
+
+package hare
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/jameycribbs/hare/datastores/disk"
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestReloadDiskTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//Reload...
+
+			writerDS, err := disk.New("./testdata", ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			writer, err := New(writerDS)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer writer.Close()
+
+			readerDS, err := disk.NewWithOptions("./testdata", ".json", disk.Options{ReadOnly: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reader, err := New(readerDS)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			if !reader.ReadOnly() {
+				t.Errorf("want %v; got %v", true, false)
+			}
+
+			_, err = reader.Insert("contacts", &Contact{FirstName: "Robin"})
+			checkErr(t, dberr.ErrReadOnly, err)
+
+			if err := reader.CreateIndex("contacts", "last_name"); err != nil {
+				t.Fatal(err)
+			}
+
+			id, err := writer.Insert("contacts", &Contact{FirstName: "Robin", LastName: "Lincoln"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := writer.CreateTable("newtable"); err != nil {
+				t.Fatal(err)
+			}
+
+			checkErr(t, dberr.ErrNoRecord, reader.Find("contacts", id, &Contact{}))
+
+			if err := reader.Reload(); err != nil {
+				t.Fatal(err)
+			}
+
+			c := Contact{}
+			if err := reader.Find("contacts", id, &c); err != nil {
+				t.Fatal(err)
+			}
+
+			if c.FirstName != "Robin" {
+				t.Errorf("want %v; got %v", "Robin", c.FirstName)
+			}
+
+			ids, err := reader.FindIDsBy("contacts", "last_name", "Lincoln")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(ids) != 2 || ids[1] != id {
+				t.Errorf("want %v; got %v", []int{2, id}, ids)
+			}
+
+			if !reader.TableExists("newtable") {
+				t.Errorf("want %v; got %v", true, false)
+			}
+
+			if err := writer.DropTable("newtable"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := reader.Reload(); err != nil {
+				t.Fatal(err)
+			}
+
+			if reader.TableExists("newtable") {
+				t.Errorf("want %v; got %v", false, true)
+			}
+		},
+	}
+
+	for i, fn := range tests {
+		testSetup(t)
+		t.Run(strconv.Itoa(i), fn)
+		testTeardown(t)
+	}
+}
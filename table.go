@@ -0,0 +1,189 @@
+package hare
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/jameycribbs/hare/dberr"
+	"github.com/jameycribbs/hare/keys"
+)
+
+// Table is a typed handle on one table in a Database.  T is the struct
+// that represents a record in the table, like Episode, and the handle
+// reads and writes pointers to it, like *Episode.  PT is inferred from
+// T and never has to be given.  The struct does not have to implement
+// the Record interface.  Table is built on the Database methods, so it
+// can be mixed freely with them.
+type Table[T any, PT interface{ *T }] struct {
+	db        *Database
+	tableName string
+}
+
+// TableOf takes a database and a table name and returns a typed handle
+// on that table.
+func TableOf[T any, PT interface{ *T }](db *Database, tableName string) *Table[T, PT] {
+	return &Table[T, PT]{db: db, tableName: tableName}
+}
+
+// All returns every record in the table, in id order.
+func (tbl *Table[T, PT]) All() ([]PT, error) {
+	return tbl.Where(func(PT) bool { return true })
+}
+
+// Delete takes a record id and removes that record from the table,
+// running the record's delete hooks if it has any.
+func (tbl *Table[T, PT]) Delete(id int) error {
+	return tbl.delete(id, "")
+}
+
+// DeleteKey takes a key and removes the record with that key from a
+// table with string keys.
+func (tbl *Table[T, PT]) DeleteKey(key string) error {
+	if err := tbl.db.checkKeyed(tbl.tableName); err != nil {
+		return err
+	}
+
+	return tbl.delete(keys.ID(key), key)
+}
+
+// Find takes a record id and returns the record with that id.
+func (tbl *Table[T, PT]) Find(id int) (PT, error) {
+	rec := tbl.newRec()
+
+	if err := tbl.db.Find(tbl.tableName, id, rec); err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// FindKey takes a key and returns the record with that key from a table
+// with string keys.
+func (tbl *Table[T, PT]) FindKey(key string) (PT, error) {
+	rec := tbl.newRec()
+
+	if err := tbl.db.FindKey(tbl.tableName, key, rec); err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// First takes a query function and returns the record with the lowest
+// id that it returns true for, or dberr.ErrNoRecord if there is none.
+func (tbl *Table[T, PT]) First(queryFn func(PT) bool) (PT, error) {
+	ids, err := tbl.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		rec, err := tbl.Find(id)
+		if errors.Is(err, dberr.ErrNoRecord) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if queryFn(rec) {
+			return rec, nil
+		}
+	}
+
+	return nil, dberr.ErrNoRecord
+}
+
+// Insert takes a record and adds it to the table.  It returns the new
+// record's id.
+func (tbl *Table[T, PT]) Insert(rec PT) (int, error) {
+	return tbl.db.Insert(tbl.tableName, rec)
+}
+
+// InsertWithID takes a record and adds it to the table under the id it
+// already has.
+func (tbl *Table[T, PT]) InsertWithID(rec PT) error {
+	return tbl.db.InsertWithID(tbl.tableName, rec)
+}
+
+// Name returns the name of the table.
+func (tbl *Table[T, PT]) Name() string {
+	return tbl.tableName
+}
+
+// Update takes a record and updates the record in the table that has
+// that record's id.
+func (tbl *Table[T, PT]) Update(rec PT) error {
+	return tbl.db.Update(tbl.tableName, rec)
+}
+
+// Upsert takes a record and replaces the record in the table that has
+// that record's id, or adds it if there is none.  It returns the
+// record's id.
+func (tbl *Table[T, PT]) Upsert(rec PT) (int, error) {
+	return tbl.db.Upsert(tbl.tableName, rec)
+}
+
+// Where takes a query function and returns every record in the table
+// that it returns true for, in id order.  The table is not locked while
+// the query function runs, so it may write to the table, and records
+// deleted after the scan starts are skipped.
+func (tbl *Table[T, PT]) Where(queryFn func(PT) bool) ([]PT, error) {
+	var results []PT
+
+	ids, err := tbl.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		rec, err := tbl.Find(id)
+		if errors.Is(err, dberr.ErrNoRecord) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if queryFn(rec) {
+			results = append(results, rec)
+		}
+	}
+
+	return results, nil
+}
+
+// unexported methods
+
+// delete takes a record id and the key the id was made from, or an
+// empty key, and removes that record from the table.
+func (tbl *Table[T, PT]) delete(id int, key string) error {
+	rec := tbl.newRec()
+
+	if !hasDeleteHooks(rec) {
+		return tbl.db.deleteID(context.Background(), tbl.tableName, id, key)
+	}
+
+	if !tbl.db.TableExists(tbl.tableName) {
+		return dberr.ErrNoTable
+	}
+
+	return tbl.db.deleteRecord(context.Background(), tbl.tableName, id, key, rec)
+}
+
+func (tbl *Table[T, PT]) ids() ([]int, error) {
+	ids, err := tbl.db.IDs(tbl.tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Ints(ids)
+
+	return ids, nil
+}
+
+// newRec returns a pointer to a new, zeroed T.
+func (tbl *Table[T, PT]) newRec() PT {
+	return PT(new(T))
+}
@@ -0,0 +1,190 @@
+package hare
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestTypedTableTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//Find...
+
+			return func(t *testing.T) {
+				contacts := TableOf[Contact](db, "contacts")
+
+				c, err := contacts.Find(2)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := "Abe Lincoln is 52"
+				got := fmt.Sprintf("%s %s is %d", c.FirstName, c.LastName, c.Age)
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				_, gotErr := contacts.Find(99)
+				checkErr(t, dberr.ErrNoRecord, gotErr)
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Insert, Update, and Delete...
+
+			return func(t *testing.T) {
+				contacts := TableOf[Contact](db, "contacts")
+
+				id, err := contacts.Insert(&Contact{FirstName: "Robin", LastName: "Williams", Age: 88})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := contacts.Update(&Contact{ID: id, FirstName: "Robin", LastName: "Williams", Age: 63}); err != nil {
+					t.Fatal(err)
+				}
+
+				c, err := contacts.Find(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := 63
+				got := c.Age
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				if err := contacts.Delete(id); err != nil {
+					t.Fatal(err)
+				}
+
+				_, gotErr := contacts.Find(id)
+				checkErr(t, dberr.ErrNoRecord, gotErr)
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//All, Where, and First...
+
+			return func(t *testing.T) {
+				contacts := TableOf[Contact](db, "contacts")
+
+				all, err := contacts.All()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for i, c := range all {
+					want := i + 1
+					got := c.ID
+
+					if want != got {
+						t.Errorf("want %v; got %v", want, got)
+					}
+				}
+
+				adults, err := contacts.Where(func(c *Contact) bool { return c.Age > 30 })
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := 2
+				got := len(adults)
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				c, err := contacts.First(func(c *Contact) bool { return c.Age < 30 })
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want = 3
+				got = c.ID
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				_, gotErr := contacts.First(func(c *Contact) bool { return c.Age > 100 })
+				checkErr(t, dberr.ErrNoRecord, gotErr)
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Where and First (record deleted during the scan)...
+
+			return func(t *testing.T) {
+				contacts := TableOf[Contact](db, "contacts")
+
+				results, err := contacts.Where(func(c *Contact) bool {
+					if c.ID == 1 {
+						if err := contacts.Delete(2); err != nil {
+							t.Fatal(err)
+						}
+					}
+
+					return true
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := []int{1, 3, 4}
+				var got []int
+				for _, c := range results {
+					got = append(got, c.ID)
+				}
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				c, err := contacts.First(func(c *Contact) bool {
+					if c.ID == 1 {
+						if err := contacts.Delete(3); err != nil {
+							t.Fatal(err)
+						}
+					}
+
+					return c.ID > 1
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if c.ID != 4 {
+					t.Errorf("want %v; got %v", 4, c.ID)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//All (ErrNoTable error)...
+
+			return func(t *testing.T) {
+				_, gotErr := TableOf[Contact](db, "nonexistent").All()
+				checkErr(t, dberr.ErrNoTable, gotErr)
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//ErrNoIDField error for a struct without an id field...
+
+			return func(t *testing.T) {
+				type noIDContact struct {
+					FirstName string `json:"first_name"`
+				}
+
+				contacts := TableOf[noIDContact](db, "contacts")
+
+				_, gotErr := contacts.Insert(&noIDContact{FirstName: "Robin"})
+				checkErr(t, dberr.ErrNoIDField, gotErr)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
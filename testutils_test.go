@@ -48,10 +48,13 @@ func runTestFns(t *testing.T, testFns []func(*Database) func(*testing.T)) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		defer diskDB.Close()
 
 		t.Run(fmt.Sprintf("disk/%s", tstNum), fn(diskDB))
 
+		// Close before teardown, so nothing is written to testdata
+		// after the files are removed.
+		diskDB.Close()
+
 		ramDS, err := ram.New(seedData())
 		if err != nil {
 			t.Fatal(err)
@@ -89,7 +92,7 @@ func testTeardown(t *testing.T) {
 }
 
 func testRemoveFiles(t *testing.T) {
-	filesToRemove := []string{"contacts.json", "newtable.json"}
+	filesToRemove := []string{"contacts.json", "newtable.json", "contacts.json.idx", "newtable.json.idx", "contacts.json.seq", "newtable.json.seq", "contacts.json.fdx", "newtable.json.fdx", "hare.lock"}
 
 	for _, f := range filesToRemove {
 		err := os.Remove("./testdata/" + f)
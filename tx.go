@@ -0,0 +1,376 @@
+package hare
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// batcher is implemented by datastores that can apply a batch of
+// writes to several tables so that either all of them or none of them
+// take effect.
+type batcher interface {
+	BeginBatch([]string) error
+	CommitBatch() error
+	RollbackBatch() error
+}
+
+const (
+	txInsert = iota
+	txUpdate
+	txDelete
+)
+
+type txOp struct {
+	kind      int
+	tableName string
+	id        int
+	rawRec    []byte
+	rec       interface{}
+}
+
+// Tx is a set of inserts, updates, and deletes, possibly across several
+// tables, that are buffered until Commit applies all of them together or
+// Rollback throws them away.
+type Tx struct {
+	db      *Database
+	ops     []txOp
+	pending map[string]map[int][]byte
+	done    bool
+}
+
+// Begin starts a new transaction.
+func (db *Database) Begin() (*Tx, error) {
+	if err := db.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	if _, ok := db.store.(batcher); !ok {
+		return nil, dberr.ErrTxNotSupported
+	}
+
+	tx := Tx{db: db}
+	tx.pending = make(map[string]map[int][]byte)
+
+	return &tx, nil
+}
+
+// Commit takes the locks on every table touched by the transaction and
+// applies all of the buffered writes.  If any of them fails, the ones
+// already applied are undone and the error is returned.
+func (tx *Tx) Commit() error {
+	return tx.CommitCtx(context.Background())
+}
+
+// CommitCtx is Commit with a context for waiting on the table locks.  If
+// the context is done before every lock is taken, nothing is written,
+// and the transaction is over as with any other failed commit.
+func (tx *Tx) CommitCtx(ctx context.Context) error {
+	if tx.done {
+		return dberr.ErrTxDone
+	}
+
+	tx.done = true
+
+	if len(tx.ops) == 0 {
+		return nil
+	}
+
+	db := tx.db
+	tableNames := tx.tableNames()
+
+	for _, tableName := range tableNames {
+		if !db.TableExists(tableName) {
+			return dberr.ErrNoTable
+		}
+	}
+
+	if err := lockMutex(ctx, &db.txLock); err != nil {
+		return err
+	}
+	defer db.txLock.Unlock()
+
+	// Tables are always locked in name order, so two transactions can
+	// never wait on each other.
+	for _, tableName := range tableNames {
+		unlock, err := db.lockTable(ctx, tableName)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	store := db.store.(batcher)
+
+	if err := store.BeginBatch(tableNames); err != nil {
+		return err
+	}
+
+	oldRaws := make([][]byte, len(tx.ops))
+
+	for i := range tx.ops {
+		op := &tx.ops[i]
+
+		if op.kind != txInsert {
+			oldRaws[i] = db.watchedRec(op.tableName, op.id)
+		}
+
+		if err := tx.apply(op); err != nil {
+			if rollbackErr := store.RollbackBatch(); rollbackErr != nil {
+				return rollbackErr
+			}
+
+			return err
+		}
+	}
+
+	if err := store.CommitBatch(); err != nil {
+		if rollbackErr := store.RollbackBatch(); rollbackErr != nil {
+			return rollbackErr
+		}
+
+		return err
+	}
+
+	for _, op := range tx.ops {
+		if op.kind == txDelete {
+			db.unindexRec(op.tableName, op.id)
+			continue
+		}
+
+		if err := db.indexRec(op.tableName, op.id, op.rawRec); err != nil {
+			return err
+		}
+	}
+
+	for i, op := range tx.ops {
+		db.publish(op.eventKind(), op.tableName, op.id, oldRaws[i], op.rawRec)
+	}
+
+	for _, op := range tx.ops {
+		if err := tx.afterHook(op); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete takes a table name and record id and buffers the removal of
+// that record.
+func (tx *Tx) Delete(tableName string, id int) error {
+	if _, err := tx.readRec(tableName, id); err != nil {
+		return err
+	}
+
+	tx.stage(txDelete, tableName, id, nil, nil)
+
+	return nil
+}
+
+// Find takes a table name, a record id, and a pointer to a struct, and
+// populates the struct.  Writes buffered in the transaction are visible
+// to Find.
+func (tx *Tx) Find(tableName string, id int, rec interface{}) error {
+	rawRec, err := tx.readRec(tableName, id)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.db.codecFor(tableName).Unmarshal(rawRec, rec); err != nil {
+		return err
+	}
+
+	return tx.db.afterFind(rec)
+}
+
+// Insert takes a table name and a pointer to a record struct and
+// buffers the addition of a new record to the table.  It returns the new
+// record's id, which is reserved even if the transaction is rolled back.
+// The record's BeforeInsert hook and Validate run now, and its
+// AfterInsert hook runs once the transaction is committed.
+func (tx *Tx) Insert(tableName string, rec interface{}) (int, error) {
+	if tx.done {
+		return 0, dberr.ErrTxDone
+	}
+
+	db := tx.db
+
+	if !db.TableExists(tableName) {
+		return 0, dberr.ErrNoTable
+	}
+
+	unlock, err := db.lockTable(context.Background(), tableName)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := db.assignID(tableName, rec)
+	unlock()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := db.beforeInsert(rec); err != nil {
+		return 0, err
+	}
+
+	firstVersion(rec)
+
+	rawRec, err := tx.db.codecFor(tableName).Marshal(rec)
+	if err != nil {
+		return 0, err
+	}
+
+	tx.stage(txInsert, tableName, id, rawRec, rec)
+
+	return id, nil
+}
+
+// Rollback throws away every write buffered in the transaction.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return dberr.ErrTxDone
+	}
+
+	tx.done = true
+	tx.ops = nil
+	tx.pending = nil
+
+	return nil
+}
+
+// Update takes a table name and a pointer to a record struct and
+// buffers the update of the record with that record's id.  The record's
+// BeforeUpdate hook and Validate run now, and its AfterUpdate hook runs
+// once the transaction is committed.
+func (tx *Tx) Update(tableName string, rec interface{}) error {
+	id, key, err := tx.db.recID(tableName, rec)
+	if err != nil {
+		return err
+	}
+
+	rawRec, err := tx.readRec(tableName, id)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.db.matchKey(tableName, rawRec, key); err != nil {
+		return err
+	}
+
+	if err := tx.db.beforeUpdate(rec); err != nil {
+		return err
+	}
+
+	rawRec, err = tx.db.codecFor(tableName).Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	tx.stage(txUpdate, tableName, id, rawRec, rec)
+
+	return nil
+}
+
+// unexported methods
+
+// apply expects the caller to hold the table lock.  The version of a
+// versioned record being updated is only known now, so the record is
+// encoded again with it.
+func (tx *Tx) apply(op *txOp) error {
+	switch op.kind {
+	case txInsert:
+		return tx.db.store.InsertRec(op.tableName, op.id, op.rawRec)
+	case txUpdate:
+		if _, ok := recVersion(op.rec); ok {
+			if err := tx.db.nextVersion(op.tableName, op.id, op.rec); err != nil {
+				return err
+			}
+
+			rawRec, err := tx.db.codecFor(op.tableName).Marshal(op.rec)
+			if err != nil {
+				return err
+			}
+			op.rawRec = rawRec
+		}
+
+		return tx.db.store.UpdateRec(op.tableName, op.id, op.rawRec)
+	default:
+		return tx.db.store.DeleteRec(op.tableName, op.id)
+	}
+}
+
+// afterHook runs the after hook of the record written by an operation.
+func (tx *Tx) afterHook(op txOp) error {
+	switch op.kind {
+	case txInsert:
+		return tx.db.afterInsert(op.rec)
+	case txUpdate:
+		return tx.db.afterUpdate(op.rec)
+	default:
+		return nil
+	}
+}
+
+func (op txOp) eventKind() EventKind {
+	switch op.kind {
+	case txInsert:
+		return EventInsert
+	case txUpdate:
+		return EventUpdate
+	default:
+		return EventDelete
+	}
+}
+
+func (tx *Tx) readRec(tableName string, id int) ([]byte, error) {
+	if tx.done {
+		return nil, dberr.ErrTxDone
+	}
+
+	if rawRec, ok := tx.pending[tableName][id]; ok {
+		if rawRec == nil {
+			return nil, dberr.ErrNoRecord
+		}
+
+		return rawRec, nil
+	}
+
+	db := tx.db
+
+	if !db.TableExists(tableName) {
+		return nil, dberr.ErrNoTable
+	}
+
+	unlock, err := db.rlockTable(context.Background(), tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return db.store.ReadRec(tableName, id)
+}
+
+func (tx *Tx) stage(kind int, tableName string, id int, rawRec []byte, rec interface{}) {
+	tx.ops = append(tx.ops, txOp{kind: kind, tableName: tableName, id: id, rawRec: rawRec, rec: rec})
+
+	if tx.pending[tableName] == nil {
+		tx.pending[tableName] = make(map[int][]byte)
+	}
+	tx.pending[tableName][id] = rawRec
+}
+
+func (tx *Tx) tableNames() []string {
+	var tableNames []string
+
+	for tableName := range tx.pending {
+		tableNames = append(tableNames, tableName)
+	}
+
+	sort.Strings(tableNames)
+
+	return tableNames
+}
@@ -0,0 +1,249 @@
+package hare
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestTxTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//Commit...
+
+			return func(t *testing.T) {
+				if err := db.CreateTable("newtable"); err != nil {
+					t.Fatal(err)
+				}
+
+				tx, err := db.Begin()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if _, err := tx.Insert("newtable", &Contact{FirstName: "Robin", LastName: "Williams", Age: 88}); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Update("contacts", &Contact{ID: 4, FirstName: "Hazel", LastName: "Koller", Age: 26}); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Delete("contacts", 3); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrNoRecord, db.Find("newtable", 1, &Contact{}))
+
+				if err := tx.Commit(); err != nil {
+					t.Fatal(err)
+				}
+
+				c := Contact{}
+
+				if err := db.Find("newtable", 1, &c); err != nil {
+					t.Fatal(err)
+				}
+
+				want := "Robin Williams is 88"
+				got := fmt.Sprintf("%s %s is %d", c.FirstName, c.LastName, c.Age)
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				if err := db.Find("contacts", 4, &c); err != nil {
+					t.Fatal(err)
+				}
+
+				want = "Hazel Koller is 26"
+				got = fmt.Sprintf("%s %s is %d", c.FirstName, c.LastName, c.Age)
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				checkErr(t, dberr.ErrNoRecord, db.Find("contacts", 3, &Contact{}))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Commit (failed write rolls back earlier writes)...
+
+			return func(t *testing.T) {
+				tx, err := db.Begin()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Update("contacts", &Contact{ID: 4, FirstName: "Hazel", LastName: "Koller", Age: 26}); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Delete("contacts", 2); err != nil {
+					t.Fatal(err)
+				}
+
+				// Delete the record outside of the transaction, so that
+				// the buffered delete fails at commit time.
+				if err := db.Delete("contacts", 2); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrNoRecord, tx.Commit())
+
+				c := Contact{}
+
+				if err := db.Find("contacts", 4, &c); err != nil {
+					t.Fatal(err)
+				}
+
+				want := "Helen Keller is 25"
+				got := fmt.Sprintf("%s %s is %d", c.FirstName, c.LastName, c.Age)
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Find (sees buffered writes)...
+
+			return func(t *testing.T) {
+				tx, err := db.Begin()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer tx.Rollback()
+
+				if err := tx.Update("contacts", &Contact{ID: 4, FirstName: "Hazel", LastName: "Koller", Age: 26}); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Delete("contacts", 3); err != nil {
+					t.Fatal(err)
+				}
+
+				c := Contact{}
+
+				if err := tx.Find("contacts", 4, &c); err != nil {
+					t.Fatal(err)
+				}
+
+				want := "Hazel Koller is 26"
+				got := fmt.Sprintf("%s %s is %d", c.FirstName, c.LastName, c.Age)
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				checkErr(t, dberr.ErrNoRecord, tx.Find("contacts", 3, &c))
+
+				if err := tx.Find("contacts", 2, &c); err != nil {
+					t.Fatal(err)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Rollback...
+
+			return func(t *testing.T) {
+				tx, err := db.Begin()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Delete("contacts", 3); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Rollback(); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.Find("contacts", 3, &Contact{}); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrTxDone, tx.Commit())
+				checkErr(t, dberr.ErrTxDone, tx.Rollback())
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Update (ErrNoRecord and ErrNoTable errors)...
+
+			return func(t *testing.T) {
+				tx, err := db.Begin()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer tx.Rollback()
+
+				checkErr(t, dberr.ErrNoRecord, tx.Update("contacts", &Contact{ID: 99}))
+				checkErr(t, dberr.ErrNoTable, tx.Update("nonexistent", &Contact{ID: 4}))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Commit while another table is being written...
+
+			return func(t *testing.T) {
+				if err := db.CreateTable("newtable"); err != nil {
+					t.Fatal(err)
+				}
+
+				var wg sync.WaitGroup
+
+				wg.Add(2)
+
+				go func() {
+					defer wg.Done()
+
+					for i := 0; i < 25; i++ {
+						tx, err := db.Begin()
+						if err != nil {
+							t.Error(err)
+							return
+						}
+
+						if _, err := tx.Insert("newtable", &Contact{FirstName: "Robin"}); err != nil {
+							t.Error(err)
+							return
+						}
+
+						if err := tx.Commit(); err != nil {
+							t.Error(err)
+							return
+						}
+					}
+				}()
+
+				go func() {
+					defer wg.Done()
+
+					for i := 0; i < 25; i++ {
+						if _, err := db.Insert("contacts", &Contact{FirstName: "Robin"}); err != nil {
+							t.Error(err)
+							return
+						}
+					}
+				}()
+
+				wg.Wait()
+
+				for tableName, want := range map[string]int{"contacts": 29, "newtable": 25} {
+					ids, err := db.IDs(tableName)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if want != len(ids) {
+						t.Errorf("want %v; got %v", want, len(ids))
+					}
+				}
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
@@ -0,0 +1,239 @@
+package hare
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// VersionedRecord interface defines the methods a struct representing a
+// table record can implement to have Hare keep a version number in it.
+// Structs that do not implement it can opt in with an integer field
+// tagged `json:"_rev"` instead, which is found by reflection.
+//
+// The version is set to 1 when the record is inserted and goes up by one
+// every time the record is written, so UpdateIfVersion can tell whether
+// a record has changed since it was read.
+type VersionedRecord interface {
+	SetVersion(int)
+	GetVersion() int
+}
+
+// versionKey is the json field the version is stored in.
+const versionKey = "_rev"
+
+// versionFields caches the index of the version field of each struct
+// type, or nil if the type has none.
+var versionFields sync.Map
+
+// UpdateIfVersion takes a table name, a pointer to a versioned record
+// struct, and the version the record had when it was read, and, while
+// holding the table lock, updates the record in the table that has that
+// record's id, or key, only if the stored record still has that version.
+// Otherwise it returns dberr.ErrConflict, and the record should be read
+// again and the change made again.  The record's version is set to the
+// new one.
+//
+//	err := db.Find("contacts", 1, &c)
+//	c.Age++
+//	err = db.UpdateIfVersion("contacts", &c, c.Rev)
+func (db *Database) UpdateIfVersion(tableName string, rec interface{}, version int) error {
+	return db.UpdateIfVersionCtx(context.Background(), tableName, rec, version)
+}
+
+// UpdateIfVersionCtx is UpdateIfVersion with a context for waiting on the
+// table lock.
+func (db *Database) UpdateIfVersionCtx(ctx context.Context, tableName string, rec interface{}, version int) error {
+	if err := db.checkWritable(); err != nil {
+		return err
+	}
+
+	if !db.TableExists(tableName) {
+		return dberr.ErrNoTable
+	}
+
+	if _, ok := recVersion(rec); !ok {
+		return dberr.ErrNoVersionField
+	}
+
+	unlock, err := db.lockTable(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	id, key, err := db.recID(tableName, rec)
+	if err != nil {
+		return err
+	}
+
+	if err := db.checkKey(tableName, id, key); err != nil {
+		return err
+	}
+
+	stored, err := db.storedVersion(tableName, id)
+	if err != nil {
+		return err
+	}
+
+	if stored != version {
+		return dberr.ErrConflict
+	}
+
+	if err := db.beforeUpdate(rec); err != nil {
+		return err
+	}
+
+	if err := db.writeUpdate(tableName, id, rec); err != nil {
+		return err
+	}
+
+	return db.afterUpdate(rec)
+}
+
+// unexported methods
+
+// nextVersion takes a table name, a record id, and a pointer to a record
+// struct about to be written over the stored record with that id, and,
+// if the record is versioned, sets its version to the one after the
+// stored record's.  It expects the caller to hold the table lock.
+func (db *Database) nextVersion(tableName string, id int, rec interface{}) error {
+	if _, ok := recVersion(rec); !ok {
+		return nil
+	}
+
+	stored, err := db.storedVersion(tableName, id)
+	if err != nil {
+		return err
+	}
+
+	setRecVersion(rec, stored+1)
+
+	return nil
+}
+
+// storedVersion takes a table name and a record id and returns the
+// version of the stored record, which is 0 if it has none.  It expects
+// the caller to hold the table lock.
+func (db *Database) storedVersion(tableName string, id int) (int, error) {
+	rawRec, err := db.store.ReadRec(tableName, id)
+	if err != nil {
+		return 0, err
+	}
+
+	var versionDoc struct {
+		Version int `json:"_rev"`
+	}
+
+	if err := db.codecFor(tableName).Unmarshal(rawRec, &versionDoc); err != nil {
+		return 0, err
+	}
+
+	return versionDoc.Version, nil
+}
+
+// firstVersion takes a record about to be inserted and, if it is
+// versioned and does not have a version yet, sets its version to 1.
+func firstVersion(rec interface{}) {
+	if version, ok := recVersion(rec); ok && version == 0 {
+		setRecVersion(rec, 1)
+	}
+}
+
+// nextDocVersion takes the version of a stored record, as a generic
+// json value, and the record after it was changed, decoded into generic
+// json values, and, if the stored record has a version, sets the changed
+// record's version to the one after it.
+func nextDocVersion(oldVersion interface{}, doc map[string]interface{}) {
+	number, ok := oldVersion.(json.Number)
+	if !ok {
+		return
+	}
+
+	version, err := number.Int64()
+	if err != nil {
+		return
+	}
+
+	doc[versionKey] = json.Number(strconv.FormatInt(version+1, 10))
+}
+
+// recVersion takes a record and returns its version, and false if it is
+// not versioned.
+func recVersion(rec interface{}) (int, bool) {
+	if r, ok := rec.(VersionedRecord); ok {
+		return r.GetVersion(), true
+	}
+
+	field, ok := versionField(rec)
+	if !ok {
+		return 0, false
+	}
+
+	return int(field.Int()), true
+}
+
+// setRecVersion takes a versioned record and a version and sets the
+// record's version.
+func setRecVersion(rec interface{}, version int) {
+	if r, ok := rec.(VersionedRecord); ok {
+		r.SetVersion(version)
+		return
+	}
+
+	if field, ok := versionField(rec); ok {
+		field.SetInt(int64(version))
+	}
+}
+
+// versionField takes a record and returns its version field, and false
+// if it has none.
+func versionField(rec interface{}) (reflect.Value, bool) {
+	recVal := reflect.ValueOf(rec)
+
+	if recVal.Kind() != reflect.Ptr || recVal.IsNil() || recVal.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+
+	structVal := recVal.Elem()
+	structType := structVal.Type()
+
+	index, ok := versionFields.Load(structType)
+	if !ok {
+		index = versionFieldIndex(structType)
+		versionFields.Store(structType, index)
+	}
+
+	if index.([]int) == nil {
+		return reflect.Value{}, false
+	}
+
+	return structVal.FieldByIndex(index.([]int)), true
+}
+
+// versionFieldIndex takes a struct type and returns the index of its
+// integer field tagged `json:"_rev"`.
+func versionFieldIndex(structType reflect.Type) []int {
+	for _, field := range reflect.VisibleFields(structType) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+
+		switch field.Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		default:
+			continue
+		}
+
+		if tagName, _, _ := strings.Cut(field.Tag.Get("json"), ","); tagName == versionKey {
+			return field.Index
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,204 @@
+package hare
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// versionedContact is a contact with a version field.
+type versionedContact struct {
+	ID        int    `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Age       int    `json:"age"`
+	Rev       int    `json:"_rev"`
+}
+
+// methodVersionedContact is a contact that gets and sets its own
+// version.
+type methodVersionedContact struct {
+	ID        int    `json:"id"`
+	FirstName string `json:"first_name"`
+	Version   int    `json:"_rev"`
+}
+
+func (c *methodVersionedContact) GetVersion() int {
+	return c.Version
+}
+
+func (c *methodVersionedContact) SetVersion(version int) {
+	c.Version = version
+}
+
+func TestVersionTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//Insert and Update...
+
+			return func(t *testing.T) {
+				c := versionedContact{FirstName: "Robin", Age: 30}
+
+				id, err := db.Insert("contacts", &c)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if c.Rev != 1 {
+					t.Errorf("want %v; got %v", 1, c.Rev)
+				}
+
+				// Update writes blindly, but still moves the version on.
+				stale := versionedContact{ID: id, FirstName: "Robin", Age: 31}
+
+				if err := db.Update("contacts", &stale); err != nil {
+					t.Fatal(err)
+				}
+
+				found := versionedContact{}
+				if err := db.Find("contacts", id, &found); err != nil {
+					t.Fatal(err)
+				}
+
+				if found.Rev != 2 || stale.Rev != 2 {
+					t.Errorf("want %v; got %v and %v", 2, found.Rev, stale.Rev)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//UpdateIfVersion...
+
+			return func(t *testing.T) {
+				first := methodVersionedContact{}
+				if err := db.Find("contacts", 3, &first); err != nil {
+					t.Fatal(err)
+				}
+
+				second := first
+
+				// A record written before it had a version is version 0.
+				first.FirstName = "William"
+				if err := db.UpdateIfVersion("contacts", &first, first.Version); err != nil {
+					t.Fatal(err)
+				}
+
+				if first.Version != 1 {
+					t.Errorf("want %v; got %v", 1, first.Version)
+				}
+
+				second.FirstName = "Will"
+				checkErr(t, dberr.ErrConflict, db.UpdateIfVersion("contacts", &second, second.Version))
+
+				found := methodVersionedContact{}
+				if err := db.Find("contacts", 3, &found); err != nil {
+					t.Fatal(err)
+				}
+
+				if found != first {
+					t.Errorf("want %v; got %v", first, found)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//UpdateIfVersion (errors)...
+
+			return func(t *testing.T) {
+				checkErr(t, dberr.ErrNoVersionField, db.UpdateIfVersion("contacts", &Contact{ID: 3}, 0))
+				checkErr(t, dberr.ErrNoRecord, db.UpdateIfVersion("contacts", &versionedContact{ID: 99}, 0))
+				checkErr(t, dberr.ErrNoTable, db.UpdateIfVersion("nonexistent", &versionedContact{ID: 3}, 0))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Patch and Tx.Update move the version on...
+
+			return func(t *testing.T) {
+				c := versionedContact{}
+				if err := db.Find("contacts", 3, &c); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.UpdateIfVersion("contacts", &c, 0); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.Set("contacts", 3, "_rev", 100); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrConflict, db.UpdateIfVersion("contacts", &c, 1))
+
+				tx, err := db.Begin()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Update("contacts", &c); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Commit(); err != nil {
+					t.Fatal(err)
+				}
+
+				found := versionedContact{}
+				if err := db.Find("contacts", 3, &found); err != nil {
+					t.Fatal(err)
+				}
+
+				if found.Rev != 3 {
+					t.Errorf("want %v; got %v", 3, found.Rev)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//UpdateIfVersion (workers)...
+
+			return func(t *testing.T) {
+				var wg sync.WaitGroup
+
+				for i := 0; i < 10; i++ {
+					wg.Add(1)
+
+					go func() {
+						defer wg.Done()
+
+						for {
+							c := versionedContact{}
+							if err := db.Find("contacts", 3, &c); err != nil {
+								t.Error(err)
+								return
+							}
+
+							c.Age++
+
+							err := db.UpdateIfVersion("contacts", &c, c.Rev)
+							if errors.Is(err, dberr.ErrConflict) {
+								continue
+							}
+							if err != nil {
+								t.Error(err)
+							}
+
+							return
+						}
+					}()
+				}
+
+				wg.Wait()
+
+				found := versionedContact{}
+				if err := db.Find("contacts", 3, &found); err != nil {
+					t.Fatal(err)
+				}
+
+				if found.Age != 28 || found.Rev != 10 {
+					t.Errorf("want %v and %v; got %v and %v", 28, 10, found.Age, found.Rev)
+				}
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
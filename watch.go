@@ -0,0 +1,385 @@
+package hare
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/jameycribbs/hare/dberr"
+	"github.com/jameycribbs/hare/keys"
+)
+
+// Defaults for a Watcher's options.
+const (
+	defaultWatchBuffer  = 64
+	defaultWatchTimeout = time.Second
+)
+
+// EventKind is the kind of change an Event reports.
+type EventKind int
+
+const (
+	// EventInsert reports a new record.
+	EventInsert EventKind = iota
+
+	// EventUpdate reports a changed record.
+	EventUpdate
+
+	// EventDelete reports a removed record.
+	EventDelete
+
+	// EventCreateTable reports a new table.
+	EventCreateTable
+
+	// EventDropTable reports a removed table.
+	EventDropTable
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventInsert:
+		return "insert"
+	case EventUpdate:
+		return "update"
+	case EventDelete:
+		return "delete"
+	case EventCreateTable:
+		return "create table"
+	case EventDropTable:
+		return "drop table"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a change to a table.  Old holds the record as json before the
+// change and New holds it after, so an insert has no Old and a delete
+// has no New.  Key is the record's key in a table with string keys.
+// Seq numbers the events of a database in the order the changes were
+// made.
+type Event struct {
+	Kind  EventKind
+	Table string
+	ID    int
+	Key   string
+	Old   json.RawMessage
+	New   json.RawMessage
+	Seq   uint64
+}
+
+// WatchOption configures a Watcher.
+type WatchOption func(*Watcher)
+
+// WatchBuffer takes the number of events a watcher can hold before a
+// write has to wait for the subscriber to catch up.  It defaults to 64.
+func WatchBuffer(n int) WatchOption {
+	return func(w *Watcher) {
+		w.buffer = n
+	}
+}
+
+// WatchTimeout takes how long a write waits for room in a full watcher
+// before giving up on the watcher and closing it.  It defaults to one
+// second.  Zero closes a full watcher at once.
+func WatchTimeout(d time.Duration) WatchOption {
+	return func(w *Watcher) {
+		w.timeout = d
+	}
+}
+
+// Watcher delivers the changes made to a table as Events.  A subscriber
+// that falls so far behind that a write has waited out the watcher's
+// timeout is closed, and Err returns dberr.ErrWatcherTooSlow.
+//
+// Writes hand their events to a watcher without holding the watch lock,
+// so a slow subscriber only holds up writes to the tables it watches.
+// Each event takes a ticket while the watch lock is held, and the
+// events are sent in ticket order, which is the order of their Seq.
+type Watcher struct {
+	db        *Database
+	tableName string
+	events    chan Event
+	buffer    int
+	timeout   time.Duration
+
+	mu     sync.Mutex
+	turn   *sync.Cond
+	next   uint64
+	served uint64
+	stop   chan struct{}
+	closed bool
+	err    error
+}
+
+// Watch takes a table name and any options and returns a Watcher that
+// delivers every change made to the table from then on, in the order
+// the changes were made.  The table does not have to exist yet, so the
+// watcher also sees it being created.  An empty table name watches
+// every table.
+func (db *Database) Watch(tableName string, opts ...WatchOption) (*Watcher, error) {
+	w := &Watcher{db: db, tableName: tableName, buffer: defaultWatchBuffer, timeout: defaultWatchTimeout}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	if w.buffer < 0 {
+		w.buffer = 0
+	}
+
+	w.events = make(chan Event, w.buffer)
+	w.stop = make(chan struct{})
+	w.turn = sync.NewCond(&w.mu)
+
+	db.watchLock.Lock()
+	defer db.watchLock.Unlock()
+
+	if db.watchers == nil {
+		return nil, dberr.ErrClosed
+	}
+
+	db.watchers[w] = struct{}{}
+
+	return w, nil
+}
+
+// Close stops the watcher and closes its channel.
+func (w *Watcher) Close() error {
+	w.db.watchLock.Lock()
+	delete(w.db.watchers, w)
+	w.db.watchLock.Unlock()
+
+	w.close(nil)
+
+	return nil
+}
+
+// Err returns dberr.ErrWatcherTooSlow if the watcher was closed because
+// it fell behind.
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// Events returns the channel the watcher delivers events on.  It is
+// closed when the watcher is.
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// unexported methods
+
+// close marks the watcher closed and stops any send that is waiting for
+// room.  The channel is closed once no send is left in progress.  The
+// caller takes the watcher out of the database's watchers first, so no
+// more tickets are handed out.
+func (w *Watcher) close(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+
+	w.closed = true
+	w.err = err
+	close(w.stop)
+
+	if w.served == w.next {
+		close(w.events)
+	}
+}
+
+// done ends the turn of the send that holds it, and closes the channel
+// if the watcher was closed and that was the last send.
+func (w *Watcher) done() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.served++
+
+	if w.closed && w.served == w.next {
+		close(w.events)
+	}
+
+	w.turn.Broadcast()
+}
+
+// send takes a ticket and an event and, once every earlier ticket has
+// been served, delivers the event.  If the watcher stays full for its
+// timeout, it is closed.
+func (w *Watcher) send(ticket uint64, e Event) {
+	w.mu.Lock()
+	for w.served != ticket {
+		w.turn.Wait()
+	}
+	closed := w.closed
+	w.mu.Unlock()
+
+	defer w.done()
+
+	if closed {
+		return
+	}
+
+	select {
+	case w.events <- e:
+		return
+	default:
+	}
+
+	if w.timeout > 0 {
+		timer := time.NewTimer(w.timeout)
+		defer timer.Stop()
+
+		select {
+		case w.events <- e:
+			return
+		case <-w.stop:
+			return
+		case <-timer.C:
+		}
+	}
+
+	w.db.watchLock.Lock()
+	delete(w.db.watchers, w)
+	w.db.watchLock.Unlock()
+
+	w.close(dberr.ErrWatcherTooSlow)
+}
+
+// ticket hands out the watcher's next turn to send.  It expects the
+// caller to hold the watch lock.
+func (w *Watcher) ticket() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ticket := w.next
+	w.next++
+
+	return ticket
+}
+
+// closeWatchers closes every watcher, when the database is closed.
+func (db *Database) closeWatchers() {
+	db.watchLock.Lock()
+	defer db.watchLock.Unlock()
+
+	for w := range db.watchers {
+		w.close(nil)
+	}
+
+	db.watchers = nil
+}
+
+// publish takes an event kind, a table name, a record id, and the raw
+// record before and after the change, and delivers an event to every
+// watcher of the table.  Writes call it while holding the table lock,
+// so the events of a table are delivered in the order it was changed.
+// The watch lock is only held to number the event and hand out
+// tickets, never while waiting for a watcher.
+func (db *Database) publish(kind EventKind, tableName string, id int, oldRaw []byte, newRaw []byte) {
+	var watchers []*Watcher
+	var tickets []uint64
+
+	db.watchLock.Lock()
+
+	for w := range db.watchers {
+		if w.tableName == "" || w.tableName == tableName {
+			watchers = append(watchers, w)
+			tickets = append(tickets, w.ticket())
+		}
+	}
+
+	if len(watchers) == 0 {
+		db.watchLock.Unlock()
+		return
+	}
+
+	db.watchSeq++
+	seq := db.watchSeq
+
+	db.watchLock.Unlock()
+
+	e := Event{Kind: kind, Table: tableName, ID: id, Seq: seq}
+	e.Old = db.eventRec(tableName, oldRaw)
+	e.New = db.eventRec(tableName, newRaw)
+
+	if db.keyType(tableName) != keys.Int {
+		e.Key = eventKey(e.New, e.Old)
+	}
+
+	for i, w := range watchers {
+		w.send(tickets[i], e)
+	}
+}
+
+// eventRec takes a table name and a raw record and returns the record as
+// json for an event, or nil if it cannot be converted.
+func (db *Database) eventRec(tableName string, rawRec []byte) json.RawMessage {
+	if rawRec == nil {
+		return nil
+	}
+
+	jsonRec, err := db.toJSON(tableName, rawRec)
+	if err != nil {
+		return nil
+	}
+
+	return json.RawMessage(bytes.TrimSuffix(jsonRec, []byte{'\n'}))
+}
+
+// eventKey takes the json records of an event and returns the key of
+// the first one there is.
+func eventKey(jsonRecs ...json.RawMessage) string {
+	for _, jsonRec := range jsonRecs {
+		var keyRec struct {
+			Key string `json:"id"`
+		}
+
+		if jsonRec != nil && json.Unmarshal(jsonRec, &keyRec) == nil {
+			return keyRec.Key
+		}
+	}
+
+	return ""
+}
+
+// watched takes a table name and returns true if anyone is watching the
+// table.
+func (db *Database) watched(tableName string) bool {
+	db.watchLock.Lock()
+	defer db.watchLock.Unlock()
+
+	return db.watchedLocked(tableName)
+}
+
+func (db *Database) watchedLocked(tableName string) bool {
+	for w := range db.watchers {
+		if w.tableName == "" || w.tableName == tableName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// watchedRec takes a table name and a record id and returns the record
+// as it is stored, if anyone is watching the table, so it can be sent
+// as the old record of an event.  It expects the caller to hold the
+// table lock.
+func (db *Database) watchedRec(tableName string, id int) []byte {
+	if !db.watched(tableName) {
+		return nil
+	}
+
+	rawRec, err := db.store.ReadRec(tableName, id)
+	if err != nil {
+		return nil
+	}
+
+	return rawRec
+}
@@ -0,0 +1,321 @@
+package hare
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// publishedEvents returns the number of events the database has published.
+func (db *Database) publishedEvents() uint64 {
+	db.watchLock.Lock()
+	defer db.watchLock.Unlock()
+
+	return db.watchSeq
+}
+
+// nextEvent takes a watcher and returns its next event, failing if there
+// is none waiting.
+func nextEvent(t *testing.T, w *Watcher) Event {
+	t.Helper()
+
+	select {
+	case e, ok := <-w.Events():
+		if !ok {
+			t.Fatal("watcher is closed")
+		}
+		return e
+	default:
+		t.Fatal("no event waiting")
+	}
+
+	return Event{}
+}
+
+// eventDoc takes a raw json record from an event and returns it decoded.
+func eventDoc(t *testing.T, raw json.RawMessage) map[string]interface{} {
+	t.Helper()
+
+	if raw == nil {
+		return nil
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
+
+func TestWatchTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//Insert, Update, and Delete events...
+
+			return func(t *testing.T) {
+				w, err := db.Watch("contacts")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer w.Close()
+
+				id, err := db.Insert("contacts", &Contact{FirstName: "Robin", LastName: "Williams", Age: 88})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.Update("contacts", &Contact{ID: 4, FirstName: "Hazel", LastName: "Keller", Age: 26}); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.Delete("contacts", 3); err != nil {
+					t.Fatal(err)
+				}
+
+				e := nextEvent(t, w)
+
+				if e.Kind != EventInsert || e.Table != "contacts" || e.ID != id || e.Old != nil {
+					t.Errorf("want an insert of %d; got %+v", id, e)
+				}
+
+				if got := eventDoc(t, e.New)["first_name"]; got != "Robin" {
+					t.Errorf("want %v; got %v", "Robin", got)
+				}
+
+				e = nextEvent(t, w)
+
+				if e.Kind != EventUpdate || e.ID != 4 {
+					t.Errorf("want an update of 4; got %+v", e)
+				}
+
+				want := []interface{}{"Helen", "Hazel"}
+				got := []interface{}{eventDoc(t, e.Old)["first_name"], eventDoc(t, e.New)["first_name"]}
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				e = nextEvent(t, w)
+
+				if e.Kind != EventDelete || e.ID != 3 || e.New != nil {
+					t.Errorf("want a delete of 3; got %+v", e)
+				}
+
+				if got := eventDoc(t, e.Old)["first_name"]; got != "Bill" {
+					t.Errorf("want %v; got %v", "Bill", got)
+				}
+
+				if e.Seq != 3 {
+					t.Errorf("want %v; got %v", 3, e.Seq)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Table events and watching every table...
+
+			return func(t *testing.T) {
+				w, err := db.Watch("")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer w.Close()
+
+				if err := db.CreateTable("newtable"); err != nil {
+					t.Fatal(err)
+				}
+
+				if _, err := db.Insert("newtable", &Contact{FirstName: "Robin"}); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.DropTable("newtable"); err != nil {
+					t.Fatal(err)
+				}
+
+				want := []EventKind{EventCreateTable, EventInsert, EventDropTable}
+
+				var got []EventKind
+				for range want {
+					e := nextEvent(t, w)
+					if e.Table != "newtable" {
+						t.Errorf("want %v; got %v", "newtable", e.Table)
+					}
+					got = append(got, e.Kind)
+				}
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Transaction events...
+
+			return func(t *testing.T) {
+				w, err := db.Watch("contacts")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer w.Close()
+
+				tx, err := db.Begin()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Update("contacts", &Contact{ID: 1, FirstName: "Jack", LastName: "Doe", Age: 38}); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Delete("contacts", 1); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Commit(); err != nil {
+					t.Fatal(err)
+				}
+
+				e := nextEvent(t, w)
+
+				if e.Kind != EventUpdate || eventDoc(t, e.Old)["first_name"] != "John" || eventDoc(t, e.New)["first_name"] != "Jack" {
+					t.Errorf("want an update from John to Jack; got %+v", e)
+				}
+
+				e = nextEvent(t, w)
+
+				if e.Kind != EventDelete || eventDoc(t, e.Old)["first_name"] != "Jack" {
+					t.Errorf("want a delete of Jack; got %+v", e)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//A slow watcher is closed...
+
+			return func(t *testing.T) {
+				w, err := db.Watch("contacts", WatchBuffer(1), WatchTimeout(0))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for i := 0; i < 3; i++ {
+					if _, err := db.Insert("contacts", &Contact{FirstName: "Robin"}); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				checkErr(t, dberr.ErrWatcherTooSlow, w.Err())
+
+				// The buffered event is still delivered before the
+				// channel is closed.
+				nextEvent(t, w)
+
+				if _, ok := <-w.Events(); ok {
+					t.Error("want the watcher closed")
+				}
+
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Close...
+
+			return func(t *testing.T) {
+				w, err := db.Watch("contacts")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.Delete("contacts", 1); err != nil {
+					t.Fatal(err)
+				}
+
+				if _, ok := <-w.Events(); ok {
+					t.Error("want the watcher closed")
+				}
+
+				if err := w.Err(); err != nil {
+					t.Errorf("want no error; got %v", err)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//A slow watcher does not hold up other tables...
+
+			return func(t *testing.T) {
+				if err := db.CreateTable("newtable"); err != nil {
+					t.Fatal(err)
+				}
+
+				w, err := db.Watch("newtable", WatchBuffer(0), WatchTimeout(time.Minute))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				inserted := make(chan error)
+
+				go func() {
+					_, err := db.Insert("newtable", &Contact{FirstName: "Robin"})
+					inserted <- err
+				}()
+
+				// Wait until the insert is blocked on the unread watcher.
+				for db.publishedEvents() == 0 {
+					time.Sleep(time.Millisecond)
+				}
+
+				start := time.Now()
+
+				if _, err := db.Insert("contacts", &Contact{FirstName: "Robin"}); err != nil {
+					t.Fatal(err)
+				}
+
+				if elapsed := time.Since(start); elapsed > time.Second {
+					t.Errorf("want the insert not to wait; waited %v", elapsed)
+				}
+
+				// Closing the watcher does not wait for the send either,
+				// and lets the blocked insert finish.
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+
+				select {
+				case err := <-inserted:
+					if err != nil {
+						t.Fatal(err)
+					}
+				case <-time.After(10 * time.Second):
+					t.Fatal("want the insert to finish once the watcher is closed")
+				}
+
+				if _, ok := <-w.Events(); ok {
+					t.Error("want the watcher closed")
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Watch (ErrClosed error)...
+
+			return func(t *testing.T) {
+				if err := db.Close(); err != nil {
+					t.Fatal(err)
+				}
+
+				_, gotErr := db.Watch("contacts")
+				checkErr(t, dberr.ErrClosed, gotErr)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}